@@ -3,9 +3,13 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"net"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
 
 	"log/slog"
 )
@@ -19,6 +23,24 @@ type Config struct {
 	RateLimit     int64  `json:"rate_limit,omitempty"`
 	CryptoKey     string `json:"crypto_key,omitempty"`
 	UseGRPC       bool   `json:"use_grpc,omitempty"`
+	Labels        string `json:"labels,omitempty"`
+}
+
+// parseLabels разбирает метки вида host=a,env=prod.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q", pair)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return labels, entities.ValidateLabels(labels)
 }
 
 func (cfg Config) isValid() bool {
@@ -41,6 +63,11 @@ func (cfg Config) isValid() bool {
 		slog.Error("Количество одновременно исходящих запросов должно быть больше 0")
 		return false
 	}
+
+	if _, err := parseLabels(cfg.Labels); err != nil {
+		slog.Error("Ошибка в передаче меток метрик", "error", err)
+		return false
+	}
 	return true
 }
 
@@ -60,6 +87,7 @@ func GetConfig() (*Config, bool) {
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "public key")
 	flag.StringVar(&cfg.SelfIP, "self-ip", "127.0.0.1", "your ip address")
 	flag.BoolVar(&cfg.UseGRPC, "g", false, "use grpc")
+	flag.StringVar(&cfg.Labels, "labels", "", "metric labels, e.g. host=a,env=prod")
 
 	// Читаем переменные окружения
 	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
@@ -104,6 +132,10 @@ func GetConfig() (*Config, bool) {
 		cfg.UseGRPC = envUseGRPC == "true"
 	}
 
+	if envLabels := os.Getenv("LABELS"); envLabels != "" {
+		cfg.Labels = envLabels
+	}
+
 	flag.Parse()
 
 	if configFilePath != "" {
@@ -140,6 +172,9 @@ func GetConfig() (*Config, bool) {
 		if flag.Lookup("crypto-key").Value.String() == "" && tmpCfg.CryptoKey != "" {
 			cfg.CryptoKey = tmpCfg.CryptoKey
 		}
+		if flag.Lookup("labels").Value.String() == "" && tmpCfg.Labels != "" {
+			cfg.Labels = tmpCfg.Labels
+		}
 	}
 
 	return cfg, cfg.isValid()
@@ -26,7 +26,8 @@ func main() {
 		panic("Не верно проинцелизирован конфиг файл")
 	}
 
-	a := client.NewAgent(config.AddrServer, config.SelfIP, config.UseGRPC)
+	labels, _ := parseLabels(config.Labels)
+	a := client.NewAgent(config.AddrServer, config.SelfIP, config.UseGRPC, labels)
 	r := time.Duration(config.ReportTimeout) * time.Second
 	p := time.Duration(config.PollTimeout) * time.Second
 
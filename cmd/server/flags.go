@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"strconv"
@@ -11,16 +12,47 @@ import (
 	"log/slog"
 )
 
+// Хранилища метрик, выбираемые флагом -storage.
+const (
+	storageMemory   = "memory"
+	storagePostgres = "postgres"
+	storageBolt     = "bolt"
+)
+
 type Config struct {
 	AddrServer    string `json:"address,omitempty"`
+	Storage       string `json:"storage,omitempty"`
+	BoltFile      string `json:"bolt_path,omitempty"`
 	AddrDatabase  string `json:"database_dsn,omitempty"`
+	DBMaxConns    uint64 `json:"database_max_conns,omitempty"`
+	DBTimeout     uint64 `json:"database_statement_timeout,omitempty"`
+	DBCacheTTL    uint64 `json:"database_cache_ttl,omitempty"`
+	DBCacheSize   uint64 `json:"database_cache_size,omitempty"`
 	LogLevel      string `json:"log_level,omitempty"`
 	StoreInterval uint64 `json:"store_interval,omitempty"`
 	FilenameSave  string `json:"file_storage_path,omitempty"`
 	RestoreData   bool   `json:"restore,omitempty"`
+	SnapshotGzip  bool   `json:"snapshot_gzip,omitempty"`
+	WALFile       string `json:"wal_path,omitempty"`
+	WALSync       string `json:"wal_sync,omitempty"`
 	SecretKey     string `json:"key,omitempty"`
 	CryptoKey     string `json:"crypto_key,omitempty"`
 	TrustedSubnet string `json:"trusted_subnet,omitempty"`
+	MetricsAllow  string `json:"metrics_allow,omitempty"`
+	IngestAllow   string `json:"ingest_allow,omitempty"`
+	RulesFile     string `json:"rules_file,omitempty"`
+	RulesInterval uint64 `json:"rules_interval,omitempty"`
+	Webhooks      string `json:"webhooks,omitempty"`
+	NotifyQueue   string `json:"notify_queue_path,omitempty"`
+	Retention     string `json:"retention,omitempty"`
+	CompactPeriod uint64 `json:"compact_interval,omitempty"`
+	ReportPeriod  uint64 `json:"report_interval,omitempty"`
+	AddrStatsD    string `json:"statsd_address,omitempty"`
+	StatsDFlush   uint64 `json:"statsd_flush_interval,omitempty"`
+	AddrGraphite  string `json:"graphite_address,omitempty"`
+	GraphiteLine  uint64 `json:"graphite_max_line,omitempty"`
+	GraphiteConns uint64 `json:"graphite_max_conns,omitempty"`
+	ShutdownWait  uint64 `json:"shutdown_timeout,omitempty"`
 }
 
 func ParseFlags() (*Config, error) {
@@ -32,24 +64,85 @@ func ParseFlags() (*Config, error) {
 
 	// Флаги
 	flag.StringVar(&cfg.AddrServer, "a", "localhost:8080", "server and port to run server")
+	flag.StringVar(&cfg.Storage, "storage", "", "metrics storage: memory, postgres or bolt, by default postgres if -d is set, otherwise memory")
+	flag.StringVar(&cfg.BoltFile, "bolt-path", "metrics.db", "filename for bolt storage")
 	flag.StringVar(&cfg.AddrDatabase, "d", "", "address to postgres base")
+	flag.Uint64Var(&cfg.DBMaxConns, "db-max-conns", 0, "max postgres pool connections, 0 uses pgxpool default")
+	flag.Uint64Var(&cfg.DBTimeout, "db-statement-timeout", 0, "postgres statement timeout in seconds, 0 disables timeout")
+	flag.Uint64Var(&cfg.DBCacheTTL, "db-cache-ttl", 0, "seconds to cache gauge and counter values read from postgres, 0 disables cache; "+
+		"with several servers on one database reads and alerts may lag writes of other servers by up to ttl")
+	flag.Uint64Var(&cfg.DBCacheSize, "db-cache-size", 10000, "max series in postgres read cache")
 	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
 	flag.Uint64Var(&cfg.StoreInterval, "i", 300, "save to file interval")
 	flag.StringVar(&cfg.FilenameSave, "f", "data.json", "filename for save and restore data")
 	flag.BoolVar(&cfg.RestoreData, "r", true, "is restor data from file")
+	flag.BoolVar(&cfg.SnapshotGzip, "snapshot-gzip", false, "compress saved data with gzip")
+	flag.StringVar(&cfg.WALFile, "wal", "", "filename for write-ahead log, empty disables log")
+	flag.StringVar(&cfg.WALSync, "wal-sync", "interval", "write-ahead log fsync policy: always, interval or never")
 	flag.StringVar(&cfg.SecretKey, "k", "", "secret key for encryption")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "privat key")
 	flag.StringVar(&cfg.TrustedSubnet, "t", "", "sunbnet clients")
+	flag.StringVar(&cfg.MetricsAllow, "metrics-allow", "", "CIDR of scrapers allowed to read /metrics, by default trusted subnet")
+	flag.StringVar(&cfg.IngestAllow, "ingest-allow", "", "CIDR of remote-write and line protocol clients, by default trusted subnet")
+	flag.StringVar(&cfg.RulesFile, "rules", "", "path to alert rules file")
+	flag.Uint64Var(&cfg.RulesInterval, "rules-interval", 15, "alert rules evaluation interval")
+	flag.StringVar(&cfg.Webhooks, "webhooks", "", "comma separated webhook urls for alert notifications")
+	flag.StringVar(&cfg.NotifyQueue, "notify-queue", "notify_queue.json", "filename for pending notifications")
+	flag.StringVar(&cfg.Retention, "retention", "raw:24h,1m:7d,1h:90d", "history retention policy")
+	flag.Uint64Var(&cfg.CompactPeriod, "compact-interval", 60, "history compaction interval")
+	flag.Uint64Var(&cfg.ReportPeriod, "report-interval", 10, "shortest interval in seconds between writes of one series, sizes raw history in memory")
+	flag.StringVar(&cfg.AddrStatsD, "statsd", "", "udp address for statsd listener")
+	flag.Uint64Var(&cfg.StatsDFlush, "statsd-flush", 10, "statsd flush interval")
+	flag.StringVar(&cfg.AddrGraphite, "graphite", "", "tcp address for graphite plaintext listener")
+	flag.Uint64Var(&cfg.GraphiteLine, "graphite-max-line", 4096, "graphite max line length")
+	flag.Uint64Var(&cfg.GraphiteConns, "graphite-max-conns", 100, "graphite max connections")
+	flag.Uint64Var(&cfg.ShutdownWait, "shutdown-timeout", 30, "graceful shutdown timeout")
 
 	// Переменные окружения
 	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
 		cfg.AddrServer = envRunAddr
 	}
 
+	if envStorage := os.Getenv("STORAGE"); envStorage != "" {
+		cfg.Storage = envStorage
+	}
+
+	if envBoltFile := os.Getenv("BOLT_PATH"); envBoltFile != "" {
+		cfg.BoltFile = envBoltFile
+	}
+
 	if envDatabaseAddr := os.Getenv("DATABASE_DSN"); envDatabaseAddr != "" {
 		cfg.AddrDatabase = envDatabaseAddr
 	}
 
+	if envDBMaxConns := os.Getenv("DATABASE_MAX_CONNS"); envDBMaxConns != "" {
+		uValue, err := strconv.ParseUint(envDBMaxConns, 10, 64)
+		if err == nil {
+			cfg.DBMaxConns = uValue
+		}
+	}
+
+	if envDBTimeout := os.Getenv("DATABASE_STATEMENT_TIMEOUT"); envDBTimeout != "" {
+		uValue, err := strconv.ParseUint(envDBTimeout, 10, 64)
+		if err == nil {
+			cfg.DBTimeout = uValue
+		}
+	}
+
+	if envDBCacheTTL := os.Getenv("DATABASE_CACHE_TTL"); envDBCacheTTL != "" {
+		uValue, err := strconv.ParseUint(envDBCacheTTL, 10, 64)
+		if err == nil {
+			cfg.DBCacheTTL = uValue
+		}
+	}
+
+	if envDBCacheSize := os.Getenv("DATABASE_CACHE_SIZE"); envDBCacheSize != "" {
+		uValue, err := strconv.ParseUint(envDBCacheSize, 10, 64)
+		if err == nil {
+			cfg.DBCacheSize = uValue
+		}
+	}
+
 	if envRunLogLVL := os.Getenv("LOG_LVL"); envRunLogLVL != "" {
 		cfg.LogLevel = envRunLogLVL
 	}
@@ -69,6 +162,18 @@ func ParseFlags() (*Config, error) {
 		cfg.RestoreData = envRestoreData == "true"
 	}
 
+	if envSnapshotGzip := os.Getenv("SNAPSHOT_GZIP"); envSnapshotGzip != "" {
+		cfg.SnapshotGzip = envSnapshotGzip == "true"
+	}
+
+	if envWALFile := os.Getenv("WAL_PATH"); envWALFile != "" {
+		cfg.WALFile = envWALFile
+	}
+
+	if envWALSync := os.Getenv("WAL_SYNC"); envWALSync != "" {
+		cfg.WALSync = envWALSync
+	}
+
 	if envSecretKey := os.Getenv("KEY"); envSecretKey != "" {
 		cfg.SecretKey = envSecretKey
 	}
@@ -81,6 +186,87 @@ func ParseFlags() (*Config, error) {
 		cfg.TrustedSubnet = envTrustedSubnet
 	}
 
+	if envMetricsAllow := os.Getenv("METRICS_ALLOW"); envMetricsAllow != "" {
+		cfg.MetricsAllow = envMetricsAllow
+	}
+
+	if envIngestAllow := os.Getenv("INGEST_ALLOW"); envIngestAllow != "" {
+		cfg.IngestAllow = envIngestAllow
+	}
+
+	if envRulesFile := os.Getenv("RULES_FILE"); envRulesFile != "" {
+		cfg.RulesFile = envRulesFile
+	}
+
+	if envRulesInterval := os.Getenv("RULES_INTERVAL"); envRulesInterval != "" {
+		uValue, err := strconv.ParseUint(envRulesInterval, 10, 64)
+		if err == nil {
+			cfg.RulesInterval = uValue
+		}
+	}
+
+	if envWebhooks := os.Getenv("WEBHOOKS"); envWebhooks != "" {
+		cfg.Webhooks = envWebhooks
+	}
+
+	if envNotifyQueue := os.Getenv("NOTIFY_QUEUE_PATH"); envNotifyQueue != "" {
+		cfg.NotifyQueue = envNotifyQueue
+	}
+
+	if envRetention := os.Getenv("RETENTION"); envRetention != "" {
+		cfg.Retention = envRetention
+	}
+
+	if envCompactPeriod := os.Getenv("COMPACT_INTERVAL"); envCompactPeriod != "" {
+		uValue, err := strconv.ParseUint(envCompactPeriod, 10, 64)
+		if err == nil {
+			cfg.CompactPeriod = uValue
+		}
+	}
+
+	if envReportPeriod := os.Getenv("REPORT_INTERVAL"); envReportPeriod != "" {
+		uValue, err := strconv.ParseUint(envReportPeriod, 10, 64)
+		if err == nil {
+			cfg.ReportPeriod = uValue
+		}
+	}
+
+	if envStatsD := os.Getenv("STATSD_ADDRESS"); envStatsD != "" {
+		cfg.AddrStatsD = envStatsD
+	}
+
+	if envStatsDFlush := os.Getenv("STATSD_FLUSH_INTERVAL"); envStatsDFlush != "" {
+		uValue, err := strconv.ParseUint(envStatsDFlush, 10, 64)
+		if err == nil {
+			cfg.StatsDFlush = uValue
+		}
+	}
+
+	if envGraphite := os.Getenv("GRAPHITE_ADDRESS"); envGraphite != "" {
+		cfg.AddrGraphite = envGraphite
+	}
+
+	if envGraphiteLine := os.Getenv("GRAPHITE_MAX_LINE"); envGraphiteLine != "" {
+		uValue, err := strconv.ParseUint(envGraphiteLine, 10, 64)
+		if err == nil {
+			cfg.GraphiteLine = uValue
+		}
+	}
+
+	if envGraphiteConns := os.Getenv("GRAPHITE_MAX_CONNS"); envGraphiteConns != "" {
+		uValue, err := strconv.ParseUint(envGraphiteConns, 10, 64)
+		if err == nil {
+			cfg.GraphiteConns = uValue
+		}
+	}
+
+	if envShutdownWait := os.Getenv("SHUTDOWN_TIMEOUT"); envShutdownWait != "" {
+		uValue, err := strconv.ParseUint(envShutdownWait, 10, 64)
+		if err == nil {
+			cfg.ShutdownWait = uValue
+		}
+	}
+
 	flag.Parse()
 
 	// Чтение JSON-конфига (если указан)
@@ -106,9 +292,27 @@ func ParseFlags() (*Config, error) {
 		if flag.Lookup("a").Value.String() == "localhost:8080" && tmpCfg.AddrServer != "" {
 			cfg.AddrServer = tmpCfg.AddrServer
 		}
+		if flag.Lookup("storage").Value.String() == "" && tmpCfg.Storage != "" {
+			cfg.Storage = tmpCfg.Storage
+		}
+		if flag.Lookup("bolt-path").Value.String() == "metrics.db" && tmpCfg.BoltFile != "" {
+			cfg.BoltFile = tmpCfg.BoltFile
+		}
 		if flag.Lookup("d").Value.String() == "" && tmpCfg.AddrDatabase != "" {
 			cfg.AddrDatabase = tmpCfg.AddrDatabase
 		}
+		if flag.Lookup("db-max-conns").Value.String() == "0" && tmpCfg.DBMaxConns > 0 {
+			cfg.DBMaxConns = tmpCfg.DBMaxConns
+		}
+		if flag.Lookup("db-statement-timeout").Value.String() == "0" && tmpCfg.DBTimeout > 0 {
+			cfg.DBTimeout = tmpCfg.DBTimeout
+		}
+		if flag.Lookup("db-cache-ttl").Value.String() == "0" && tmpCfg.DBCacheTTL > 0 {
+			cfg.DBCacheTTL = tmpCfg.DBCacheTTL
+		}
+		if flag.Lookup("db-cache-size").Value.String() == "10000" && tmpCfg.DBCacheSize > 0 {
+			cfg.DBCacheSize = tmpCfg.DBCacheSize
+		}
 		if flag.Lookup("l").Value.String() == "info" && tmpCfg.LogLevel != "" {
 			cfg.LogLevel = tmpCfg.LogLevel
 		}
@@ -121,6 +325,15 @@ func ParseFlags() (*Config, error) {
 		if flag.Lookup("r").Value.String() == "true" {
 			cfg.RestoreData = tmpCfg.RestoreData
 		}
+		if flag.Lookup("snapshot-gzip").Value.String() == "false" && tmpCfg.SnapshotGzip {
+			cfg.SnapshotGzip = tmpCfg.SnapshotGzip
+		}
+		if flag.Lookup("wal").Value.String() == "" && tmpCfg.WALFile != "" {
+			cfg.WALFile = tmpCfg.WALFile
+		}
+		if flag.Lookup("wal-sync").Value.String() == "interval" && tmpCfg.WALSync != "" {
+			cfg.WALSync = tmpCfg.WALSync
+		}
 		if flag.Lookup("k").Value.String() == "" && tmpCfg.SecretKey != "" {
 			cfg.SecretKey = tmpCfg.SecretKey
 		}
@@ -130,6 +343,51 @@ func ParseFlags() (*Config, error) {
 		if flag.Lookup("trusted_subnet").Value.String() == "" && tmpCfg.CryptoKey != "" {
 			cfg.TrustedSubnet = tmpCfg.TrustedSubnet
 		}
+		if flag.Lookup("metrics-allow").Value.String() == "" && tmpCfg.MetricsAllow != "" {
+			cfg.MetricsAllow = tmpCfg.MetricsAllow
+		}
+		if flag.Lookup("ingest-allow").Value.String() == "" && tmpCfg.IngestAllow != "" {
+			cfg.IngestAllow = tmpCfg.IngestAllow
+		}
+		if flag.Lookup("rules").Value.String() == "" && tmpCfg.RulesFile != "" {
+			cfg.RulesFile = tmpCfg.RulesFile
+		}
+		if flag.Lookup("rules-interval").Value.String() == "15" && tmpCfg.RulesInterval > 0 {
+			cfg.RulesInterval = tmpCfg.RulesInterval
+		}
+		if flag.Lookup("webhooks").Value.String() == "" && tmpCfg.Webhooks != "" {
+			cfg.Webhooks = tmpCfg.Webhooks
+		}
+		if flag.Lookup("notify-queue").Value.String() == "notify_queue.json" && tmpCfg.NotifyQueue != "" {
+			cfg.NotifyQueue = tmpCfg.NotifyQueue
+		}
+		if flag.Lookup("retention").Value.String() == "raw:24h,1m:7d,1h:90d" && tmpCfg.Retention != "" {
+			cfg.Retention = tmpCfg.Retention
+		}
+		if flag.Lookup("compact-interval").Value.String() == "60" && tmpCfg.CompactPeriod > 0 {
+			cfg.CompactPeriod = tmpCfg.CompactPeriod
+		}
+		if flag.Lookup("report-interval").Value.String() == "10" && tmpCfg.ReportPeriod > 0 {
+			cfg.ReportPeriod = tmpCfg.ReportPeriod
+		}
+		if flag.Lookup("statsd").Value.String() == "" && tmpCfg.AddrStatsD != "" {
+			cfg.AddrStatsD = tmpCfg.AddrStatsD
+		}
+		if flag.Lookup("statsd-flush").Value.String() == "10" && tmpCfg.StatsDFlush > 0 {
+			cfg.StatsDFlush = tmpCfg.StatsDFlush
+		}
+		if flag.Lookup("graphite").Value.String() == "" && tmpCfg.AddrGraphite != "" {
+			cfg.AddrGraphite = tmpCfg.AddrGraphite
+		}
+		if flag.Lookup("graphite-max-line").Value.String() == "4096" && tmpCfg.GraphiteLine > 0 {
+			cfg.GraphiteLine = tmpCfg.GraphiteLine
+		}
+		if flag.Lookup("graphite-max-conns").Value.String() == "100" && tmpCfg.GraphiteConns > 0 {
+			cfg.GraphiteConns = tmpCfg.GraphiteConns
+		}
+		if flag.Lookup("shutdown-timeout").Value.String() == "30" && tmpCfg.ShutdownWait > 0 {
+			cfg.ShutdownWait = tmpCfg.ShutdownWait
+		}
 	}
 
 	// Валидация
@@ -138,5 +396,56 @@ func ParseFlags() (*Config, error) {
 		return nil, fmt.Errorf("неверный адрес сервера: %w", err)
 	}
 
+	switch cfg.Storage {
+	case "":
+		cfg.Storage = storageMemory
+		if cfg.AddrDatabase != "" {
+			cfg.Storage = storagePostgres
+		}
+	case storagePostgres:
+		if cfg.AddrDatabase == "" {
+			return nil, fmt.Errorf("для хранилища postgres нужен адрес базы")
+		}
+	case storageBolt:
+		if cfg.BoltFile == "" {
+			return nil, fmt.Errorf("для хранилища bolt нужен путь к файлу базы")
+		}
+	case storageMemory:
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище %q: ожидается memory, postgres или bolt", cfg.Storage)
+	}
+
+	if cfg.DBMaxConns > math.MaxInt32 {
+		return nil, fmt.Errorf("количество соединений с базой должно быть не больше %d", math.MaxInt32)
+	}
+
+	if cfg.DBCacheTTL > 0 && (cfg.DBCacheSize == 0 || cfg.DBCacheSize > math.MaxInt32) {
+		return nil, fmt.Errorf("размер кэша базы должен быть от 1 до %d", math.MaxInt32)
+	}
+
+	if cfg.CompactPeriod == 0 {
+		return nil, fmt.Errorf("интервал сжатия истории должен быть больше 0")
+	}
+
+	if cfg.ReportPeriod == 0 {
+		return nil, fmt.Errorf("интервал записи метрик должен быть больше 0")
+	}
+
+	if cfg.AddrStatsD != "" && cfg.StatsDFlush == 0 {
+		return nil, fmt.Errorf("интервал записи statsd должен быть больше 0")
+	}
+
+	if cfg.AddrGraphite != "" && (cfg.GraphiteLine == 0 || cfg.GraphiteConns == 0) {
+		return nil, fmt.Errorf("длина строки и количество соединений graphite должны быть больше 0")
+	}
+
+	if cfg.ShutdownWait == 0 {
+		return nil, fmt.Errorf("время завершения работы должно быть больше 0")
+	}
+
+	if cfg.RulesFile != "" && cfg.RulesInterval == 0 {
+		return nil, fmt.Errorf("интервал вычисления правил должен быть больше 0")
+	}
+
 	return cfg, nil
 }
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/rsa"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/echo9et/alerting/internal/entities"
 	"github.com/echo9et/alerting/internal/logger"
+	"github.com/echo9et/alerting/internal/server/alerts"
 	"github.com/echo9et/alerting/internal/server/coreserver"
+	"github.com/echo9et/alerting/internal/server/graphite"
+	"github.com/echo9et/alerting/internal/server/lifecycle"
+	"github.com/echo9et/alerting/internal/server/notifier"
+	"github.com/echo9et/alerting/internal/server/statsd"
 	"github.com/echo9et/alerting/internal/server/storage"
 
 	"log/slog"
@@ -23,6 +32,14 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Printf("Build version: %s\n", buildVersion)
 	fmt.Printf("Build date: %s\n", buildDate)
 	fmt.Printf("Build commit: %s\n", buildCommit)
@@ -32,23 +49,73 @@ func main() {
 		panic(err)
 	}
 
+	manager := lifecycle.New(time.Duration(cfg.ShutdownWait) * time.Second)
+
+	retention, err := storage.ParseRetention(cfg.Retention)
+	if err != nil {
+		panic(err)
+	}
+
 	var store entities.Storage
-	if cfg.AddrDatabase != "" {
+	switch cfg.Storage {
+	case storagePostgres:
 		slog.Info("start with postgres")
-		store, err = storage.NewPDatabase(cfg.AddrDatabase)
+		options := storage.PoolOptions{
+			MaxConns:         int32(cfg.DBMaxConns),
+			StatementTimeout: time.Duration(cfg.DBTimeout) * time.Second,
+		}
+		base, err := storage.NewPDatabase(cfg.AddrDatabase, options)
+		if err != nil {
+			panic(err)
+		}
+		store = base
+		if cfg.DBCacheTTL > 0 {
+			slog.Info("postgres read cache enabled, values may be stale", "ttl", time.Duration(cfg.DBCacheTTL)*time.Second)
+			store = storage.NewCache(base, storage.CacheOptions{
+				TTL:  time.Duration(cfg.DBCacheTTL) * time.Second,
+				Size: int(cfg.DBCacheSize),
+			})
+		}
+	case storageBolt:
+		slog.Info("start with bolt storage", "path", cfg.BoltFile)
+		store, err = storage.NewBolt(cfg.BoltFile)
 		if err != nil {
 			panic(err)
 		}
-	} else {
+	default:
 		slog.Info("start with mem storage")
-		store, err = storage.NewSaver(storage.NewMemStore(), cfg.FilenameSave, cfg.RestoreData, time.Duration(cfg.StoreInterval)*time.Second)
+		walSync, err := storage.ParseSyncPolicy(cfg.WALSync)
+		if err != nil {
+			panic(err)
+		}
+		options := storage.SaverOptions{
+			Compress: cfg.SnapshotGzip,
+			WAL:      storage.WALOptions{Filename: cfg.WALFile, Sync: walSync},
+		}
+		// Сырая история в памяти должна покрывать retention raw при записи раз в -report-interval.
+		history := retention.RawSamples(time.Duration(cfg.ReportPeriod) * time.Second)
+		slog.Info(fmt.Sprintf("mem storage keeps up to %d raw samples per series", history))
+		store, err = storage.NewSaver(storage.NewMemStoreHistory(history), cfg.FilenameSave, cfg.RestoreData, time.Duration(cfg.StoreInterval)*time.Second, options)
 		if err != nil {
 			panic(err)
 		}
 	}
 
+	// Хранилище регистрируется первым и останавливается последним, после всех источников записи.
+	if closer, ok := store.(io.Closer); ok {
+		manager.OnStop("storage", func(ctx context.Context) error {
+			return closer.Close()
+		})
+	}
+
 	logger.Initilization(cfg.LogLevel)
 
+	if compacter, ok := store.(storage.Compacter); ok {
+		manager.Go("compactor", func(ctx context.Context) {
+			storage.RunCompactor(ctx, compacter, retention, time.Duration(cfg.CompactPeriod)*time.Second)
+		})
+	}
+
 	var privateKey *rsa.PrivateKey
 	if cfg.CryptoKey != "" {
 		privateKey, err = entities.GetPrivateKey(cfg.CryptoKey)
@@ -63,8 +130,51 @@ func main() {
 			panic(err)
 		}
 	}
+	var metricsAllow *net.IPNet
+	if cfg.MetricsAllow != "" {
+		_, metricsAllow, err = net.ParseCIDR(cfg.MetricsAllow)
+		if err != nil {
+			panic(err)
+		}
+	}
+	var ingestAllow *net.IPNet
+	if cfg.IngestAllow != "" {
+		_, ingestAllow, err = net.ParseCIDR(cfg.IngestAllow)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var engine *alerts.Engine
+	if cfg.RulesFile != "" {
+		rules, err := alerts.LoadRules(cfg.RulesFile)
+		if err != nil {
+			panic(err)
+		}
+
+		var notify alerts.Notifier
+		if cfg.Webhooks != "" {
+			webhook, err := notifier.NewWebhook(strings.Split(cfg.Webhooks, ","), cfg.SecretKey, cfg.NotifyQueue)
+			if err != nil {
+				panic(err)
+			}
+			manager.Go("webhook", webhook.Run)
+			notify = webhook
+		}
+		engine = alerts.NewEngine(store, rules, time.Duration(cfg.RulesInterval)*time.Second, notify)
+	}
+
+	var statsdListener *statsd.Listener
+	if cfg.AddrStatsD != "" {
+		statsdListener = statsd.NewListener(cfg.AddrStatsD, time.Duration(cfg.StatsDFlush)*time.Second, store)
+	}
+
+	var graphiteListener *graphite.Listener
+	if cfg.AddrGraphite != "" {
+		graphiteListener = graphite.NewListener(cfg.AddrGraphite, int(cfg.GraphiteLine), int(cfg.GraphiteConns), store)
+	}
 
-	if err := coreserver.Run(cfg.AddrServer, cfg.AddrDatabase, store, cfg.SecretKey, privateKey, subnet); err != nil {
+	if err := coreserver.Run(manager, cfg.AddrServer, cfg.AddrDatabase, store, cfg.SecretKey, privateKey, subnet, metricsAllow, ingestAllow, engine, statsdListener, graphiteListener); err != nil {
 		panic(err)
 	}
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/echo9et/alerting/internal/server/storage"
+)
+
+const migrateUsage = "usage: server migrate status|up|down [-d dsn] [-steps n]"
+
+// runMigrate выполняет подкоманду migrate: status выводит состояние миграций,
+// up применяет все новые миграции, down откатывает последние steps миграций.
+func runMigrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+	command := args[0]
+	if command != "status" && command != "up" && command != "down" {
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dsn := flags.String("d", os.Getenv("DATABASE_DSN"), "address to postgres base")
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		return fmt.Errorf("адрес базы не задан: укажите -d или DATABASE_DSN")
+	}
+
+	migrator, err := storage.OpenMigrator(*dsn)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	switch command {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	case "up":
+		n, err := migrator.Up(ctx)
+		fmt.Fprintf(out, "applied %d migrations\n", n)
+		return err
+	case "down":
+		if *steps <= 0 {
+			return fmt.Errorf("steps должно быть больше 0")
+		}
+		n, err := migrator.Down(ctx, *steps)
+		fmt.Fprintf(out, "rolled back %d migrations\n", n)
+		return err
+	}
+	return nil
+}
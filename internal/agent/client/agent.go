@@ -31,17 +31,30 @@ type Agent struct {
 	outServer string
 	selfIP    string
 	useGRPC   bool
+	labels    map[string]string
 }
 
-// NewAgent конструктор для создания объекта агента
-func NewAgent(addressServer, selfIP string, useGRPC bool) *Agent {
+// NewAgent конструктор для создания объекта агента, labels добавляются ко всем метрикам.
+func NewAgent(addressServer, selfIP string, useGRPC bool, labels map[string]string) *Agent {
 	return &Agent{metrics: metrics.NewMetricsRuntime(),
 		outServer: addressServer,
 		selfIP:    selfIP,
 		useGRPC:   useGRPC,
+		labels:    labels,
 	}
 }
 
+// withLabels добавляет метки агента к метрикам.
+func (a *Agent) withLabels(metrics []entities.MetricsJSON) []entities.MetricsJSON {
+	if len(a.labels) == 0 {
+		return metrics
+	}
+	for i := range metrics {
+		metrics[i].Labels = a.labels
+	}
+	return metrics
+}
+
 // UpdateMetrics запуск сбора метрик и отправки их на сервер.
 func (a Agent) UpdateMetrics(reportInterval time.Duration, pollInterval time.Duration, key string, rateLimit int64, pubKey *rsa.PublicKey) {
 
@@ -70,7 +83,7 @@ func (a *Agent) push(in chan []entities.MetricsJSON, secretKey string, wg *sync.
 	}
 
 	for metric := range in {
-		data, err := json.Marshal(metric)
+		data, err := json.Marshal(a.withLabels(metric))
 		if err != nil {
 			slog.Error(fmt.Sprintln(err))
 			return
@@ -170,17 +183,28 @@ func (a *Agent) pushGRPC(in chan []entities.MetricsJSON, pubKey *rsa.PublicKey)
 
 	for jsonMetrics := range in {
 		var metrics []*pb.Metric
-		for _, metric := range jsonMetrics {
+		for _, metric := range a.withLabels(jsonMetrics) {
 			if metric.MType == entities.Counter {
-				metrics = append(metrics, &pb.Metric{
-					Id:    metric.ID,
-					Type:  pb.Metric_GOUNTER,
-					Delta: *metric.Delta,
-				})
+				m := &pb.Metric{
+					Id:     metric.ID,
+					Type:   pb.Metric_GOUNTER,
+					Delta:  *metric.Delta,
+					Total:  metric.Total,
+					Labels: metric.Labels,
+				}
+				metrics = append(metrics, m)
 			} else if metric.MType == entities.Gauge {
 				metrics = append(metrics, &pb.Metric{Id: metric.ID,
-					Type:  pb.Metric_GAUGE,
-					Value: *metric.Value,
+					Type:   pb.Metric_GAUGE,
+					Value:  *metric.Value,
+					Labels: metric.Labels,
+				})
+			} else if metric.MType == entities.Histogram {
+				h := metric.Histogram
+				metrics = append(metrics, &pb.Metric{Id: metric.ID,
+					Type:      pb.Metric_HISTOGRAM,
+					Labels:    metric.Labels,
+					Histogram: &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count},
 				})
 			} else {
 				slog.Error("Unknow type")
@@ -15,9 +15,19 @@ type Metricer interface {
 	Update()
 }
 
+// gcPauseBuckets границы корзин гистограммы пауз GC в секундах.
+var gcPauseBuckets = []float64{1e-5, 5e-5, 1e-4, 2.5e-4, 5e-4, 1e-3, 2.5e-3, 5e-3, 1e-2, 5e-2, 0.1}
+
+// data собранные значения метрик.
+// Counters содержит накопленные значения с момента запуска агента, при отправке передается
+// приращение с прошлой отправки и само накопленное значение, по которому сервер
+// обнаруживает перезапуск агента и повторную отправку.
 type data struct {
-	Counters map[string]uint64
-	Gauges   map[string]float64
+	Counters   map[string]uint64
+	Gauges     map[string]float64
+	Histograms map[string]*entities.HistogramData
+	// sent накопленные значения counter на момент прошлой отправки.
+	sent map[string]uint64
 }
 
 func (d *data) toJSON() []entities.MetricsJSON {
@@ -30,71 +40,110 @@ func (d *data) toJSON() []entities.MetricsJSON {
 		metrics = append(metrics, metric)
 	}
 	for key, value := range d.Counters {
-		iValue := int64(value)
+		delta := value
+		if sent := d.sent[key]; value >= sent {
+			delta = value - sent
+		}
+		d.sent[key] = value
+
+		iDelta, iTotal := int64(delta), int64(value)
 		metric := entities.MetricsJSON{}
 		metric.ID = key
 		metric.MType = entities.Counter
-		metric.Delta = &iValue
+		metric.Delta = &iDelta
+		metric.Total = &iTotal
 		metrics = append(metrics, metric)
 	}
+	// Гистограммы передаются приращением: после отправки накопление начинается заново.
+	for key, value := range d.Histograms {
+		if value.Count == 0 {
+			continue
+		}
+		metrics = append(metrics, entities.MetricsJSON{ID: key, MType: entities.Histogram, Histogram: value})
+		d.Histograms[key] = entities.NewHistogram(value.Bounds)
+	}
 
 	return metrics
 }
 
 func newData() data {
 	return data{
-		Counters: make(map[string]uint64),
-		Gauges:   make(map[string]float64),
+		Counters:   make(map[string]uint64),
+		Gauges:     make(map[string]float64),
+		Histograms: make(map[string]*entities.HistogramData),
+		sent:       make(map[string]uint64),
 	}
 }
 
 type MetricsRuntime struct {
 	Memory runtime.MemStats
 	data   data
+	numGC  uint32
 }
 
 // NewMetrics возвращает структуру с метриками рантайма приложения
 func NewMetricsRuntime() *MetricsRuntime {
 	runtime.GC()
+	d := newData()
+	d.Histograms["GCPause"] = entities.NewHistogram(gcPauseBuckets)
 	return &MetricsRuntime{
-		data: newData(),
+		data: d,
 	}
 }
 
+// Update читает статистику рантайма. Монотонно растущие значения (количество аллокаций,
+// сборок мусора, суммарное время пауз) сохраняются как counter, текущие размеры памяти - как gauge.
 func (m *MetricsRuntime) Update() {
 	runtime.ReadMemStats(&m.Memory)
 	m.data.Counters["PollCount"] += 1
-	m.data.Counters["Alloc"] = m.Memory.Alloc
-	m.data.Counters["BuckHashSys"] = m.Memory.BuckHashSys
 	m.data.Counters["Frees"] = m.Memory.Frees
-	m.data.Counters["GCSys"] = m.Memory.GCSys
-	m.data.Counters["HeapAlloc"] = m.Memory.HeapAlloc
-	m.data.Counters["HeapIdle"] = m.Memory.HeapIdle
-	m.data.Counters["HeapInuse"] = m.Memory.HeapInuse
-	m.data.Counters["HeapObjects"] = m.Memory.HeapObjects
-	m.data.Counters["HeapReleased"] = m.Memory.HeapReleased
-	m.data.Counters["HeapSys"] = m.Memory.HeapSys
-	m.data.Counters["LastGC"] = m.Memory.LastGC
 	m.data.Counters["Lookups"] = m.Memory.Lookups
-	m.data.Counters["MCacheInuse"] = m.Memory.MCacheInuse
-	m.data.Counters["MCacheSys"] = m.Memory.MCacheSys
-	m.data.Counters["MSpanInuse"] = m.Memory.MSpanInuse
-	m.data.Counters["MSpanSys"] = m.Memory.MSpanSys
 	m.data.Counters["Mallocs"] = m.Memory.Mallocs
-	m.data.Counters["NextGC"] = m.Memory.NextGC
 	m.data.Counters["NumForcedGC"] = uint64(m.Memory.NumForcedGC)
 	m.data.Counters["NumGC"] = uint64(m.Memory.NumGC)
-	m.data.Counters["OtherSys"] = m.Memory.OtherSys
 	m.data.Counters["PauseTotalNs"] = m.Memory.PauseTotalNs
-	m.data.Counters["StackInuse"] = m.Memory.StackInuse
-	m.data.Counters["StackSys"] = m.Memory.StackSys
-	m.data.Counters["Sys"] = m.Memory.Sys
 	m.data.Counters["TotalAlloc"] = m.Memory.TotalAlloc
 
+	m.data.Gauges["Alloc"] = float64(m.Memory.Alloc)
+	m.data.Gauges["BuckHashSys"] = float64(m.Memory.BuckHashSys)
+	m.data.Gauges["GCSys"] = float64(m.Memory.GCSys)
+	m.data.Gauges["HeapAlloc"] = float64(m.Memory.HeapAlloc)
+	m.data.Gauges["HeapIdle"] = float64(m.Memory.HeapIdle)
+	m.data.Gauges["HeapInuse"] = float64(m.Memory.HeapInuse)
+	m.data.Gauges["HeapObjects"] = float64(m.Memory.HeapObjects)
+	m.data.Gauges["HeapReleased"] = float64(m.Memory.HeapReleased)
+	m.data.Gauges["HeapSys"] = float64(m.Memory.HeapSys)
+	m.data.Gauges["LastGC"] = float64(m.Memory.LastGC)
+	m.data.Gauges["MCacheInuse"] = float64(m.Memory.MCacheInuse)
+	m.data.Gauges["MCacheSys"] = float64(m.Memory.MCacheSys)
+	m.data.Gauges["MSpanInuse"] = float64(m.Memory.MSpanInuse)
+	m.data.Gauges["MSpanSys"] = float64(m.Memory.MSpanSys)
+	m.data.Gauges["NextGC"] = float64(m.Memory.NextGC)
+	m.data.Gauges["OtherSys"] = float64(m.Memory.OtherSys)
+	m.data.Gauges["StackInuse"] = float64(m.Memory.StackInuse)
+	m.data.Gauges["StackSys"] = float64(m.Memory.StackSys)
+	m.data.Gauges["Sys"] = float64(m.Memory.Sys)
 	m.data.Gauges["RandomValue"] = rand.Float64()
 	m.data.Gauges["GCCPUFraction"] = m.Memory.GCCPUFraction
+	m.observeGCPauses()
+}
+
+// observeGCPauses добавляет в гистограмму GCPause паузы сборок, завершенных с прошлого Update.
+// runtime.MemStats хранит только последние len(PauseNs) пауз.
+func (m *MetricsRuntime) observeGCPauses() {
+	n := len(m.Memory.PauseNs)
+	from := m.numGC
+	if m.Memory.NumGC-from > uint32(n) {
+		from = m.Memory.NumGC - uint32(n)
+	}
+	for i := from; i < m.Memory.NumGC; i++ {
+		pause := m.Memory.PauseNs[(i+uint32(n))%uint32(n)]
+		m.data.Histograms["GCPause"].Observe(float64(pause) / 1e9)
+	}
+	m.numGC = m.Memory.NumGC
 }
 
+// ToJSON возвращает метрики для отправки, накопленные гистограммы при этом сбрасываются.
 func (m *MetricsRuntime) ToJSON() []entities.MetricsJSON {
 	return m.data.toJSON()
 }
@@ -112,8 +161,8 @@ func NewMetricsMem() *MetricsMem {
 
 func (m *MetricsMem) Update() {
 	v, _ := mem.VirtualMemory()
-	m.data.Counters["TotalMemory"] = v.Total
-	m.data.Counters["FreeMemory"] = v.Free
+	m.data.Gauges["TotalMemory"] = float64(v.Total)
+	m.data.Gauges["FreeMemory"] = float64(v.Free)
 
 	c, _ := cpu.Percent(0, true)
 	for i, percent := range c {
@@ -28,6 +28,16 @@ func TestMetricsRuntime_Update(t *testing.T) {
 			err:   "GCCPUFraction should be updated",
 			mType: entities.Gauge,
 		},
+		{
+			name:  "HeapAlloc",
+			err:   "HeapAlloc should be updated",
+			mType: entities.Gauge,
+		},
+		{
+			name:  "TotalAlloc",
+			err:   "TotalAlloc should be updated",
+			mType: entities.Counter,
+		},
 	}
 
 	metrics := NewMetricsRuntime()
@@ -91,12 +101,12 @@ func TestMetricsMem_Update(t *testing.T) {
 		{
 			name:  "TotalMemory",
 			err:   "TotalMemory should be updated",
-			mType: entities.Counter,
+			mType: entities.Gauge,
 		},
 		{
 			name:  "FreeMemory",
 			err:   "FreeMemory should be updated",
-			mType: entities.Counter,
+			mType: entities.Gauge,
 		},
 	}
 
@@ -104,7 +114,7 @@ func TestMetricsMem_Update(t *testing.T) {
 	metrics.Update()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.NotZero(t, metrics.data.Counters[tt.name], tt.err)
+			assert.NotZero(t, metrics.data.Gauges[tt.name], tt.err)
 		})
 	}
 }
@@ -118,12 +128,12 @@ func TestMetricsMem_ToJSON(t *testing.T) {
 		{
 			name:  "TotalMemory",
 			err:   "TotalMemory should be updated",
-			mType: entities.Counter,
+			mType: entities.Gauge,
 		},
 		{
 			name:  "FreeMemory",
 			err:   "FreeMemory should be updated",
-			mType: entities.Counter,
+			mType: entities.Gauge,
 		},
 	}
 
@@ -142,3 +152,49 @@ func TestMetricsMem_ToJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestMetricsRuntime_GCPause(t *testing.T) {
+	metrics := NewMetricsRuntime()
+	metrics.Update()
+
+	var histogram *entities.HistogramData
+	for _, metric := range metrics.ToJSON() {
+		if metric.ID == "GCPause" && metric.MType == entities.Histogram {
+			histogram = metric.Histogram
+		}
+	}
+	if assert.NotNil(t, histogram, "GCPause should be sent after GC") {
+		assert.NoError(t, histogram.Validate())
+		assert.NotZero(t, histogram.Count)
+	}
+
+	// После отправки гистограмма накапливается заново.
+	assert.Zero(t, metrics.data.Histograms["GCPause"].Count)
+}
+
+func TestDataCounterDelta(t *testing.T) {
+	d := newData()
+	counter := func(metrics []entities.MetricsJSON) (int64, int64) {
+		for _, m := range metrics {
+			if m.ID == "Mallocs" && m.MType == entities.Counter {
+				return *m.Delta, *m.Total
+			}
+		}
+		t.Fatal("Mallocs not sent")
+		return 0, 0
+	}
+
+	d.Counters["Mallocs"] = 100
+	delta, total := counter(d.toJSON())
+	assert.Equal(t, int64(100), delta)
+	assert.Equal(t, int64(100), total)
+
+	d.Counters["Mallocs"] = 130
+	delta, total = counter(d.toJSON())
+	assert.Equal(t, int64(30), delta)
+	assert.Equal(t, int64(130), total)
+
+	// Без новых значений приращение нулевое.
+	delta, _ = counter(d.toJSON())
+	assert.Zero(t, delta)
+}
@@ -1,6 +1,7 @@
 package compgzip
 
 import (
+	"bytes"
 	"compress/gzip"
 	"io"
 	"net/http"
@@ -71,6 +72,29 @@ func (c *compressReader) Close() error {
 	return c.zr.Close()
 }
 
+// Compress сжимает данные в формате gzip.
+func Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress распаковывает данные, сжатые в формате gzip.
+func Decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
 func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ow := w
@@ -91,3 +91,18 @@ func TestGzipMiddleware_ContentTypes(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Hello, Gzip!", string(body))
 }
+
+func TestCompress(t *testing.T) {
+	data := []byte(strings.Repeat("Hello, Gzip! ", 100))
+
+	compressed, err := Compress(data)
+	assert.NoError(t, err)
+	assert.Less(t, len(compressed), len(data))
+
+	decompressed, err := Decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+
+	_, err = Decompress(data)
+	assert.Error(t, err)
+}
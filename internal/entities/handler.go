@@ -1,5 +1,7 @@
 package entities
 
+import "time"
+
 type ManagerValues interface {
 	GetGauge(string) (string, bool)
 	SetGauge(string, float64)
@@ -10,11 +12,20 @@ type ManagerValues interface {
 type ManagerJSON interface {
 	AllMetricsJSON() []MetricsJSON
 	SetMetrics([]MetricsJSON) error
+	GetMetric(mType, name string) (MetricsJSON, bool)
+}
+
+type ManagerHistory interface {
+	Range(mType, name string, from, to time.Time) ([]Sample, error)
 }
 
+// Storage хранилище метрик. Методы ManagerValues и ManagerJSON остаются для фоновых задач,
+// которым не нужны ошибки хранилища, обработчики запросов используют StorageV2.
 type Storage interface {
+	StorageV2
 	ManagerJSON
 	ManagerValues
+	ManagerHistory
 
 	AllMetrics() map[string]string
 	Ping() bool
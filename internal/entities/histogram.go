@@ -0,0 +1,105 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+var (
+	ErrInvalidHistogram = errors.New("invalid histogram")
+	ErrBoundsMismatch   = errors.New("histogram bounds mismatch")
+)
+
+// DefaultBuckets границы корзин гистограммы по умолчанию.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramData распределение значений по корзинам.
+// Bounds - возрастающие верхние границы корзин, Counts - количество значений в каждой корзине
+// (не накопительное), последний элемент Counts - корзина +Inf.
+// Значения, переданные в хранилище, считаются приращением и складываются с уже накопленными.
+type HistogramData struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram создает пустую гистограмму с границами bounds.
+func NewHistogram(bounds []float64) *HistogramData {
+	return &HistogramData{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe добавляет значение в гистограмму.
+func (h *HistogramData) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate проверяет согласованность границ, корзин и количества значений.
+func (h *HistogramData) Validate() error {
+	if err := ValidateBounds(h.Bounds); err != nil {
+		return err
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: expected %d counts, got %d", ErrInvalidHistogram, len(h.Bounds)+1, len(h.Counts))
+	}
+
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return fmt.Errorf("%w: count %d does not match buckets total %d", ErrInvalidHistogram, h.Count, count)
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("%w: sum must be finite", ErrInvalidHistogram)
+	}
+	return nil
+}
+
+// ValidateBounds проверяет, что границы конечны и строго возрастают.
+func ValidateBounds(bounds []float64) error {
+	if len(bounds) == 0 {
+		return fmt.Errorf("%w: no bounds", ErrInvalidHistogram)
+	}
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("%w: bound %v must be finite", ErrInvalidHistogram, b)
+		}
+		if i > 0 && b <= bounds[i-1] {
+			return fmt.Errorf("%w: bounds must be strictly increasing", ErrInvalidHistogram)
+		}
+	}
+	return nil
+}
+
+// Merge добавляет значения гистограммы o, границы корзин должны совпадать.
+func (h *HistogramData) Merge(o HistogramData) error {
+	if !slices.Equal(h.Bounds, o.Bounds) || len(h.Counts) != len(o.Counts) {
+		return ErrBoundsMismatch
+	}
+	for i, c := range o.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// Clone возвращает копию гистограммы.
+func (h HistogramData) Clone() *HistogramData {
+	return &HistogramData{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
@@ -0,0 +1,63 @@
+package entities
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		h.Observe(v)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(5), h.Count)
+	assert.Equal(t, 31.5, h.Sum)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogramValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       HistogramData
+		wantErr bool
+	}{
+		{name: "ok", h: HistogramData{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7, Count: 3}},
+		{name: "no bounds", h: HistogramData{Counts: []uint64{1}, Count: 1}, wantErr: true},
+		{name: "unsorted bounds", h: HistogramData{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}, wantErr: true},
+		{name: "infinite bound", h: HistogramData{Bounds: []float64{1, math.Inf(1)}, Counts: []uint64{0, 0, 0}}, wantErr: true},
+		{name: "counts length", h: HistogramData{Bounds: []float64{1, 2}, Counts: []uint64{1, 2}, Count: 3}, wantErr: true},
+		{name: "count mismatch", h: HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 2}, Count: 4}, wantErr: true},
+		{name: "nan sum", h: HistogramData{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: math.NaN(), Count: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.h.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHistogram)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	h := HistogramData{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 2}, Sum: 7, Count: 3}
+	clone := h.Clone()
+
+	assert.NoError(t, h.Merge(HistogramData{Bounds: []float64{1, 2}, Counts: []uint64{0, 1, 0}, Sum: 1.5, Count: 1}))
+	assert.Equal(t, []uint64{1, 1, 2}, h.Counts)
+	assert.Equal(t, 8.5, h.Sum)
+	assert.Equal(t, uint64(4), h.Count)
+
+	// Копия не меняется вместе с исходной гистограммой.
+	assert.Equal(t, []uint64{1, 0, 2}, clone.Counts)
+
+	err := h.Merge(HistogramData{Bounds: []float64{1, 3}, Counts: []uint64{0, 0, 0}})
+	assert.ErrorIs(t, err, ErrBoundsMismatch)
+	assert.Equal(t, uint64(4), h.Count)
+}
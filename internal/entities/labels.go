@@ -0,0 +1,229 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLabel имя метки не соответствует формату Prometheus или зарезервировано.
+var ErrInvalidLabel = errors.New("invalid label")
+
+// ErrInvalidMetricID имя метрики содержит символы, которые ParseSeriesKey принял бы за набор меток.
+var ErrInvalidMetricID = errors.New("invalid metric id")
+
+// LabelGroupBy параметр запроса со списком меток для группировки, не является меткой.
+const LabelGroupBy = "group_by"
+
+// Метки, которые добавляются при выводе histogram и summary в формате Prometheus.
+const (
+	LabelBucket   = "le"
+	LabelQuantile = "quantile"
+)
+
+// SeriesKey ключ серии метрики: имя и отсортированные метки в виде name{k="v",...}.
+// Для метрики без меток ключ совпадает с именем.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesKey разбирает ключ серии на имя и метки.
+// Если ключ не содержит корректного набора меток, он целиком считается именем.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	labels := make(map[string]string)
+	rest := key[i+1 : len(key)-1]
+	for rest != "" {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok || !validLabelName(name) {
+			return key, nil
+		}
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return key, nil
+		}
+		labels[name], _ = strconv.Unquote(quoted)
+
+		rest = value[len(quoted):]
+		if rest != "" {
+			if rest[0] != ',' || len(rest) == 1 {
+				return key, nil
+			}
+			rest = rest[1:]
+		}
+	}
+	return key[:i], labels
+}
+
+// ValidateLabels проверяет имена меток: [a-zA-Z_][a-zA-Z0-9_]*, кроме зарезервированных.
+func ValidateLabels(labels map[string]string) error {
+	for k := range labels {
+		if !validLabelName(k) || IsReservedLabel(k) {
+			return fmt.Errorf("%w name %q", ErrInvalidLabel, k)
+		}
+	}
+	return nil
+}
+
+// IsReservedLabel проверяет, зарезервировано ли имя метки: group_by - параметр запроса,
+// le и quantile совпали бы с метками бакетов и квантилей при выводе в формате Prometheus.
+func IsReservedLabel(name string) bool {
+	return name == LabelGroupBy || name == LabelBucket || name == LabelQuantile
+}
+
+// ValidateSeries проверяет имя и метки метрики, из которых строится ключ серии.
+func ValidateSeries(id string, labels map[string]string) error {
+	if err := ValidateMetricID(id); err != nil {
+		return err
+	}
+	return ValidateLabels(labels)
+}
+
+// ValidateMetricID проверяет, что имя метрики не содержит '{', '}' и '"'.
+func ValidateMetricID(id string) error {
+	if strings.ContainsAny(id, `{}"`) {
+		return fmt.Errorf("%w %q", ErrInvalidMetricID, id)
+	}
+	return nil
+}
+
+func validLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// MatchLabels проверяет, что labels содержат все метки matchers с теми же значениями.
+func MatchLabels(labels, matchers map[string]string) bool {
+	for k, v := range matchers {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterMetrics возвращает метрики типа mType и имени name с метками, удовлетворяющими matchers.
+// Пустые mType и name не ограничивают выборку.
+func FilterMetrics(metrics []MetricsJSON, mType, name string, matchers map[string]string) []MetricsJSON {
+	out := make([]MetricsJSON, 0)
+	for _, m := range metrics {
+		if (mType != "" && m.MType != mType) || (name != "" && m.ID != name) || !MatchLabels(m.Labels, matchers) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// GroupMetrics суммирует значения метрик с одинаковыми типом, именем и значениями меток groupBy,
+// гистограммы и summary объединяются по корзинам, скетчи set - в объединение множеств.
+// Результат содержит только метки groupBy и отсортирован по ключу серии.
+func GroupMetrics(metrics []MetricsJSON, groupBy []string) []MetricsJSON {
+	groups := make(map[string]*MetricsJSON)
+	for _, m := range metrics {
+		labels := make(map[string]string)
+		for _, l := range groupBy {
+			if v, ok := m.Labels[l]; ok {
+				labels[l] = v
+			}
+		}
+
+		key := m.MType + " " + SeriesKey(m.ID, labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &MetricsJSON{ID: m.ID, MType: m.MType}
+			if len(labels) > 0 {
+				g.Labels = labels
+			}
+			groups[key] = g
+		}
+
+		switch {
+		case m.MType == Counter && m.Delta != nil:
+			sum := *m.Delta
+			if g.Delta != nil {
+				sum += *g.Delta
+			}
+			g.Delta = &sum
+		case m.MType == Gauge && m.Value != nil:
+			sum := *m.Value
+			if g.Value != nil {
+				sum += *g.Value
+			}
+			g.Value = &sum
+		case m.MType == Histogram && m.Histogram != nil:
+			if g.Histogram == nil {
+				g.Histogram = m.Histogram.Clone()
+			} else if err := g.Histogram.Merge(*m.Histogram); err != nil {
+				// Гистограммы с другими границами корзин в группу не попадают.
+				continue
+			}
+		case m.MType == Summary && m.Summary != nil:
+			if g.Summary == nil {
+				g.Summary = m.Summary.Clone()
+			} else if err := g.Summary.Merge(*m.Summary); err != nil {
+				continue
+			}
+		case m.MType == Set && m.Set != nil:
+			if g.Set == nil {
+				g.Set = m.Set.Clone()
+			} else if err := g.Set.Merge(*m.Set); err != nil {
+				continue
+			}
+		}
+	}
+
+	out := make([]MetricsJSON, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	SortMetrics(out)
+	return out
+}
+
+// SortMetrics сортирует метрики по ключу серии и типу.
+func SortMetrics(metrics []MetricsJSON) {
+	sort.Slice(metrics, func(i, j int) bool {
+		ki, kj := metrics[i].Key(), metrics[j].Key()
+		if ki != kj {
+			return ki < kj
+		}
+		return metrics[i].MType < metrics[j].MType
+	})
+}
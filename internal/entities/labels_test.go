@@ -0,0 +1,104 @@
+package entities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		labels map[string]string
+		want   string
+	}{
+		{name: "no labels", id: "HeapAlloc", want: "HeapAlloc"},
+		{name: "sorted labels", id: "HeapAlloc", labels: map[string]string{"service": "api", "host": "a"},
+			want: `HeapAlloc{host="a",service="api"}`},
+		{name: "escaped value", id: "disk", labels: map[string]string{"path": `C:\data "x", y`},
+			want: `disk{path="C:\\data \"x\", y"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SeriesKey(tt.id, tt.labels)
+			assert.Equal(t, tt.want, key)
+
+			id, labels := ParseSeriesKey(key)
+			assert.Equal(t, tt.id, id)
+			if len(tt.labels) == 0 {
+				assert.Empty(t, labels)
+			} else {
+				assert.Equal(t, tt.labels, labels)
+			}
+		})
+	}
+}
+
+func TestParseSeriesKeyInvalid(t *testing.T) {
+	for _, key := range []string{"a{b}", `a{1x="v"}`, `a{x="v",}`, `a{x="v"`, `a{x=v}`} {
+		t.Run(key, func(t *testing.T) {
+			id, labels := ParseSeriesKey(key)
+			assert.Equal(t, key, id)
+			assert.Nil(t, labels)
+		})
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(map[string]string{"host": "a", "_env2": "prod"}))
+	assert.Error(t, ValidateLabels(map[string]string{"2host": "a"}))
+	assert.Error(t, ValidateLabels(map[string]string{"host-name": "a"}))
+	assert.Error(t, ValidateLabels(map[string]string{LabelGroupBy: "a"}))
+	assert.ErrorIs(t, ValidateLabels(map[string]string{LabelBucket: "0.5"}), ErrInvalidLabel)
+	assert.ErrorIs(t, ValidateLabels(map[string]string{LabelQuantile: "0.9"}), ErrInvalidLabel)
+}
+
+func TestValidateSeries(t *testing.T) {
+	assert.NoError(t, ValidateSeries("HeapAlloc", map[string]string{"host": "a"}))
+	assert.ErrorIs(t, ValidateSeries(`HeapAlloc{host="a"}`, nil), ErrInvalidMetricID)
+	assert.ErrorIs(t, ValidateSeries("HeapAlloc", map[string]string{"le": "1"}), ErrInvalidLabel)
+}
+
+func TestValidateMetricID(t *testing.T) {
+	assert.NoError(t, ValidateMetricID("HeapAlloc"))
+	assert.NoError(t, ValidateMetricID("http.requests:total"))
+	for _, id := range []string{`HeapAlloc{host="a"}`, "a{", "a}", `a"b`} {
+		assert.ErrorIs(t, ValidateMetricID(id), ErrInvalidMetricID, id)
+	}
+}
+
+func TestFilterAndGroupMetrics(t *testing.T) {
+	gauge := func(id string, v float64, labels map[string]string) MetricsJSON {
+		return MetricsJSON{ID: id, MType: Gauge, Value: &v, Labels: labels}
+	}
+	counter := func(id string, d int64, labels map[string]string) MetricsJSON {
+		return MetricsJSON{ID: id, MType: Counter, Delta: &d, Labels: labels}
+	}
+	metrics := []MetricsJSON{
+		gauge("HeapAlloc", 1, map[string]string{"host": "a", "env": "prod"}),
+		gauge("HeapAlloc", 2, map[string]string{"host": "b", "env": "prod"}),
+		gauge("HeapAlloc", 4, map[string]string{"host": "c", "env": "dev"}),
+		counter("PollCount", 5, map[string]string{"host": "a", "env": "prod"}),
+		counter("PollCount", 7, map[string]string{"host": "b", "env": "prod"}),
+	}
+
+	prod := FilterMetrics(metrics, "", "", map[string]string{"env": "prod"})
+	assert.Len(t, prod, 4)
+	assert.Len(t, FilterMetrics(metrics, Gauge, "HeapAlloc", nil), 3)
+	assert.Empty(t, FilterMetrics(metrics, Counter, "HeapAlloc", nil))
+
+	grouped := GroupMetrics(metrics, []string{"env"})
+	assert.Len(t, grouped, 3)
+	assert.Equal(t, `HeapAlloc{env="dev"}`, grouped[0].Key())
+	assert.Equal(t, 4., *grouped[0].Value)
+	assert.Equal(t, `HeapAlloc{env="prod"}`, grouped[1].Key())
+	assert.Equal(t, 3., *grouped[1].Value)
+	assert.Equal(t, `PollCount{env="prod"}`, grouped[2].Key())
+	assert.Equal(t, int64(12), *grouped[2].Delta)
+
+	total := GroupMetrics(FilterMetrics(metrics, Gauge, "HeapAlloc", nil), nil)
+	assert.Len(t, total, 1)
+	assert.Nil(t, total[0].Labels)
+	assert.Equal(t, 7., *total[0].Value)
+}
@@ -1,13 +1,97 @@
 package entities
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidCounter counter без приращения и накопленного значения или с отрицательным накопленным значением.
+	ErrInvalidCounter = errors.New("invalid counter")
+	// ErrInvalidGauge gauge без значения.
+	ErrInvalidGauge = errors.New("invalid gauge")
+	ErrUnknownType  = errors.New("unknown metric type")
+)
+
 type MetricsJSON struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID     string            `json:"id"`               // имя метрики
+	MType  string            `json:"type"`             // параметр, принимающий значение gauge или counter
+	Delta  *int64            `json:"delta,omitempty"`  // значение метрики в случае передачи counter, для set - количество уникальных значений
+	Value  *float64          `json:"value,omitempty"`  // значение метрики в случае передачи gauge
+	Total  *int64            `json:"total,omitempty"`  // накопленное значение counter с момента запуска источника
+	Labels map[string]string `json:"labels,omitempty"` // метки серии (host, service, env...)
+
+	Histogram *HistogramData `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Summary   *SummaryData   `json:"summary,omitempty"`   // значение метрики в случае передачи summary
+	Set       *SetData       `json:"set,omitempty"`       // скетч метрики в случае передачи set
+	Members   []string       `json:"members,omitempty"`   // новые значения метрики set
+}
+
+// CounterDelta приращение counter с учетом накопленного значения Total.
+// last - предыдущее накопленное значение серии, known - известно ли оно.
+// Уменьшение накопленного значения означает сброс счетчика (перезапуск источника),
+// приращением тогда считается все новое значение. Для серии без известного накопленного
+// значения используется Delta, если оно передано. Повторная отправка того же Total дает 0.
+func (m MetricsJSON) CounterDelta(last int64, known bool) (int64, error) {
+	switch {
+	case m.Total == nil && m.Delta == nil:
+		return 0, fmt.Errorf("%w: %s has neither delta nor total", ErrInvalidCounter, m.Key())
+	case m.Total == nil:
+		return *m.Delta, nil
+	case *m.Total < 0:
+		return 0, fmt.Errorf("%w: %s total must not be negative", ErrInvalidCounter, m.Key())
+	case !known && m.Delta != nil:
+		return *m.Delta, nil
+	case !known || *m.Total < last:
+		return *m.Total, nil
+	}
+	return *m.Total - last, nil
+}
+
+// Key ключ серии метрики с учетом меток.
+func (m MetricsJSON) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// FormatValue значение метрики в текстовом виде, гистограмма и summary отдаются в формате JSON,
+// для set - количество уникальных значений.
+func (m MetricsJSON) FormatValue() string {
+	switch {
+	case m.MType == Counter && m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.MType == Gauge && m.Value != nil:
+		return fmt.Sprint(*m.Value)
+	case m.MType == Histogram && m.Histogram != nil:
+		out, _ := json.Marshal(m.Histogram)
+		return string(out)
+	case m.MType == Summary && m.Summary != nil:
+		out, _ := json.Marshal(m.Summary)
+		return string(out)
+	case m.MType == Set && m.Set != nil:
+		return strconv.FormatUint(m.Set.Cardinality(), 10)
+	}
+	return ""
+}
+
+// Sample значение метрики в момент времени.
+// Для агрегированных значений Value содержит среднее для gauge и последнее значение для counter,
+// Min, Max и Count заполняются для gauge, Sum - сумма приращений counter.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Min       *float64  `json:"min,omitempty"`
+	Max       *float64  `json:"max,omitempty"`
+	Count     int64     `json:"count,omitempty"`
+	Sum       *float64  `json:"sum,omitempty"`
 }
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+	Set       = "set"
 )
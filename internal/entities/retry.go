@@ -26,7 +26,8 @@ func Retry(fn func() error) error {
 }
 
 func isRunReplay(err error) bool {
-	if pgErr, ok := err.(*pgconn.PgError); ok {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
 		switch pgErr.Code {
 		case pgerrcode.SerializationFailure:
 			return true
@@ -0,0 +1,137 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+var (
+	ErrInvalidSet        = errors.New("invalid set")
+	ErrPrecisionMismatch = errors.New("set precision mismatch")
+)
+
+const (
+	// DefaultSetPrecision количество бит индекса регистра HyperLogLog по умолчанию:
+	// 2^14 регистров, стандартная ошибка оценки около 0.8%.
+	DefaultSetPrecision = 14
+	MinSetPrecision     = 4
+	MaxSetPrecision     = 16
+)
+
+// SetData скетч HyperLogLog для оценки количества уникальных значений.
+// Registers содержит 2^Precision регистров, в каждом - наибольшая позиция первой единицы
+// в хеше значений, попавших в регистр. Скетчи с одинаковой точностью объединяются
+// поэлементным максимумом, поэтому повторная передача значений не меняет оценку.
+type SetData struct {
+	Precision uint8  `json:"precision"`
+	Registers []byte `json:"registers"`
+}
+
+// NewSet создает пустой скетч с 2^precision регистрами.
+func NewSet(precision uint8) *SetData {
+	return &SetData{
+		Precision: precision,
+		Registers: make([]byte, 1<<precision),
+	}
+}
+
+// Add добавляет значение в скетч.
+func (s *SetData) Add(member string) {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	x := mix64(h.Sum64())
+
+	i := x >> (64 - s.Precision)
+	// Маркерный бит ограничивает позицию первой единицы, если остаток хеша нулевой.
+	w := x<<s.Precision | 1<<(s.Precision-1)
+	rho := byte(bits.LeadingZeros64(w) + 1)
+	if rho > s.Registers[i] {
+		s.Registers[i] = rho
+	}
+}
+
+// mix64 перемешивает биты хеша (финализатор splitmix64), FNV плохо распределяет старшие биты.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Cardinality оценка количества уникальных значений.
+// Для небольших множеств используется линейный подсчет по пустым регистрам.
+func (s *SetData) Cardinality() uint64 {
+	m := float64(len(s.Registers))
+	if m == 0 {
+		return 0
+	}
+
+	var sum float64
+	zeros := 0
+	for _, r := range s.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+func alpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/m)
+}
+
+// Validate проверяет точность, количество регистров и их значения.
+func (s *SetData) Validate() error {
+	if s.Precision < MinSetPrecision || s.Precision > MaxSetPrecision {
+		return fmt.Errorf("%w: precision must be in [%d, %d]", ErrInvalidSet, MinSetPrecision, MaxSetPrecision)
+	}
+	if len(s.Registers) != 1<<s.Precision {
+		return fmt.Errorf("%w: expected %d registers, got %d", ErrInvalidSet, 1<<s.Precision, len(s.Registers))
+	}
+	maxRho := byte(64 - s.Precision + 1)
+	for _, r := range s.Registers {
+		if r > maxRho {
+			return fmt.Errorf("%w: register value %d exceeds %d", ErrInvalidSet, r, maxRho)
+		}
+	}
+	return nil
+}
+
+// Merge объединяет скетч с o, точность должна совпадать.
+func (s *SetData) Merge(o SetData) error {
+	if s.Precision != o.Precision || len(s.Registers) != len(o.Registers) {
+		return ErrPrecisionMismatch
+	}
+	for i, r := range o.Registers {
+		s.Registers[i] = max(s.Registers[i], r)
+	}
+	return nil
+}
+
+// Clone возвращает копию скетча.
+func (s SetData) Clone() *SetData {
+	return &SetData{
+		Precision: s.Precision,
+		Registers: slices.Clone(s.Registers),
+	}
+}
@@ -0,0 +1,71 @@
+package entities
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCardinality(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			s := NewSet(DefaultSetPrecision)
+			for i := 0; i < n; i++ {
+				s.Add("user-" + strconv.Itoa(i))
+				// Повторные значения не влияют на оценку.
+				s.Add("user-" + strconv.Itoa(i))
+			}
+			if n == 0 {
+				assert.Zero(t, s.Cardinality())
+				return
+			}
+			assert.InEpsilon(t, n, s.Cardinality(), 0.03)
+		})
+	}
+}
+
+func TestSetMerge(t *testing.T) {
+	a, b := NewSet(DefaultSetPrecision), NewSet(DefaultSetPrecision)
+	for i := 0; i < 6000; i++ {
+		if i < 4000 {
+			a.Add("ip-" + strconv.Itoa(i))
+		}
+		if i >= 2000 {
+			b.Add("ip-" + strconv.Itoa(i))
+		}
+	}
+
+	clone := a.Clone()
+	require.NoError(t, a.Merge(*b))
+	assert.InEpsilon(t, 6000, a.Cardinality(), 0.03)
+	assert.InEpsilon(t, 4000, clone.Cardinality(), 0.03)
+
+	err := a.Merge(*NewSet(10))
+	assert.ErrorIs(t, err, ErrPrecisionMismatch)
+}
+
+func TestSetValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       SetData
+		wantErr bool
+	}{
+		{name: "ok", s: *NewSet(MinSetPrecision)},
+		{name: "small precision", s: SetData{Precision: 2, Registers: make([]byte, 4)}, wantErr: true},
+		{name: "large precision", s: SetData{Precision: 20, Registers: make([]byte, 1<<20)}, wantErr: true},
+		{name: "registers length", s: SetData{Precision: 4, Registers: make([]byte, 8)}, wantErr: true},
+		{name: "register value", s: SetData{Precision: 4, Registers: append(make([]byte, 15), 62)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.s.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSet)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound метрики с таким типом и ключом серии нет в хранилище.
+	ErrNotFound = errors.New("metric not found")
+	// ErrTypeMismatch серия с таким ключом уже сохранена с другим типом метрики.
+	ErrTypeMismatch = errors.New("metric type mismatch")
+	// ErrUnavailable хранилище временно недоступно: нет соединения с базой,
+	// ошибка записи на диск, истек срок или отменен контекст вызова.
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// CacheStats статистика обращений к кэшу хранилища.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size количество серий в кэше, включая устаревшие, но еще не вытесненные.
+	Size int
+}
+
+// CacheStorage хранилище с кэшем, статистика которого отдается вместе с метриками в /metrics.
+type CacheStorage interface {
+	Stats() CacheStats
+}
+
+// UpdatePartial записывает пакет метрик, пропуская метрики, отклоненные хранилищем.
+// Пакет сначала записывается одним вызовом UpdateMetrics и при ошибке данных целиком не применяется,
+// тогда метрики записываются по одной. Возвращает ошибки отклоненных метрик по их индексу в пакете;
+// недоступность хранилища (ErrUnavailable) прерывает запись и возвращается как ошибка.
+func UpdatePartial(ctx context.Context, s StorageV2, metrics []MetricsJSON) (map[int]error, error) {
+	err := s.UpdateMetrics(ctx, metrics)
+	if err == nil || errors.Is(err, ErrUnavailable) {
+		return nil, err
+	}
+	if len(metrics) == 1 {
+		return map[int]error{0: err}, nil
+	}
+
+	rejected := make(map[int]error)
+	for i := range metrics {
+		err := s.UpdateMetrics(ctx, metrics[i:i+1])
+		if errors.Is(err, ErrUnavailable) {
+			return rejected, err
+		}
+		if err != nil {
+			rejected[i] = err
+		}
+	}
+	return rejected, nil
+}
+
+// StorageV2 хранилище метрик с контекстом вызова и типизированными значениями.
+// В отличие от ManagerValues и ManagerJSON методы возвращают ошибку, по которой
+// можно отличить отсутствие метрики (ErrNotFound), запись серии другого типа (ErrTypeMismatch),
+// некорректные данные (ErrInvalidGauge, ErrInvalidCounter...) и недоступность хранилища (ErrUnavailable).
+type StorageV2 interface {
+	Gauge(ctx context.Context, name string) (float64, error)
+	Counter(ctx context.Context, name string) (int64, error)
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+
+	Metric(ctx context.Context, mType, name string) (MetricsJSON, error)
+	Metrics(ctx context.Context) ([]MetricsJSON, error)
+	UpdateMetrics(ctx context.Context, metrics []MetricsJSON) error
+
+	History(ctx context.Context, mType, name string, from, to time.Time) ([]Sample, error)
+	Check(ctx context.Context) error
+}
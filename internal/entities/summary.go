@@ -0,0 +1,232 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+var (
+	ErrInvalidSummary   = errors.New("invalid summary")
+	ErrAccuracyMismatch = errors.New("summary accuracy mismatch")
+)
+
+const (
+	// DefaultSummaryAccuracy относительная точность квантилей summary по умолчанию.
+	DefaultSummaryAccuracy = 0.01
+	// MinSummaryAccuracy наименьшая допустимая точность, при ней индексы корзин помещаются в int32.
+	MinSummaryAccuracy = 1e-4
+	// MaxSummaryBins ограничение на количество корзин summary, при превышении
+	// корзины наименьших по модулю значений объединяются.
+	MaxSummaryBins = 8192
+	// minIndexableValue значения по модулю меньше попадают в нулевую корзину.
+	minIndexableValue = 1e-9
+)
+
+// DefaultQuantiles квантили, которые отдаются в формате Prometheus.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// SummaryData скетч распределения значений (DDSketch) для оценки квантилей без хранения значений.
+// Значение v > 0 попадает в корзину ceil(log_gamma(v)), gamma = (1+Accuracy)/(1-Accuracy),
+// отрицательные значения - в Negative по модулю, близкие к нулю - в Zero.
+// Оценка любого квантиля отличается от точного значения не более чем на Accuracy относительно.
+// Скетчи с одинаковой точностью объединяются сложением корзин, поэтому значения
+// от разных агентов передаются приращением и складываются с уже накопленными.
+type SummaryData struct {
+	Accuracy float64        `json:"accuracy"`
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zero     uint64         `json:"zero,omitempty"`
+	Sum      float64        `json:"sum"`
+	Count    uint64         `json:"count"`
+	Min      float64        `json:"min"`
+	Max      float64        `json:"max"`
+}
+
+// NewSummary создает пустой скетч с относительной точностью accuracy.
+func NewSummary(accuracy float64) *SummaryData {
+	return &SummaryData{
+		Accuracy: accuracy,
+		Positive: make(map[int]uint64),
+		Negative: make(map[int]uint64),
+	}
+}
+
+func (s *SummaryData) gamma() float64 {
+	return (1 + s.Accuracy) / (1 - s.Accuracy)
+}
+
+func (s *SummaryData) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// binValue оценка значений корзины i с относительной ошибкой не более Accuracy.
+func (s *SummaryData) binValue(i int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Observe добавляет значение в скетч.
+func (s *SummaryData) Observe(v float64) {
+	switch {
+	case v > minIndexableValue:
+		if s.Positive == nil {
+			s.Positive = make(map[int]uint64)
+		}
+		s.Positive[s.index(v)]++
+	case v < -minIndexableValue:
+		if s.Negative == nil {
+			s.Negative = make(map[int]uint64)
+		}
+		s.Negative[s.index(-v)]++
+	default:
+		s.Zero++
+	}
+
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+	s.collapse()
+}
+
+// Quantile оценка квантиля q из [0, 1], для пустого скетча возвращает NaN.
+func (s *SummaryData) Quantile(q float64) float64 {
+	switch {
+	case s.Count == 0 || q < 0 || q > 1:
+		return math.NaN()
+	case q == 0:
+		return s.Min
+	case q == 1:
+		return s.Max
+	}
+
+	rank := q * float64(s.Count-1)
+	var cumulative uint64
+	value := s.Max
+	found := false
+	visit := func(count uint64, v float64) {
+		if found {
+			return
+		}
+		cumulative += count
+		if float64(cumulative) > rank {
+			value, found = v, true
+		}
+	}
+
+	// Отрицательные значения идут от больших по модулю к меньшим.
+	for _, i := range slices.Backward(slices.Sorted(maps.Keys(s.Negative))) {
+		visit(s.Negative[i], -s.binValue(i))
+	}
+	visit(s.Zero, 0)
+	for _, i := range slices.Sorted(maps.Keys(s.Positive)) {
+		visit(s.Positive[i], s.binValue(i))
+	}
+
+	return math.Max(s.Min, math.Min(s.Max, value))
+}
+
+// Validate проверяет точность, количество корзин и согласованность количества значений.
+func (s *SummaryData) Validate() error {
+	if math.IsNaN(s.Accuracy) || s.Accuracy < MinSummaryAccuracy || s.Accuracy >= 1 {
+		return fmt.Errorf("%w: accuracy must be in [%v, 1)", ErrInvalidSummary, MinSummaryAccuracy)
+	}
+	if len(s.Positive)+len(s.Negative) > MaxSummaryBins {
+		return fmt.Errorf("%w: more than %d bins", ErrInvalidSummary, MaxSummaryBins)
+	}
+
+	count := s.Zero
+	for _, bins := range []map[int]uint64{s.Positive, s.Negative} {
+		for i, c := range bins {
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return fmt.Errorf("%w: bin index %d out of range", ErrInvalidSummary, i)
+			}
+			count += c
+		}
+	}
+	if count != s.Count {
+		return fmt.Errorf("%w: count %d does not match bins total %d", ErrInvalidSummary, s.Count, count)
+	}
+	for _, v := range []float64{s.Sum, s.Min, s.Max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: sum, min and max must be finite", ErrInvalidSummary)
+		}
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return fmt.Errorf("%w: min is greater than max", ErrInvalidSummary)
+	}
+	return nil
+}
+
+// Merge добавляет значения скетча o, точность должна совпадать.
+func (s *SummaryData) Merge(o SummaryData) error {
+	if s.Accuracy != o.Accuracy {
+		return ErrAccuracyMismatch
+	}
+	if o.Count == 0 {
+		return nil
+	}
+
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	for i, c := range o.Positive {
+		s.Positive[i] += c
+	}
+	for i, c := range o.Negative {
+		s.Negative[i] += c
+	}
+	s.Zero += o.Zero
+
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Sum += o.Sum
+	s.Count += o.Count
+	s.collapse()
+	return nil
+}
+
+// collapse объединяет корзины наименьших по модулю значений, если их больше MaxSummaryBins.
+// Точность сохраняется для больших значений, которые и определяют верхние квантили.
+// Корзин остается с запасом, чтобы не сортировать их при каждом новом значении.
+func (s *SummaryData) collapse() {
+	if len(s.Positive)+len(s.Negative) <= MaxSummaryBins {
+		return
+	}
+	for _, bins := range []map[int]uint64{s.Negative, s.Positive} {
+		excess := len(s.Positive) + len(s.Negative) - MaxSummaryBins*7/8
+		if excess <= 0 {
+			return
+		}
+		keys := slices.Sorted(maps.Keys(bins))
+		n := min(excess, len(keys)-1)
+		if n <= 0 {
+			continue
+		}
+		for _, i := range keys[:n] {
+			bins[keys[n]] += bins[i]
+			delete(bins, i)
+		}
+	}
+}
+
+// Clone возвращает копию скетча.
+func (s SummaryData) Clone() *SummaryData {
+	s.Positive = maps.Clone(s.Positive)
+	s.Negative = maps.Clone(s.Negative)
+	return &s
+}
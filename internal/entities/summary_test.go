@@ -0,0 +1,108 @@
+package entities
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummaryQuantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	values := make([]float64, 10000)
+	sd := NewSummary(DefaultSummaryAccuracy)
+	for i := range values {
+		values[i] = r.ExpFloat64() * 100
+		sd.Observe(values[i])
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0.01, 0.5, 0.9, 0.99, 0.999} {
+		want := values[int(q*float64(len(values)-1))]
+		got := sd.Quantile(q)
+		assert.InEpsilon(t, want, got, DefaultSummaryAccuracy, "q=%v", q)
+	}
+	assert.Equal(t, values[0], sd.Quantile(0))
+	assert.Equal(t, values[len(values)-1], sd.Quantile(1))
+	assert.NoError(t, sd.Validate())
+}
+
+func TestSummaryNegativeAndZero(t *testing.T) {
+	sd := NewSummary(DefaultSummaryAccuracy)
+	for _, v := range []float64{-10, -1, 0, 1, 10} {
+		sd.Observe(v)
+	}
+
+	assert.Equal(t, -10., sd.Quantile(0))
+	assert.InEpsilon(t, -1, sd.Quantile(0.25), DefaultSummaryAccuracy)
+	assert.Equal(t, 0., sd.Quantile(0.5))
+	assert.InEpsilon(t, 1, sd.Quantile(0.75), DefaultSummaryAccuracy)
+	assert.Equal(t, 10., sd.Quantile(1))
+	assert.True(t, math.IsNaN(NewSummary(DefaultSummaryAccuracy).Quantile(0.5)))
+}
+
+func TestSummaryMerge(t *testing.T) {
+	a, b, all := NewSummary(DefaultSummaryAccuracy), NewSummary(DefaultSummaryAccuracy), NewSummary(DefaultSummaryAccuracy)
+	for i := 1; i <= 1000; i++ {
+		v := float64(i)
+		all.Observe(v)
+		if i%2 == 0 {
+			a.Observe(v)
+		} else {
+			b.Observe(v)
+		}
+	}
+
+	clone := a.Clone()
+	require.NoError(t, a.Merge(*b))
+	assert.Equal(t, all.Count, a.Count)
+	assert.Equal(t, all.Sum, a.Sum)
+	assert.Equal(t, all.Min, a.Min)
+	assert.Equal(t, all.Max, a.Max)
+	assert.Equal(t, all.Positive, a.Positive)
+	assert.Equal(t, uint64(500), clone.Count)
+
+	err := a.Merge(*NewSummary(0.05))
+	assert.ErrorIs(t, err, ErrAccuracyMismatch)
+}
+
+func TestSummaryCollapse(t *testing.T) {
+	sd := NewSummary(MinSummaryAccuracy)
+	for v := 1e-6; v < 1e12; v *= 1.0005 {
+		sd.Observe(v)
+	}
+
+	assert.LessOrEqual(t, len(sd.Positive), MaxSummaryBins)
+	assert.NoError(t, sd.Validate())
+	assert.InEpsilon(t, sd.Max, sd.Quantile(1), MinSummaryAccuracy)
+	assert.InEpsilon(t, 1e12, sd.Quantile(0.999), 0.05)
+}
+
+func TestSummaryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sd      SummaryData
+		wantErr bool
+	}{
+		{name: "ok", sd: SummaryData{Accuracy: 0.01, Positive: map[int]uint64{10: 2}, Zero: 1, Sum: 2, Count: 3, Max: 1.1}},
+		{name: "empty", sd: SummaryData{Accuracy: 0.01}},
+		{name: "accuracy", sd: SummaryData{Accuracy: 1}, wantErr: true},
+		{name: "small accuracy", sd: SummaryData{Accuracy: 1e-9}, wantErr: true},
+		{name: "count mismatch", sd: SummaryData{Accuracy: 0.01, Negative: map[int]uint64{1: 1}, Count: 2}, wantErr: true},
+		{name: "min greater than max", sd: SummaryData{Accuracy: 0.01, Zero: 1, Count: 1, Min: 1}, wantErr: true},
+		{name: "infinite sum", sd: SummaryData{Accuracy: 0.01, Zero: 1, Count: 1, Sum: math.Inf(1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sd.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSummary)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
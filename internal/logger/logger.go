@@ -27,6 +27,11 @@ func Initilization(level string) error {
 	return nil
 }
 
+// Log возвращает логгер сервиса.
+func Log() *zap.Logger {
+	return log
+}
+
 // RequestLogger middleware для логикровния запросов
 func RequestLogger(h http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,206 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/logger"
+	"go.uber.org/zap"
+)
+
+// State состояние правила.
+type State string
+
+const (
+	StateInactive State = "inactive"
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert текущее состояние правила.
+type Alert struct {
+	Name       string            `json:"name"`
+	Expr       string            `json:"expr"`
+	Metric     string            `json:"metric"`
+	MType      string            `json:"type,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	State      State             `json:"state"`
+	Value      *float64          `json:"value,omitempty"`
+	ActiveAt   *time.Time        `json:"active_at,omitempty"`
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// Notifier получает правила, перешедшие в состояние firing или resolved.
+type Notifier interface {
+	Notify(Alert)
+}
+
+// Engine периодически вычисляет правила по значениям из хранилища.
+type Engine struct {
+	mu       sync.RWMutex
+	storage  entities.ManagerJSON
+	rules    []Rule
+	alerts   []Alert
+	interval time.Duration
+	notifier Notifier
+}
+
+// NewEngine конструктор движка правил, notifier может быть nil.
+func NewEngine(storage entities.ManagerJSON, rules []Rule, interval time.Duration, notifier Notifier) *Engine {
+	alerts := make([]Alert, len(rules))
+	for i, rule := range rules {
+		alerts[i] = Alert{
+			Name:   rule.Name,
+			Expr:   rule.Expr,
+			Metric: rule.Metric,
+			MType:  rule.MType,
+			Labels: rule.Labels,
+			State:  StateInactive,
+		}
+	}
+
+	return &Engine{
+		storage:  storage,
+		rules:    rules,
+		alerts:   alerts,
+		interval: interval,
+		notifier: notifier,
+	}
+}
+
+// Run запускает вычисление правил с заданным интервалом до отмены контекста.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			e.Evaluate(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate вычисляет все правила на момент времени now.
+func (e *Engine) Evaluate(now time.Time) {
+	metrics := e.storage.AllMetricsJSON()
+
+	e.mu.Lock()
+	changed := make([]Alert, 0)
+	for i := range e.rules {
+		if e.evaluateRule(&e.rules[i], &e.alerts[i], metrics, now) {
+			changed = append(changed, e.alerts[i])
+		}
+	}
+	e.mu.Unlock()
+
+	// Уведомления отправляются без блокировки: notifier может сохранять очередь на диск.
+	for _, alert := range changed {
+		e.notify(alert)
+	}
+}
+
+// evaluateRule обновляет состояние правила и сообщает, перешло ли оно в firing или resolved.
+func (e *Engine) evaluateRule(rule *Rule, alert *Alert, metrics []entities.MetricsJSON, now time.Time) bool {
+	value, mType, ok := rule.value(metrics)
+	alert.MType = mType
+	if ok {
+		alert.Value = &value
+	} else {
+		alert.Value = nil
+	}
+
+	if ok && rule.check(value) {
+		switch alert.State {
+		case StateInactive, StateResolved:
+			alert.ActiveAt = &now
+			alert.FiredAt = nil
+			alert.ResolvedAt = nil
+			alert.State = StatePending
+			if rule.For == 0 {
+				fire(alert, now)
+				return true
+			}
+		case StatePending:
+			if now.Sub(*alert.ActiveAt) >= rule.For {
+				fire(alert, now)
+				return true
+			}
+		}
+		return false
+	}
+
+	switch alert.State {
+	case StatePending:
+		alert.ActiveAt = nil
+		alert.State = StateInactive
+	case StateFiring:
+		alert.ResolvedAt = &now
+		alert.State = StateResolved
+		logger.Log().Info("alert resolved",
+			zap.String("rule", alert.Name),
+			zap.String("metric", alert.Metric),
+		)
+		return true
+	}
+	return false
+}
+
+func fire(alert *Alert, now time.Time) {
+	alert.FiredAt = &now
+	alert.State = StateFiring
+	logger.Log().Warn("alert firing",
+		zap.String("rule", alert.Name),
+		zap.String("expr", alert.Expr),
+		zap.Float64("value", *alert.Value),
+	)
+}
+
+func (e *Engine) notify(alert Alert) {
+	if e.notifier != nil {
+		e.notifier.Notify(alert)
+	}
+}
+
+// Alerts возвращает копию состояний всех правил.
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]Alert, len(e.alerts))
+	copy(out, e.alerts)
+	return out
+}
+
+// AlertsHandle отдает состояния правил в формате JSON, параметр state фильтрует по состоянию.
+func (e *Engine) AlertsHandle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	state := State(r.URL.Query().Get("state"))
+	alerts := make([]Alert, 0)
+	for _, alert := range e.Alerts() {
+		if state == "" || alert.State == state {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	out, err := json.Marshal(alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
@@ -0,0 +1,186 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+		metric  string
+		op      string
+		value   float64
+		dur     time.Duration
+	}{
+		{name: "with for", expr: "HeapAlloc > 5e8 for 2m", metric: "HeapAlloc", op: ">", value: 5e8, dur: 2 * time.Minute},
+		{name: "without for", expr: "PollCount >= 10", metric: "PollCount", op: ">=", value: 10},
+		{name: "bad operator", expr: "HeapAlloc => 1", wantErr: true},
+		{name: "bad threshold", expr: "HeapAlloc > x", wantErr: true},
+		{name: "bad for", expr: "HeapAlloc > 1 during 2m", wantErr: true},
+		{name: "bad duration", expr: "HeapAlloc > 1 for two", wantErr: true},
+		{name: "short", expr: "HeapAlloc >", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Name: tt.name, Expr: tt.expr}
+			err := rule.ParseExpr()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidExpr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.metric, rule.Metric)
+			assert.Equal(t, tt.op, rule.Op)
+			assert.Equal(t, tt.value, rule.Threshold)
+			assert.Equal(t, tt.dur, rule.For)
+		})
+	}
+}
+
+func TestEngineStates(t *testing.T) {
+	s := storage.NewMemStore()
+	rule := Rule{Name: "heap", Expr: "HeapAlloc > 100 for 2m"}
+	require.NoError(t, rule.ParseExpr())
+	engine := NewEngine(s, []Rule{rule}, time.Second, nil)
+
+	start := time.Now()
+	steps := []struct {
+		name  string
+		value float64
+		at    time.Duration
+		want  State
+	}{
+		{name: "below threshold", value: 50, at: 0, want: StateInactive},
+		{name: "above threshold", value: 150, at: time.Minute, want: StatePending},
+		{name: "still pending", value: 150, at: 2 * time.Minute, want: StatePending},
+		{name: "firing after for", value: 150, at: 3 * time.Minute, want: StateFiring},
+		{name: "resolved", value: 10, at: 4 * time.Minute, want: StateResolved},
+		{name: "pending again", value: 200, at: 5 * time.Minute, want: StatePending},
+		{name: "back to inactive", value: 10, at: 6 * time.Minute, want: StateInactive},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			s.SetGauge("HeapAlloc", step.value)
+			engine.Evaluate(start.Add(step.at))
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, step.want, alerts[0].State)
+		})
+	}
+}
+
+func TestEngineMissingMetric(t *testing.T) {
+	rule := Rule{Name: "polls", Expr: "PollCount > 0", MType: "counter"}
+	require.NoError(t, rule.ParseExpr())
+	s := storage.NewMemStore()
+	engine := NewEngine(s, []Rule{rule}, time.Second, nil)
+
+	engine.Evaluate(time.Now())
+	assert.Equal(t, StateInactive, engine.Alerts()[0].State)
+
+	s.SetCounter("PollCount", 1)
+	engine.Evaluate(time.Now())
+	assert.Equal(t, StateFiring, engine.Alerts()[0].State)
+}
+
+// engineNotifier уведомления, при получении которых читается состояние движка.
+type engineNotifier struct {
+	engine *Engine
+	states []State
+}
+
+func (n *engineNotifier) Notify(alert Alert) {
+	n.states = append(n.states, n.engine.Alerts()[0].State)
+}
+
+func TestEngineNotifyWithoutLock(t *testing.T) {
+	rule := Rule{Name: "heap", Expr: "HeapAlloc > 100"}
+	require.NoError(t, rule.ParseExpr())
+	s := storage.NewMemStore()
+	notifier := &engineNotifier{}
+	notifier.engine = NewEngine(s, []Rule{rule}, time.Second, notifier)
+
+	s.SetGauge("HeapAlloc", 150)
+	notifier.engine.Evaluate(time.Now())
+	s.SetGauge("HeapAlloc", 50)
+	notifier.engine.Evaluate(time.Now())
+	notifier.engine.Evaluate(time.Now())
+
+	assert.Equal(t, []State{StateFiring, StateResolved}, notifier.states)
+}
+
+func TestEngineLabels(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetGauge(`HeapAlloc{host="a"}`, 50)
+	s.SetGauge(`HeapAlloc{host="b"}`, 150)
+	s.SetCounter(`requests{host="a"}`, 3)
+	s.SetCounter(`requests{host="b"}`, 4)
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		state State
+		value float64
+	}{
+		{name: "max over series", rule: Rule{Expr: "HeapAlloc > 100"}, state: StateFiring, value: 150},
+		{name: "label matcher", rule: Rule{Expr: "HeapAlloc > 100", Labels: map[string]string{"host": "a"}}, state: StateInactive, value: 50},
+		{name: "min", rule: Rule{Expr: "HeapAlloc < 60", Aggregate: "min"}, state: StateFiring, value: 50},
+		{name: "counter sum", rule: Rule{Expr: "requests > 5", MType: "counter"}, state: StateFiring, value: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name = tt.name
+			require.NoError(t, tt.rule.ParseExpr())
+			engine := NewEngine(s, []Rule{tt.rule}, time.Second, nil)
+			engine.Evaluate(time.Now())
+
+			alert := engine.Alerts()[0]
+			assert.Equal(t, tt.state, alert.State)
+			require.NotNil(t, alert.Value)
+			assert.Equal(t, tt.value, *alert.Value)
+		})
+	}
+
+	rule := Rule{Name: "bad", Expr: "HeapAlloc > 1", Aggregate: "avg"}
+	assert.ErrorIs(t, rule.ParseExpr(), ErrInvalidExpr)
+}
+
+func TestAlertsHandle(t *testing.T) {
+	first := Rule{Name: "first", Expr: "A > 1"}
+	second := Rule{Name: "second", Expr: "B > 1"}
+	require.NoError(t, first.ParseExpr())
+	require.NoError(t, second.ParseExpr())
+
+	s := storage.NewMemStore()
+	s.SetGauge("A", 2)
+	s.SetGauge("B", 0)
+	engine := NewEngine(s, []Rule{first, second}, time.Second, nil)
+	engine.Evaluate(time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/alerts?state=firing", nil)
+	rec := httptest.NewRecorder()
+	engine.AlertsHandle(rec, req)
+
+	resp := rec.Result()
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var alerts []Alert
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "first", alerts[0].Name)
+	assert.Equal(t, 2., *alerts[0].Value)
+}
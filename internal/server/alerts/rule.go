@@ -0,0 +1,169 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+var ErrInvalidExpr = errors.New("invalid alert expression")
+
+// Rule описание правила из файла правил.
+// Правило вычисляется по всем сериям метрики с метками, содержащими Labels: значения
+// объединяются функцией Aggregate, по умолчанию max для gauge и sum для counter.
+type Rule struct {
+	Name      string            `json:"name"`
+	Expr      string            `json:"expr"`
+	MType     string            `json:"type,omitempty"` // gauge, counter или пусто - ищется сначала gauge, затем counter
+	Labels    map[string]string `json:"labels,omitempty"`
+	Aggregate string            `json:"aggregate,omitempty"` // min, max, sum или пусто
+
+	Metric    string        `json:"-"`
+	Op        string        `json:"-"`
+	Threshold float64       `json:"-"`
+	For       time.Duration `json:"-"`
+}
+
+var aggregates = map[string]func(a, b float64) float64{
+	"min": math.Min,
+	"max": math.Max,
+	"sum": func(a, b float64) float64 { return a + b },
+}
+
+var operators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// ParseExpr разбирает выражение вида `HeapAlloc > 5e8 for 2m` и заполняет поля правила.
+func (r *Rule) ParseExpr() error {
+	fields := strings.Fields(r.Expr)
+	if len(fields) != 3 && len(fields) != 5 {
+		return fmt.Errorf("%w: %q", ErrInvalidExpr, r.Expr)
+	}
+
+	if _, ok := operators[fields[1]]; !ok {
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidExpr, fields[1])
+	}
+
+	threshold, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return fmt.Errorf("%w: threshold %q", ErrInvalidExpr, fields[2])
+	}
+
+	var duration time.Duration
+	if len(fields) == 5 {
+		if fields[3] != "for" {
+			return fmt.Errorf("%w: expected 'for', got %q", ErrInvalidExpr, fields[3])
+		}
+		duration, err = time.ParseDuration(fields[4])
+		if err != nil || duration < 0 {
+			return fmt.Errorf("%w: duration %q", ErrInvalidExpr, fields[4])
+		}
+	}
+
+	switch r.MType {
+	case "", entities.Gauge, entities.Counter:
+	default:
+		return fmt.Errorf("%w: unknown metric type %q", ErrInvalidExpr, r.MType)
+	}
+
+	if _, ok := aggregates[r.Aggregate]; !ok && r.Aggregate != "" {
+		return fmt.Errorf("%w: unknown aggregate %q", ErrInvalidExpr, r.Aggregate)
+	}
+	if err := entities.ValidateLabels(r.Labels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidExpr, err)
+	}
+
+	r.Metric = fields[0]
+	r.Op = fields[1]
+	r.Threshold = threshold
+	r.For = duration
+	return nil
+}
+
+// check проверяет выполнение условия правила для значения.
+func (r *Rule) check(value float64) bool {
+	return operators[r.Op](value, r.Threshold)
+}
+
+// value возвращает текущее значение и тип метрики правила по метрикам из хранилища.
+func (r *Rule) value(metrics []entities.MetricsJSON) (float64, string, bool) {
+	mTypes := []string{r.MType}
+	if r.MType == "" {
+		mTypes = []string{entities.Gauge, entities.Counter}
+	}
+
+	for _, mType := range mTypes {
+		series := entities.FilterMetrics(metrics, mType, r.Metric, r.Labels)
+		if len(series) == 0 {
+			continue
+		}
+
+		aggregate := r.Aggregate
+		if aggregate == "" {
+			aggregate = "max"
+			if mType == entities.Counter {
+				aggregate = "sum"
+			}
+		}
+
+		var value float64
+		for i, m := range series {
+			v := float64(0)
+			switch {
+			case m.Value != nil:
+				v = *m.Value
+			case m.Delta != nil:
+				v = float64(*m.Delta)
+			}
+			if i == 0 {
+				value = v
+				continue
+			}
+			value = aggregates[aggregate](value, v)
+		}
+		return value, mType, true
+	}
+	return 0, r.MType, false
+}
+
+// LoadRules читает правила из JSON файла.
+func LoadRules(filename string) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(rules))
+	for i := range rules {
+		if rules[i].Name == "" {
+			return nil, fmt.Errorf("rule #%d: empty name", i)
+		}
+		if _, ok := names[rules[i].Name]; ok {
+			return nil, fmt.Errorf("rule %s: duplicate name", rules[i].Name)
+		}
+		names[rules[i].Name] = struct{}{}
+
+		if err := rules[i].ParseExpr(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rules[i].Name, err)
+		}
+	}
+	return rules, nil
+}
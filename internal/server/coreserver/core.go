@@ -6,21 +6,25 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
 
 	"github.com/echo9et/alerting/internal/compgzip"
 	"github.com/echo9et/alerting/internal/entities"
 	"github.com/echo9et/alerting/internal/hashing"
 	"github.com/echo9et/alerting/internal/logger"
+	"github.com/echo9et/alerting/internal/server/alerts"
+	"github.com/echo9et/alerting/internal/server/graphite"
 	"github.com/echo9et/alerting/internal/server/handlers"
+	"github.com/echo9et/alerting/internal/server/lifecycle"
+	"github.com/echo9et/alerting/internal/server/statsd"
 	pb "github.com/echo9et/alerting/proto"
 	"github.com/go-chi/chi/v5"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc/encoding/gzip"
 )
@@ -57,6 +61,13 @@ func applyTrustSubnet(h http.HandlerFunc, subnet *net.IPNet) http.HandlerFunc {
 	return h
 }
 
+func applyRemoteSubnet(h http.HandlerFunc, subnet *net.IPNet) http.HandlerFunc {
+	if subnet != nil {
+		return RemoteSubnetMiddleware(h, subnet)
+	}
+	return h
+}
+
 // Добавляет к обработчику протоколирование и сжатие в формате gzip.
 // Если указан секретный ключ, оно также добавляет промежуточное программное обеспечение для хэширования.
 func middleware(h http.HandlerFunc, secretKey string, privateKey *rsa.PrivateKey, trustedSubnet *net.IPNet) http.HandlerFunc {
@@ -69,6 +80,17 @@ func middleware(h http.HandlerFunc, secretKey string, privateKey *rsa.PrivateKey
 	return h
 }
 
+// Добавляет к обработчикам приема данных от сторонних систем проверку подсети, протоколирование и хэширование.
+// Шифрование и gzip не применяются: такие клиенты используют собственные форматы сжатия.
+// Prometheus и Telegraf не передают X-Real-IP, поэтому подсеть проверяется по адресу соединения.
+func ingestMiddleware(h http.HandlerFunc, secretKey string, allow *net.IPNet) http.HandlerFunc {
+	h = applyRemoteSubnet(h, allow)
+	h = applyRequestLogger(h)
+	h = applyHashMiddleware(h, secretKey)
+
+	return h
+}
+
 // Добавляет к обработчику протоколирование и сжатие в формате gzip.
 func HashMiddleware(h http.HandlerFunc, secretKey string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -96,7 +118,9 @@ func HashMiddleware(h http.HandlerFunc, secretKey string) http.HandlerFunc {
 }
 
 // Возвращает маршрутизатор сервера.
-func GetRouter(addrDatabase string, storage entities.Storage, secretKey string, privateKey *rsa.PrivateKey, trustedSubnet *net.IPNet) *chi.Mux {
+// metricsAllow ограничивает адреса сборщиков /metrics, ingestAllow - адреса клиентов remote-write
+// и line protocol, без них используется trustedSubnet.
+func GetRouter(addrDatabase string, storage entities.Storage, secretKey string, privateKey *rsa.PrivateKey, trustedSubnet, metricsAllow, ingestAllow *net.IPNet, engine *alerts.Engine) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Get("/", middleware(func(w http.ResponseWriter, r *http.Request) {
@@ -111,7 +135,7 @@ func GetRouter(addrDatabase string, storage entities.Storage, secretKey string,
 		WriteMetricsJSONHandle(w, r, storage)
 	}, secretKey, privateKey, trustedSubnet))
 
-	router.Post("/update/{type}/{n, privateKey)ame}/{value}", middleware(func(w http.ResponseWriter, r *http.Request) {
+	router.Post("/update/{type}/{name}/{value}", middleware(func(w http.ResponseWriter, r *http.Request) {
 		setMetricHandle(w, r, storage)
 	}, secretKey, privateKey, trustedSubnet))
 
@@ -123,55 +147,136 @@ func GetRouter(addrDatabase string, storage entities.Storage, secretKey string,
 		metricHandle(w, r, storage)
 	}, secretKey, privateKey, trustedSubnet))
 
+	router.Get("/range/{type}/{name}", middleware(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ReadRange(w, r, storage)
+	}, secretKey, privateKey, trustedSubnet))
+
+	if ingestAllow == nil {
+		ingestAllow = trustedSubnet
+	}
+	router.Post("/api/v1/write", ingestMiddleware(handlers.NewRemoteWrite(storage).ServeHTTP, secretKey, ingestAllow))
+
+	router.Post("/write", applyGzipMiddleware(ingestMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteInflux(w, r, storage)
+	}, secretKey, ingestAllow)))
+
+	// Prometheus не передает X-Real-IP и не шифрует запросы, поэтому подсеть проверяется
+	// по адресу соединения, остальное - только протоколирование и сжатие.
+	if metricsAllow == nil {
+		metricsAllow = trustedSubnet
+	}
+	router.Get("/metrics", applyGzipMiddleware(applyRequestLogger(applyRemoteSubnet(func(w http.ResponseWriter, r *http.Request) {
+		handlers.WritePrometheus(w, r, storage)
+	}, metricsAllow))))
+
 	router.Get("/ping", middleware(func(w http.ResponseWriter, r *http.Request) {
 		PingDatabase(w, r, addrDatabase, storage)
 	}, secretKey, privateKey, trustedSubnet))
+
+	if engine != nil {
+		router.Get("/alerts", middleware(engine.AlertsHandle, secretKey, privateKey, trustedSubnet))
+	}
 	return router
 }
 
 // Запуск сервера.
-func Run(addr, addrDatabase string, storage entities.Storage, secretKey string, privateKey *rsa.PrivateKey, trustedSubnet *net.IPNet) error {
-	var server = http.Server{Addr: addr, Handler: GetRouter(addrDatabase, storage, secretKey, privateKey, trustedSubnet)}
-	idleConnsClosed := make(chan struct{})
-	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, os.Interrupt)
+// Серверы и фоновые задачи регистрируются в manager и работают до сигнала завершения,
+// после чего manager останавливает их вместе с остальными компонентами.
+func Run(manager *lifecycle.Manager, addr, addrDatabase string, storage entities.Storage, secretKey string, privateKey *rsa.PrivateKey, trustedSubnet, metricsAllow, ingestAllow *net.IPNet, engine *alerts.Engine, statsdListener *statsd.Listener, graphiteListener *graphite.Listener) error {
+	var server = http.Server{Addr: addr, Handler: GetRouter(addrDatabase, storage, secretKey, privateKey, trustedSubnet, metricsAllow, ingestAllow, engine)}
 
-	go func() {
-		<-sigint
-		if err := server.Shutdown(context.Background()); err != nil {
-			slog.Error(fmt.Sprintf("HTTP server Shutdown: %v", err))
-		}
-		close(idleConnsClosed)
-	}()
+	if engine != nil {
+		manager.Go("alerts", engine.Run)
+	}
 
-	go func() {
-		listen, err := net.Listen("tcp", ":3200")
-		if err != nil {
-			slog.Error(fmt.Sprintf("listent grps: %s", err))
-			return
-		}
+	if statsdListener != nil {
+		manager.Go("statsd", func(ctx context.Context) {
+			if err := statsdListener.ListenAndServe(ctx); err != nil {
+				slog.Error(fmt.Sprintf("listen statsd: %s", err))
+			}
+		})
+	}
+
+	if graphiteListener != nil {
+		manager.Go("graphite", func(ctx context.Context) {
+			if err := graphiteListener.ListenAndServe(ctx); err != nil {
+				slog.Error(fmt.Sprintf("listen graphite: %s", err))
+			}
+		})
+	}
+
+	if listen, err := net.Listen("tcp", ":3200"); err != nil {
+		slog.Error(fmt.Sprintf("listent grps: %s", err))
+	} else {
 		s := grpc.NewServer()
 		serverGrpc := ServerGrpc{
 			CryptoKey: privateKey,
 			Storage:   storage,
 		}
 		pb.RegisterMetricsServer(s, &serverGrpc)
+		colmetricspb.RegisterMetricsServiceServer(s, NewServerOTLP(storage))
+
+		go func() {
+			slog.Info("Сервер gRPC начал работу")
+			if err := s.Serve(listen); err != nil {
+				slog.Error(fmt.Sprintf("listent grps: %s", err))
+			}
+		}()
+		manager.OnStop("grpc", func(ctx context.Context) error {
+			return stopGrpc(ctx, s)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		slog.Info("Сервер gRPC начал работу")
-		if err := s.Serve(listen); err != nil {
-			slog.Error(fmt.Sprintf("listent grps: %s", err))
+	errServe := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			slog.Error(fmt.Sprintf("server ListenAndServe:%v", err))
+			errServe <- err
+			cancel()
 		}
 	}()
+	manager.OnStop("http", func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+			return err
+		}
+		return nil
+	})
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		slog.Error(fmt.Sprintf("server ListenAndServe:%v", err))
-		return err
+	err := manager.Wait(ctx)
+	select {
+	case errListen := <-errServe:
+		return errListen
+	default:
 	}
 	slog.Info("Server Shutdown")
-	return nil
+	return err
+}
+
+// stopGrpc дожидается завершения обрабатываемых вызовов, по истечении ctx прерывает их.
+func stopGrpc(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
 }
 
 // Возвращает значения метрик по типу и имени.
+// Параметры запроса задают метки: точное совпадение ключа серии возвращает ее значение,
+// иначе значения подходящих серий суммируются, с group_by - по группам значений меток.
+// Для summary параметр q задает квантиль, серии перед расчетом объединяются.
 func metricHandle(w http.ResponseWriter, r *http.Request, s entities.Storage) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -179,25 +284,63 @@ func metricHandle(w http.ResponseWriter, r *http.Request, s entities.Storage) {
 	}
 	t := chi.URLParam(r, "type")
 	name := chi.URLParam(r, "name")
-	var value string
-	status := false
 
-	switch t {
-	case handlers.Gauge:
-		value, status = s.GetGauge(name)
-	case handlers.Counter:
-		value, status = s.GetCounter(name)
+	var reserved []string
+	value := entities.MetricsJSON.FormatValue
+	if t == handlers.Summary {
+		reserved = append(reserved, handlers.ParamQuantile)
+		if v := r.URL.Query().Get(handlers.ParamQuantile); v != "" {
+			q, err := handlers.ParseQuantile(v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			value = func(m entities.MetricsJSON) string { return handlers.QuantileValue(m, q) }
+		}
+	}
+	labels, groupBy, err := handlers.LabelsFromQuery(r.URL.Query(), reserved...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if status {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(fmt.Sprintln(value)))
-	} else {
+	if len(groupBy) == 0 {
+		metric, err := s.Metric(r.Context(), t, entities.SeriesKey(name, labels))
+		if err == nil {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(fmt.Sprintln(value(metric))))
+			return
+		}
+		if !errors.Is(err, entities.ErrNotFound) {
+			http.Error(w, err.Error(), handlers.StatusCode(err))
+			return
+		}
+	}
+
+	all, err := s.Metrics(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), handlers.StatusCode(err))
+		return
+	}
+	metrics := entities.FilterMetrics(all, t, name, labels)
+	if len(metrics) == 0 {
 		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	metrics = entities.GroupMetrics(metrics, groupBy)
+	w.WriteHeader(http.StatusOK)
+	if len(groupBy) == 0 {
+		w.Write([]byte(fmt.Sprintln(value(metrics[0]))))
+		return
+	}
+	for _, m := range metrics {
+		fmt.Fprintln(w, m.Key(), value(m))
 	}
 }
 
 // Возвращает все метрики.
+// Параметры запроса фильтруют серии по меткам, group_by суммирует значения по группам меток.
 func metricsHandle(w http.ResponseWriter, r *http.Request, s entities.Storage) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -208,9 +351,32 @@ func metricsHandle(w http.ResponseWriter, r *http.Request, s entities.Storage) {
 		w.Header().Set("Content-Type", "text/html")
 	}
 
-	metrics := s.AllMetrics()
-	for k, v := range metrics {
-		w.Write([]byte(fmt.Sprintln(k, v)))
+	metrics, err := s.Metrics(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), handlers.StatusCode(err))
+		return
+	}
+
+	if len(r.URL.Query()) > 0 {
+		labels, groupBy, err := handlers.LabelsFromQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics := entities.FilterMetrics(metrics, "", "", labels)
+		if len(groupBy) > 0 {
+			metrics = entities.GroupMetrics(metrics, groupBy)
+		} else {
+			entities.SortMetrics(metrics)
+		}
+		w.WriteHeader(http.StatusOK)
+		handlers.WriteSeries(w, metrics)
+		return
+	}
+
+	for _, m := range metrics {
+		w.Write([]byte(fmt.Sprintln(m.Key(), m.FormatValue())))
 	}
 	w.WriteHeader(http.StatusOK)
 }
@@ -284,8 +450,9 @@ func ReadMetricJSONHandle(w http.ResponseWriter, r *http.Request, s entities.Sto
 
 // Проверяет доступность хранилища.
 func PingDatabase(w http.ResponseWriter, r *http.Request, addr string, s entities.Storage) {
-	if !s.Ping() {
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := s.Check(r.Context()); err != nil {
+		slog.Error(fmt.Sprintf("ping storage: %s", err))
+		w.WriteHeader(handlers.StatusCode(err))
 		w.Header().Set("Content-Type", "text/plain")
 		out := []byte(" ")
 		w.Write(out)
@@ -332,3 +499,16 @@ func TrustedSubnetMiddleware(h http.HandlerFunc, subnet *net.IPNet) http.Handler
 		h.ServeHTTP(w, r)
 	})
 }
+
+// RemoteSubnetMiddleware пропускает запросы, адрес соединения которых входит в subnet.
+// Используется для клиентов, которые не передают X-Real-IP, например сборщиков метрик.
+func RemoteSubnetMiddleware(h http.HandlerFunc, subnet *net.IPNet) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !subnet.Contains(net.ParseIP(host)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
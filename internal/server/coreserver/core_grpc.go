@@ -7,29 +7,105 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"strings"
 
 	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/handlers"
 	pb "github.com/echo9et/alerting/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ServerGrpc struct {
 	MetricsSever
 	CryptoKey *rsa.PrivateKey
-	Storage   entities.ManagerValues
+	Storage   entities.Storage
 }
 
-// addMetric добавление метрики в хранилище
-func (s *ServerGrpc) addMetric(m *pb.Metric) {
+// addMetric добавление метрики в хранилище в контексте запроса ctx
+func (s *ServerGrpc) addMetric(ctx context.Context, m *pb.Metric) error {
+	if err := entities.ValidateMetricID(m.Id); err != nil {
+		return err
+	}
+	if err := entities.ValidateLabels(m.Labels); err != nil {
+		return err
+	}
+
 	switch m.Type {
 	case pb.Metric_GAUGE:
-		s.Storage.SetGauge(m.Id, m.Value)
+		return s.Storage.UpdateGauge(ctx, entities.SeriesKey(m.Id, m.Labels), m.Value)
 	case pb.Metric_GOUNTER:
-		s.Storage.SetCounter(m.Id, m.Delta)
-	default:
-		slog.Warn("Unkonow type metric")
+		if m.Total == nil {
+			return s.Storage.UpdateCounter(ctx, entities.SeriesKey(m.Id, m.Labels), m.Delta)
+		}
+		return s.Storage.UpdateMetrics(ctx, []entities.MetricsJSON{{
+			ID:     m.Id,
+			MType:  entities.Counter,
+			Labels: m.Labels,
+			Delta:  &m.Delta,
+			Total:  m.Total,
+		}})
+	case pb.Metric_HISTOGRAM:
+		return s.Storage.UpdateMetrics(ctx, []entities.MetricsJSON{{
+			ID:        m.Id,
+			MType:     entities.Histogram,
+			Labels:    m.Labels,
+			Histogram: HistogramFromPB(m.Histogram),
+		}})
+	case pb.Metric_SUMMARY:
+		return s.Storage.UpdateMetrics(ctx, []entities.MetricsJSON{{
+			ID:      m.Id,
+			MType:   entities.Summary,
+			Labels:  m.Labels,
+			Summary: SummaryFromPB(m.Summary),
+		}})
+	case pb.Metric_SET:
+		return s.Storage.UpdateMetrics(ctx, []entities.MetricsJSON{{
+			ID:      m.Id,
+			MType:   entities.Set,
+			Labels:  m.Labels,
+			Set:     SetFromPB(m.Set),
+			Members: m.Members,
+		}})
+	}
+	return fmt.Errorf("%w %d", entities.ErrUnknownType, m.Type)
+}
+
+// addMetrics добавляет метрики по одной. Отклоненные метрики не прерывают запись остальных,
+// их ошибки возвращаются строкой для поля error ответа. Недоступность хранилища прерывает запись.
+func (s *ServerGrpc) addMetrics(ctx context.Context, metrics []*pb.Metric) (string, error) {
+	var rejected []string
+	for _, metric := range metrics {
+		err := s.addMetric(ctx, metric)
+		if errors.Is(err, entities.ErrUnavailable) {
+			return "", grpcError(err)
+		}
+		if err != nil {
+			slog.Warn(fmt.Sprintf("addMetric: %s", err))
+			rejected = append(rejected, fmt.Sprintf("%s: %s", metric.Id, err))
+		}
+	}
+	return strings.Join(rejected, "; "), nil
+}
+
+// grpcError преобразует ошибку хранилища в ошибку gRPC с соответствующим кодом.
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, entities.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, entities.ErrTypeMismatch):
+		code = codes.FailedPrecondition
+	case errors.Is(err, entities.ErrUnavailable):
+		code = codes.Unavailable
+	case handlers.IsInvalidMetric(err):
+		code = codes.InvalidArgument
 	}
+	return status.Error(code, err.Error())
 }
 
 // Decryptor данных.
@@ -51,7 +127,9 @@ type MetricsSever struct {
 // UpdateMetric реализует интерфейс добавления одной метрики.
 func (s *ServerGrpc) UpdateMetric(ctx context.Context, in *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
 	var response pb.UpdateMetricResponse
-	s.addMetric(in.Metric)
+	if err := s.addMetric(ctx, in.Metric); err != nil {
+		return nil, grpcError(err)
+	}
 	return &response, nil
 }
 
@@ -59,9 +137,11 @@ func (s *ServerGrpc) UpdateMetric(ctx context.Context, in *pb.UpdateMetricReques
 func (s *ServerGrpc) UpdateMetrics(ctx context.Context, in *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
 	var response pb.UpdateMetricsResponse
 
-	for _, metric := range in.Metrics {
-		s.addMetric(metric)
+	rejected, err := s.addMetrics(ctx, in.Metrics)
+	if err != nil {
+		return nil, err
 	}
+	response.Error = rejected
 	return &response, nil
 }
 
@@ -84,9 +164,126 @@ func (s *ServerGrpc) UpdateEncrypteMetrics(ctx context.Context, in *pb.UpdateEnc
 		return &response, err
 	}
 
-	for _, metric := range metrics {
-		s.addMetric(metric)
+	rejected, err := s.addMetrics(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	response.Error = rejected
+	return &response, nil
+}
+
+// GetMetrics возвращает метрики с именем id (все при пустом id), отфильтрованные по меткам
+// и, если задан group_by, просуммированные по группам значений меток.
+func (s *ServerGrpc) GetMetrics(ctx context.Context, in *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
+	var response pb.GetMetricsResponse
+	if err := entities.ValidateLabels(in.Labels); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	all, err := s.Storage.Metrics(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	metrics := entities.FilterMetrics(all, "", in.Id, in.Labels)
+	if len(in.GroupBy) > 0 {
+		metrics = entities.GroupMetrics(metrics, in.GroupBy)
+	} else {
+		entities.SortMetrics(metrics)
+	}
+
+	for _, m := range metrics {
+		metric := &pb.Metric{Id: m.ID, Labels: m.Labels}
+		switch {
+		case m.MType == entities.Gauge && m.Value != nil:
+			metric.Type, metric.Value = pb.Metric_GAUGE, *m.Value
+		case m.MType == entities.Counter && m.Delta != nil:
+			metric.Type, metric.Delta = pb.Metric_GOUNTER, *m.Delta
+		case m.MType == entities.Histogram && m.Histogram != nil:
+			metric.Type, metric.Histogram = pb.Metric_HISTOGRAM, HistogramToPB(m.Histogram)
+		case m.MType == entities.Summary && m.Summary != nil:
+			metric.Type, metric.Summary = pb.Metric_SUMMARY, SummaryToPB(m.Summary)
+		case m.MType == entities.Set && m.Set != nil:
+			metric.Type, metric.Set = pb.Metric_SET, SetToPB(m.Set)
+			metric.Delta = int64(m.Set.Cardinality())
+		default:
+			continue
+		}
+		response.Metrics = append(response.Metrics, metric)
+	}
 	return &response, nil
 }
+
+// HistogramFromPB преобразует гистограмму из protobuf, nil остается nil.
+func HistogramFromPB(h *pb.Histogram) *entities.HistogramData {
+	if h == nil {
+		return nil
+	}
+	return &entities.HistogramData{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+}
+
+// HistogramToPB преобразует гистограмму в protobuf.
+func HistogramToPB(h *entities.HistogramData) *pb.Histogram {
+	return &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+}
+
+// SummaryFromPB преобразует summary из protobuf, nil остается nil.
+func SummaryFromPB(sd *pb.Summary) *entities.SummaryData {
+	if sd == nil {
+		return nil
+	}
+	out := &entities.SummaryData{
+		Accuracy: sd.Accuracy,
+		Positive: make(map[int]uint64, len(sd.Positive)),
+		Negative: make(map[int]uint64, len(sd.Negative)),
+		Zero:     sd.Zero,
+		Sum:      sd.Sum,
+		Count:    sd.Count,
+		Min:      sd.Min,
+		Max:      sd.Max,
+	}
+	for i, c := range sd.Positive {
+		out.Positive[int(i)] = c
+	}
+	for i, c := range sd.Negative {
+		out.Negative[int(i)] = c
+	}
+	return out
+}
+
+// SummaryToPB преобразует summary в protobuf.
+func SummaryToPB(sd *entities.SummaryData) *pb.Summary {
+	out := &pb.Summary{
+		Accuracy: sd.Accuracy,
+		Positive: make(map[int32]uint64, len(sd.Positive)),
+		Negative: make(map[int32]uint64, len(sd.Negative)),
+		Zero:     sd.Zero,
+		Sum:      sd.Sum,
+		Count:    sd.Count,
+		Min:      sd.Min,
+		Max:      sd.Max,
+	}
+	for i, c := range sd.Positive {
+		out.Positive[int32(i)] = c
+	}
+	for i, c := range sd.Negative {
+		out.Negative[int32(i)] = c
+	}
+	return out
+}
+
+// SetFromPB преобразует скетч set из protobuf, nil остается nil.
+func SetFromPB(set *pb.Set) *entities.SetData {
+	if set == nil {
+		return nil
+	}
+	// Недопустимая точность отклоняется при проверке скетча.
+	if set.Precision > math.MaxUint8 {
+		return &entities.SetData{Precision: math.MaxUint8, Registers: set.Registers}
+	}
+	return &entities.SetData{Precision: uint8(set.Precision), Registers: set.Registers}
+}
+
+// SetToPB преобразует скетч set в protobuf.
+func SetToPB(set *entities.SetData) *pb.Set {
+	return &pb.Set{Precision: uint32(set.Precision), Registers: set.Registers}
+}
@@ -0,0 +1,186 @@
+package coreserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/storage"
+	pb "github.com/echo9et/alerting/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerGrpcGetMetrics(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	_, err := s.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1, Labels: map[string]string{"host": "a", "env": "prod"}},
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 2, Labels: map[string]string{"host": "b", "env": "prod"}},
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 4, Labels: map[string]string{"host": "c", "env": "dev"}},
+		{Id: "PollCount", Type: pb.Metric_GOUNTER, Delta: 5, Labels: map[string]string{"host": "a"}},
+	}})
+	require.NoError(t, err)
+
+	resp, err := s.GetMetrics(context.Background(), &pb.GetMetricsRequest{
+		Id:     "HeapAlloc",
+		Labels: map[string]string{"env": "prod"},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 2)
+	assert.Equal(t, map[string]string{"host": "a", "env": "prod"}, resp.Metrics[0].Labels)
+	assert.Equal(t, 1., resp.Metrics[0].Value)
+
+	resp, err = s.GetMetrics(context.Background(), &pb.GetMetricsRequest{GroupBy: []string{"env"}})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 3)
+	assert.Equal(t, "HeapAlloc", resp.Metrics[0].Id)
+	assert.Equal(t, map[string]string{"env": "dev"}, resp.Metrics[0].Labels)
+	assert.Equal(t, 4., resp.Metrics[0].Value)
+	assert.Equal(t, 3., resp.Metrics[1].Value)
+	assert.Equal(t, pb.Metric_GOUNTER, resp.Metrics[2].Type)
+	assert.Nil(t, resp.Metrics[2].Labels)
+	assert.Equal(t, int64(5), resp.Metrics[2].Delta)
+
+	_, err = s.GetMetrics(context.Background(), &pb.GetMetricsRequest{Labels: map[string]string{"1host": "a"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerGrpcCounterTotal(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	counter := func(delta, total int64) *pb.Metric {
+		return &pb.Metric{Id: "requests", Type: pb.Metric_GOUNTER, Delta: delta, Total: &total}
+	}
+
+	steps := []struct {
+		name   string
+		metric *pb.Metric
+		want   string
+	}{
+		{name: "first total", metric: counter(10, 10), want: "10"},
+		{name: "explicit zero total is a reset", metric: counter(3, 0), want: "10"},
+		{name: "growth after reset", metric: counter(4, 4), want: "14"},
+		{name: "without total", metric: &pb.Metric{Id: "requests", Type: pb.Metric_GOUNTER, Delta: 1}, want: "15"},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			_, err := s.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{Metric: step.metric})
+			require.NoError(t, err)
+			v, ok := s.Storage.GetCounter("requests")
+			require.True(t, ok)
+			assert.Equal(t, step.want, v)
+		})
+	}
+}
+
+func TestServerGrpcHistogram(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	histogram := &pb.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 1}, Sum: 5, Count: 2}
+	for range 2 {
+		resp, err := s.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+			{Id: "latency", Type: pb.Metric_HISTOGRAM, Histogram: histogram},
+		}})
+		require.NoError(t, err)
+		require.Empty(t, resp.Error)
+	}
+
+	resp, err := s.GetMetrics(context.Background(), &pb.GetMetricsRequest{Id: "latency"})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 1)
+	assert.Equal(t, pb.Metric_HISTOGRAM, resp.Metrics[0].Type)
+	assert.Equal(t, []uint64{2, 0, 2}, resp.Metrics[0].Histogram.Counts)
+	assert.Equal(t, uint64(4), resp.Metrics[0].Histogram.Count)
+
+	// Гистограмма с другими границами корзин не объединяется с сохраненной.
+	updated, err := s.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "latency", Type: pb.Metric_HISTOGRAM, Histogram: &pb.Histogram{Bounds: []float64{5}, Counts: []uint64{1, 0}, Count: 1}},
+	}})
+	require.NoError(t, err)
+	assert.Contains(t, updated.Error, entities.ErrBoundsMismatch.Error())
+	resp, err = s.GetMetrics(context.Background(), &pb.GetMetricsRequest{Id: "latency"})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 1)
+	assert.Equal(t, uint64(4), resp.Metrics[0].Histogram.Count)
+}
+
+func TestServerGrpcSummary(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	for _, v := range []float64{-1, 0, 5} {
+		sketch := entities.NewSummary(entities.DefaultSummaryAccuracy)
+		sketch.Observe(v)
+		_, err := s.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+			{Id: "latency", Type: pb.Metric_SUMMARY, Summary: SummaryToPB(sketch)},
+		}})
+		require.NoError(t, err)
+	}
+
+	resp, err := s.GetMetrics(context.Background(), &pb.GetMetricsRequest{Id: "latency"})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 1)
+	assert.Equal(t, pb.Metric_SUMMARY, resp.Metrics[0].Type)
+
+	sketch := SummaryFromPB(resp.Metrics[0].Summary)
+	require.NoError(t, sketch.Validate())
+	assert.Equal(t, uint64(3), sketch.Count)
+	assert.Equal(t, -1., sketch.Min)
+	assert.Equal(t, 0., sketch.Quantile(0.5))
+	assert.Equal(t, 5., sketch.Max)
+}
+
+func TestServerGrpcSet(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	sketch := entities.NewSet(entities.DefaultSetPrecision)
+	sketch.Add("10.0.0.1")
+	_, err := s.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "clients", Type: pb.Metric_SET, Set: SetToPB(sketch)},
+		{Id: "clients", Type: pb.Metric_SET, Members: []string{"10.0.0.1", "10.0.0.2"}},
+		{Id: "clients", Type: pb.Metric_SET, Set: &pb.Set{Precision: 300}},
+	}})
+	require.NoError(t, err)
+
+	resp, err := s.GetMetrics(context.Background(), &pb.GetMetricsRequest{Id: "clients"})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 1)
+	assert.Equal(t, pb.Metric_SET, resp.Metrics[0].Type)
+	assert.Equal(t, int64(2), resp.Metrics[0].Delta)
+	assert.Equal(t, uint32(entities.DefaultSetPrecision), resp.Metrics[0].Set.Precision)
+}
+
+func TestServerGrpcUpdateMetricErrors(t *testing.T) {
+	s := ServerGrpc{Storage: storage.NewMemStore()}
+	_, err := s.UpdateMetric(context.Background(), &pb.UpdateMetricRequest{Metric: &pb.Metric{
+		Id: "latency", Type: pb.Metric_HISTOGRAM, Histogram: &pb.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1},
+	}})
+	require.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		metric *pb.Metric
+		code   codes.Code
+	}{
+		{name: "ok", ctx: context.Background(), metric: &pb.Metric{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1}, code: codes.OK},
+		{name: "invalid label", ctx: context.Background(), metric: &pb.Metric{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Labels: map[string]string{"1host": "a"}}, code: codes.InvalidArgument},
+		{name: "invalid id", ctx: context.Background(), metric: &pb.Metric{Id: `HeapAlloc{host="a"}`, Type: pb.Metric_GAUGE, Value: 1}, code: codes.InvalidArgument},
+		{name: "invalid set", ctx: context.Background(), metric: &pb.Metric{Id: "clients", Type: pb.Metric_SET, Set: &pb.Set{Precision: 300}}, code: codes.InvalidArgument},
+		{name: "bounds mismatch", ctx: context.Background(), metric: &pb.Metric{
+			Id: "latency", Type: pb.Metric_HISTOGRAM, Histogram: &pb.Histogram{Bounds: []float64{5}, Counts: []uint64{1, 0}, Count: 1},
+		}, code: codes.InvalidArgument},
+		{name: "cancelled", ctx: cancelled, metric: &pb.Metric{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1}, code: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpdateMetric(tt.ctx, &pb.UpdateMetricRequest{Metric: tt.metric})
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	_, err = s.UpdateMetrics(cancelled, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1}}})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -1,11 +1,17 @@
 package coreserver
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/echo9et/alerting/internal/entities"
 	"github.com/echo9et/alerting/internal/server/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -79,7 +85,7 @@ func TestStatusHandler(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		ts := httptest.NewServer(GetRouter("", s, "", nil, nil))
+		ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
 		defer ts.Close()
 		t.Run(test.name, func(t *testing.T) {
 			resp, _ := testRequest(t, ts, test.want)
@@ -207,3 +213,364 @@ func TestApplyHashMiddleware(t *testing.T) {
 	assert.Equal(t, textResponse, rec.Body.String())
 	assert.Equal(t, resp.Header.Get("Hashsha256"), "ebf31a7d817d2091f7238be75431e05dd831ceaa349253b7eb2cd6c71ecbae65")
 }
+
+func TestLabels(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	for _, url := range []string{
+		"/update/gauge/HeapAlloc/1?host=a&env=prod",
+		"/update/gauge/HeapAlloc/2?host=b&env=prod",
+		"/update/gauge/HeapAlloc/4?host=c&env=dev",
+		"/update/counter/PollCount/5?host=a",
+		"/update/counter/PollCount/7?host=b",
+	} {
+		resp, _ := testRequest(t, ts, want{url: url, method: http.MethodPost})
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		code     int
+		response string
+	}{
+		{name: "exact series", url: "/value/gauge/HeapAlloc?host=b&env=prod", code: 200, response: "2\n"},
+		{name: "sum of matching series", url: "/value/gauge/HeapAlloc?env=prod", code: 200, response: "3\n"},
+		{name: "sum of all series", url: "/value/counter/PollCount", code: 200, response: "12\n"},
+		{name: "group by", url: "/value/gauge/HeapAlloc?group_by=env", code: 200,
+			response: "HeapAlloc{env=\"dev\"} 4\nHeapAlloc{env=\"prod\"} 3\n"},
+		{name: "no match", url: "/value/gauge/HeapAlloc?host=d", code: 404},
+		{name: "invalid label", url: "/value/gauge/HeapAlloc?host-name=a", code: 400},
+		{name: "filter all", url: "/?host=a", code: 200,
+			response: "HeapAlloc{env=\"prod\",host=\"a\"} 1\nPollCount{host=\"a\"} 5\n"},
+		{name: "group all", url: "/?group_by=host&env=prod", code: 200,
+			response: "HeapAlloc{host=\"a\"} 1\nHeapAlloc{host=\"b\"} 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, want{url: tt.url, method: http.MethodGet})
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, tt.response, body)
+			}
+		})
+	}
+}
+
+func TestInvalidMetricID(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{name: "url", url: "/update/gauge/HeapAlloc%7Bhost=%22a%22%7D/1"},
+		{name: "url histogram", url: "/update/histogram/latency%7B/1"},
+		{name: "json", url: "/update/", body: `{"id":"HeapAlloc{host=\"a\"}","type":"gauge","value":1}`},
+		{name: "json batch", url: "/updates/", body: `[{"id":"load","type":"gauge","value":1},{"id":"a}","type":"gauge","value":1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+	assert.Empty(t, s.AllMetricsJSON())
+}
+
+func TestHistogram(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+		want   string
+	}{
+		{name: "observe", method: http.MethodPost, url: "/update/histogram/latency/0.5?bounds=0.1,1&host=a", code: 200},
+		{name: "observe existing bounds", method: http.MethodPost, url: "/update/histogram/latency/3?host=a", code: 200},
+		{name: "invalid bounds", method: http.MethodPost, url: "/update/histogram/size/1?bounds=2,1", code: 400},
+		{name: "invalid value", method: http.MethodPost, url: "/update/histogram/size/x", code: 400},
+		{name: "merge batch", method: http.MethodPost, url: "/updates/", code: 200,
+			body: `[{"id":"latency","type":"histogram","labels":{"host":"a"},"histogram":{"bounds":[0.1,1],"counts":[1,0,0],"sum":0.05,"count":1}}]`},
+		{name: "bounds mismatch", method: http.MethodPost, url: "/updates/", code: 400,
+			body: `[{"id":"latency","type":"histogram","labels":{"host":"a"},"histogram":{"bounds":[1,2],"counts":[1,0,0],"sum":0.5,"count":1}}]`},
+		{name: "inconsistent counts", method: http.MethodPost, url: "/updates/", code: 400,
+			body: `[{"id":"latency","type":"histogram","histogram":{"bounds":[1],"counts":[1,0],"sum":0.5,"count":2}}]`},
+		{name: "value", method: http.MethodGet, url: "/value/histogram/latency?host=a", code: 200,
+			want: `{"bounds":[0.1,1],"counts":[1,1,1],"sum":3.55,"count":3}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	for i := 1; i <= 100; i++ {
+		host := "a"
+		if i > 50 {
+			host = "b"
+		}
+		url := fmt.Sprintf("/update/summary/latency/%d?host=%s", i, host)
+		resp, _ := testRequest(t, ts, want{url: url, method: http.MethodPost})
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	sketch := entities.NewSummary(entities.DefaultSummaryAccuracy)
+	sketch.Observe(1000)
+	batch, err := json.Marshal([]entities.MetricsJSON{{ID: "latency", MType: entities.Summary, Labels: map[string]string{"host": "b"}, Summary: sketch}})
+	require.NoError(t, err)
+	mismatch, err := json.Marshal([]entities.MetricsJSON{{ID: "latency", MType: entities.Summary, Labels: map[string]string{"host": "b"}, Summary: entities.NewSummary(0.05)}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+		want   string
+		approx float64
+	}{
+		{name: "merge batch", method: http.MethodPost, url: "/updates/", body: string(batch), code: 200},
+		{name: "accuracy mismatch", method: http.MethodPost, url: "/updates/", body: string(mismatch), code: 400},
+		{name: "invalid value", method: http.MethodPost, url: "/update/summary/latency/x", code: 400},
+		{name: "series max", method: http.MethodGet, url: "/value/summary/latency?host=b&q=1", code: 200, want: "1000\n"},
+		{name: "series median", method: http.MethodGet, url: "/value/summary/latency?host=a&q=0.5", code: 200, approx: 25},
+		{name: "merged series", method: http.MethodGet, url: "/value/summary/latency?q=0.99", code: 200, approx: 100},
+		{name: "group by", method: http.MethodGet, url: "/value/summary/latency?q=0&group_by=host", code: 200,
+			want: "latency{host=\"a\"} 1\nlatency{host=\"b\"} 51\n"},
+		{name: "invalid quantile", method: http.MethodGet, url: "/value/summary/latency?q=2", code: 400},
+		{name: "not found", method: http.MethodGet, url: "/value/summary/latency?host=c&q=0.5", code: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(body))
+			}
+			if tt.approx != 0 {
+				got, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+				require.NoError(t, err)
+				assert.InEpsilon(t, tt.approx, got, entities.DefaultSummaryAccuracy)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	for _, url := range []string{
+		"/update/set/users/alice?host=a",
+		"/update/set/users/bob?host=a",
+		"/update/set/users/alice?host=a",
+		"/update/set/users/a%2Fb?host=a",
+		"/update/set/users/carol?host=b",
+	} {
+		resp, _ := testRequest(t, ts, want{url: url, method: http.MethodPost})
+		require.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+
+	sketch := entities.NewSet(entities.DefaultSetPrecision)
+	sketch.Add("alice")
+	sketch.Add("dave")
+	batch, err := json.Marshal([]entities.MetricsJSON{
+		{ID: "users", MType: entities.Set, Labels: map[string]string{"host": "b"}, Set: sketch},
+		{ID: "users", MType: entities.Set, Labels: map[string]string{"host": "b"}, Members: []string{"erin", "carol"}},
+	})
+	require.NoError(t, err)
+	mismatch, err := json.Marshal([]entities.MetricsJSON{{ID: "users", MType: entities.Set, Set: entities.NewSet(10), Labels: map[string]string{"host": "b"}}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+		want   string
+	}{
+		{name: "merge batch", method: http.MethodPost, url: "/updates/", body: string(batch), code: 200},
+		{name: "precision mismatch", method: http.MethodPost, url: "/updates/", body: string(mismatch), code: 400},
+		{name: "no members", method: http.MethodPost, url: "/updates/", body: `[{"id":"users","type":"set"}]`, code: 400},
+		{name: "cardinality", method: http.MethodGet, url: "/value/set/users?host=a", code: 200, want: "3\n"},
+		{name: "merged cardinality", method: http.MethodGet, url: "/value/set/users?host=b", code: 200, want: "4\n"},
+		{name: "union", method: http.MethodGet, url: "/value/set/users", code: 200, want: "6\n"},
+		{name: "json", method: http.MethodPost, url: "/value/", body: `{"id":"users","type":"set","labels":{"host":"a"}}`, code: 200,
+			want: `{"id":"users","type":"set","delta":3,"labels":{"host":"a"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestCounterTotal(t *testing.T) {
+	s := storage.NewMemStore()
+	ts := httptest.NewServer(GetRouter("", s, "", nil, nil, nil, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		code int
+		want string
+	}{
+		{name: "first report", url: "/updates/", body: `[{"id":"Mallocs","type":"counter","delta":100,"total":100}]`, code: 200, want: "100"},
+		{name: "repeated batch", url: "/updates/", body: `[{"id":"Mallocs","type":"counter","delta":100,"total":100}]`, code: 200, want: "100"},
+		{name: "total only", url: "/update/", body: `{"id":"Mallocs","type":"counter","total":150}`, code: 200, want: "150"},
+		{name: "restart", url: "/update/", body: `{"id":"Mallocs","type":"counter","delta":7,"total":7}`, code: 200, want: "157"},
+		{name: "no value", url: "/updates/", body: `[{"id":"Mallocs","type":"counter"}]`, code: 400, want: "157"},
+		{name: "negative total", url: "/update/", body: `{"id":"Mallocs","type":"counter","total":-1}`, code: 400, want: "157"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			v, _ := s.GetCounter("Mallocs")
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func TestMetricsAllow(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, subnet, err := net.ParseCIDR(s)
+		require.NoError(t, err)
+		return subnet
+	}
+
+	tests := []struct {
+		name         string
+		trusted      *net.IPNet
+		metricsAllow *net.IPNet
+		realIP       string
+		code         int
+	}{
+		{name: "no restrictions", code: http.StatusOK},
+		{name: "scraper outside trusted subnet", trusted: cidr("10.0.0.0/8"), code: http.StatusForbidden},
+		{name: "x-real-ip is not trusted", trusted: cidr("10.0.0.0/8"), realIP: "10.0.0.1", code: http.StatusForbidden},
+		{name: "scraper in trusted subnet", trusted: cidr("127.0.0.0/8"), code: http.StatusOK},
+		{name: "metrics allow", trusted: cidr("10.0.0.0/8"), metricsAllow: cidr("127.0.0.0/8"), code: http.StatusOK},
+		{name: "outside metrics allow", trusted: cidr("127.0.0.0/8"), metricsAllow: cidr("10.0.0.0/8"), code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(GetRouter("", storage.NewMemStore(), "", nil, tt.trusted, tt.metricsAllow, nil, nil))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+			require.NoError(t, err)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+}
+
+func TestIngestAllow(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, subnet, err := net.ParseCIDR(s)
+		require.NoError(t, err)
+		return subnet
+	}
+
+	tests := []struct {
+		name        string
+		trusted     *net.IPNet
+		ingestAllow *net.IPNet
+		realIP      string
+		code        int
+	}{
+		{name: "no restrictions", code: http.StatusNoContent},
+		{name: "client in trusted subnet without x-real-ip", trusted: cidr("127.0.0.0/8"), code: http.StatusNoContent},
+		{name: "client outside trusted subnet", trusted: cidr("10.0.0.0/8"), code: http.StatusForbidden},
+		{name: "x-real-ip is not trusted", trusted: cidr("10.0.0.0/8"), realIP: "10.0.0.1", code: http.StatusForbidden},
+		{name: "ingest allow", trusted: cidr("10.0.0.0/8"), ingestAllow: cidr("127.0.0.0/8"), code: http.StatusNoContent},
+		{name: "outside ingest allow", trusted: cidr("127.0.0.0/8"), ingestAllow: cidr("10.0.0.0/8"), code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(GetRouter("", storage.NewMemStore(), "", nil, tt.trusted, nil, tt.ingestAllow, nil))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/write", strings.NewReader("mem used_percent=1\n"))
+			require.NoError(t, err)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package coreserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/handlers"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// flagNoRecordedValue флаг точки OTLP, означающий отсутствие значения.
+const flagNoRecordedValue = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+type otlpCounter struct {
+	start uint64
+	value int64
+}
+
+// ServerOTLP принимает метрики по протоколу OTLP (opentelemetry.proto.collector.metrics.v1).
+// Монотонные Sum сохраняются как counter, немонотонные Sum и Gauge - как gauge,
+// атрибуты точек становятся метками серии.
+// Для накопительных Sum запоминается последнее значение серии, в хранилище передается приращение.
+type ServerOTLP struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	Storage entities.StorageV2
+
+	mu       sync.Mutex
+	counters map[string]otlpCounter
+}
+
+// NewServerOTLP конструктор OTLP сервиса метрик.
+func NewServerOTLP(storage entities.StorageV2) *ServerOTLP {
+	return &ServerOTLP{
+		Storage:  storage,
+		counters: make(map[string]otlpCounter),
+	}
+}
+
+// Export реализует MetricsService.Export.
+// Неподдерживаемые точки (гистограммы, summary, пустые значения) отклоняются через partial success.
+func (s *ServerOTLP) Export(ctx context.Context, in *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	var rejected int64
+	reasons := make([]string, 0)
+	reject := func(n int, reason string) {
+		if n == 0 {
+			return
+		}
+		rejected += int64(n)
+		reasons = append(reasons, reason)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rm := range in.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				name := m.GetName()
+				var n int
+				var err error
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					n, err = s.setGauges(ctx, name, data.Gauge.GetDataPoints())
+					reject(n, fmt.Sprintf("%s: invalid data points", name))
+				case *metricspb.Metric_Sum:
+					sum := data.Sum
+					if sum.GetIsMonotonic() {
+						cumulative := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+						n, err = s.setCounters(ctx, name, cumulative, sum.GetDataPoints())
+					} else {
+						n, err = s.setGauges(ctx, name, sum.GetDataPoints())
+					}
+					reject(n, fmt.Sprintf("%s: invalid data points", name))
+				case *metricspb.Metric_Histogram:
+					reject(len(data.Histogram.GetDataPoints()), fmt.Sprintf("%s: histogram is not supported", name))
+				case *metricspb.Metric_ExponentialHistogram:
+					reject(len(data.ExponentialHistogram.GetDataPoints()), fmt.Sprintf("%s: exponential histogram is not supported", name))
+				case *metricspb.Metric_Summary:
+					reject(len(data.Summary.GetDataPoints()), fmt.Sprintf("%s: summary is not supported", name))
+				}
+				if err != nil {
+					return nil, grpcError(err)
+				}
+			}
+		}
+	}
+
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       strings.Join(reasons, "; "),
+		}
+	}
+	return response, nil
+}
+
+// setGauges сохраняет последнее по времени значение, возвращает количество отклоненных точек
+// и ошибку хранилища.
+func (s *ServerOTLP) setGauges(ctx context.Context, name string, points []*metricspb.NumberDataPoint) (int, error) {
+	rejected := 0
+	last := map[string]*metricspb.NumberDataPoint{}
+	for _, p := range points {
+		if !validName(name) || !validPoint(p) {
+			rejected++
+			continue
+		}
+		key := entities.SeriesKey(name, attributesLabels(p.GetAttributes()))
+		if prev, ok := last[key]; !ok || p.GetTimeUnixNano() >= prev.GetTimeUnixNano() {
+			last[key] = p
+		}
+	}
+
+	for key, p := range last {
+		if err := s.Storage.UpdateGauge(ctx, key, pointValue(p)); err != nil {
+			return rejected, err
+		}
+	}
+	return rejected, nil
+}
+
+// setCounters добавляет приращения монотонных Sum, возвращает количество отклоненных точек
+// и ошибку хранилища. Уменьшение накопительного значения или смена start_time считается сбросом счетчика.
+// Накопительное значение запоминается только после успешной записи приращения.
+func (s *ServerOTLP) setCounters(ctx context.Context, name string, cumulative bool, points []*metricspb.NumberDataPoint) (int, error) {
+	rejected := 0
+	sorted := make([]*metricspb.NumberDataPoint, 0, len(points))
+	for _, p := range points {
+		if !validName(name) || !validPoint(p) || pointValue(p) < 0 {
+			rejected++
+			continue
+		}
+		sorted = append(sorted, p)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetTimeUnixNano() < sorted[j].GetTimeUnixNano()
+	})
+
+	for _, p := range sorted {
+		value := int64(math.Round(pointValue(p)))
+		delta := value
+		key := entities.SeriesKey(name, attributesLabels(p.GetAttributes()))
+		if cumulative {
+			last, ok := s.counters[key]
+			if ok && last.start == p.GetStartTimeUnixNano() && value >= last.value {
+				delta = value - last.value
+			}
+		}
+		if err := s.Storage.UpdateCounter(ctx, key, delta); err != nil {
+			return rejected, err
+		}
+		if cumulative {
+			s.counters[key] = otlpCounter{start: p.GetStartTimeUnixNano(), value: value}
+		}
+	}
+	return rejected, nil
+}
+
+// validName проверяет, что имя метрики непустое и может быть частью ключа серии.
+func validName(name string) bool {
+	return name != "" && entities.ValidateMetricID(name) == nil
+}
+
+func validPoint(p *metricspb.NumberDataPoint) bool {
+	if p.GetFlags()&flagNoRecordedValue != 0 || p.GetValue() == nil {
+		return false
+	}
+	v := pointValue(p)
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func pointValue(p *metricspb.NumberDataPoint) float64 {
+	if v, ok := p.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return p.GetAsDouble()
+}
+
+// attributesLabels преобразует атрибуты точки в метки серии.
+func attributesLabels(attrs []*commonpb.KeyValue) map[string]string {
+	labels := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		var value string
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			value = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			value = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			value = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			value = strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+		default:
+			value = kv.GetValue().String()
+		}
+		labels[kv.GetKey()] = value
+	}
+	return handlers.SanitizeLabels(labels)
+}
@@ -0,0 +1,157 @@
+package coreserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func doublePoint(v float64, ts, start uint64, attrs ...string) *metricspb.NumberDataPoint {
+	p := &metricspb.NumberDataPoint{
+		TimeUnixNano:      ts,
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		p.Attributes = append(p.Attributes, &commonpb.KeyValue{
+			Key:   attrs[i],
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attrs[i+1]}},
+		})
+	}
+	return p
+}
+
+func intPoint(v int64, ts, start uint64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		TimeUnixNano:      ts,
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsInt{AsInt: v},
+	}
+}
+
+func exportRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func sumMetric(name string, monotonic bool, temporality metricspb.AggregationTemporality, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            monotonic,
+			AggregationTemporality: temporality,
+			DataPoints:             points,
+		}},
+	}
+}
+
+func TestServerOTLPExport(t *testing.T) {
+	s := storage.NewMemStore()
+	srv := NewServerOTLP(s)
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	resp, err := srv.Export(context.Background(), exportRequest(
+		&metricspb.Metric{
+			Name: "cpu",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{doublePoint(0.7, 2, 0), doublePoint(0.5, 1, 0)},
+			}},
+		},
+		sumMetric("queue", false, cumulative, intPoint(12, 1, 0)),
+		sumMetric("requests", true, cumulative, intPoint(10, 1, 1)),
+		sumMetric("bytes", true, delta, doublePoint(3, 1, 0), doublePoint(4, 2, 1)),
+	))
+	require.NoError(t, err)
+	assert.Nil(t, resp.PartialSuccess)
+
+	// Повторная отправка накопительного значения добавляет только приращение.
+	resp, err = srv.Export(context.Background(), exportRequest(
+		sumMetric("requests", true, cumulative, intPoint(15, 2, 1)),
+	))
+	require.NoError(t, err)
+	assert.Nil(t, resp.PartialSuccess)
+
+	// Сброс счетчика: новое start_time, значение добавляется целиком.
+	_, err = srv.Export(context.Background(), exportRequest(
+		sumMetric("requests", true, cumulative, intPoint(2, 3, 3)),
+	))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		counter bool
+		want    string
+	}{
+		{name: "cpu", want: "0.7"},
+		{name: "queue", want: "12"},
+		{name: "requests", counter: true, want: "17"},
+		{name: "bytes", counter: true, want: "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v string
+			var ok bool
+			if tt.counter {
+				v, ok = s.GetCounter(tt.name)
+			} else {
+				v, ok = s.GetGauge(tt.name)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func TestServerOTLPPartialSuccess(t *testing.T) {
+	s := storage.NewMemStore()
+	srv := NewServerOTLP(s)
+
+	resp, err := srv.Export(context.Background(), exportRequest(
+		&metricspb.Metric{
+			Name: "latency",
+			Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				DataPoints: []*metricspb.HistogramDataPoint{{Count: 1}, {Count: 2}},
+			}},
+		},
+		&metricspb.Metric{
+			Name: "temperature",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{
+					doublePoint(21, 1, 0),
+					{TimeUnixNano: 2, Flags: flagNoRecordedValue},
+				},
+			}},
+		},
+	))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(3), resp.PartialSuccess.RejectedDataPoints)
+	assert.Contains(t, resp.PartialSuccess.ErrorMessage, "latency: histogram is not supported")
+
+	// Имя метрики с набором меток отклоняется, иначе точка попала бы в чужую серию.
+	resp, err = srv.Export(context.Background(), exportRequest(&metricspb.Metric{
+		Name: `temperature{host="x"}`,
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{doublePoint(30, 1, 0)}}},
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, resp.PartialSuccess)
+	assert.Equal(t, int64(1), resp.PartialSuccess.RejectedDataPoints)
+	_, ok := s.GetGauge(`temperature{host="x"}`)
+	assert.False(t, ok)
+
+	_, ok = s.GetGauge("latency")
+	assert.False(t, ok)
+	v, ok := s.GetGauge("temperature")
+	assert.True(t, ok)
+	assert.Equal(t, "21", v)
+}
@@ -0,0 +1,165 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// idleTimeout время, после которого неактивное соединение закрывается.
+const idleTimeout = 5 * time.Minute
+
+var ErrInvalidLine = errors.New("graphite: invalid line")
+
+// Listener принимает метрики по протоколу Graphite plaintext (`path value timestamp\n`)
+// и сохраняет их как gauge. Хранилище записывает значения со временем приема,
+// поэтому timestamp только проверяется на корректность: задержанные и досылаемые
+// точки попадают в историю на момент приема, а не на время из строки.
+type Listener struct {
+	addr        string
+	maxLineLen  int
+	maxConns    int
+	storage     entities.ManagerValues
+	idleTimeout time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewListener конструктор Graphite listener.
+func NewListener(addr string, maxLineLen, maxConns int, storage entities.ManagerValues) *Listener {
+	return &Listener{
+		addr:        addr,
+		maxLineLen:  maxLineLen,
+		maxConns:    maxConns,
+		storage:     storage,
+		idleTimeout: idleTimeout,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe принимает соединения до отмены контекста.
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	listen, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ctx, listen)
+}
+
+// Serve обслуживает соединения listen до отмены контекста, затем закрывает все соединения.
+func (l *Listener) Serve(ctx context.Context, listen net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listen.Close()
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+	}()
+
+	slog.Info("Graphite listener начал работу", "addr", listen.Addr().String())
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				l.wg.Wait()
+				return nil
+			}
+			return err
+		}
+
+		if !l.track(conn) {
+			slog.Warn("graphite: too many connections", "remote", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer l.untrack(conn)
+			l.handleConn(conn)
+		}()
+	}
+}
+
+func (l *Listener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.conns) >= l.maxConns {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	return true
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	conn.Close()
+}
+
+func (l *Listener) handleConn(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, l.maxLineLen), l.maxLineLen)
+
+	conn.SetReadDeadline(time.Now().Add(l.idleTimeout))
+	for scanner.Scan() {
+		if err := l.handleLine(scanner.Text()); err != nil {
+			slog.Debug(err.Error())
+		}
+		conn.SetReadDeadline(time.Now().Add(l.idleTimeout))
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			slog.Warn("graphite: line too long, connection closed", "remote", conn.RemoteAddr().String())
+			return
+		}
+		slog.Debug(fmt.Sprintf("graphite: %s", err))
+	}
+}
+
+// handleLine разбирает строку вида `path value [timestamp]`, timestamp отбрасывается.
+func (l *Listener) handleLine(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) != 2 && len(fields) != 3 {
+		return fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	if err := entities.ValidateMetricID(fields[0]); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLine, err)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: value %q", ErrInvalidLine, line)
+	}
+
+	// Метка времени не передается в хранилище: у ManagerValues нет записи значения на заданное время.
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return fmt.Errorf("%w: timestamp %q", ErrInvalidLine, line)
+		}
+	}
+
+	l.storage.SetGauge(fields[0], value)
+	return nil
+}
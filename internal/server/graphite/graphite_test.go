@@ -0,0 +1,147 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{name: "with timestamp", line: "servers.a.cpu 12.5 1700000000"},
+		{name: "without timestamp", line: "servers.a.cpu 12.5"},
+		{name: "empty", line: "   "},
+		{name: "no value", line: "servers.a.cpu", wantErr: true},
+		{name: "bad value", line: "servers.a.cpu x 1700000000", wantErr: true},
+		{name: "nan", line: "servers.a.cpu NaN", wantErr: true},
+		{name: "bad timestamp", line: "servers.a.cpu 1 now", wantErr: true},
+		{name: "extra fields", line: "servers.a.cpu 1 2 3", wantErr: true},
+		{name: "labels in path", line: `foo{host="x"} 1 0`, wantErr: true},
+	}
+
+	l := NewListener("", 1024, 1, storage.NewMemStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.handleLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHandleLineTimestamp(t *testing.T) {
+	s := storage.NewMemStore()
+	l := NewListener("", 1024, 1, s)
+
+	// Timestamp из строки не используется: точка 2001 года записывается на время приема.
+	before := time.Now()
+	require.NoError(t, l.handleLine("servers.a.cpu 12.5 1000000000"))
+	after := time.Now()
+
+	samples, err := s.Range(entities.Gauge, "servers.a.cpu", time.Time{}, after)
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.False(t, samples[0].Timestamp.Before(before))
+	assert.Equal(t, 12.5, samples[0].Value)
+}
+
+func serve(t *testing.T, l *Listener) (string, func()) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Serve(ctx, listen) }()
+
+	return listen.Addr().String(), func() {
+		cancel()
+		require.NoError(t, <-done)
+	}
+}
+
+func waitConns(t *testing.T, l *Listener, n int) {
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.conns) == n
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestServe(t *testing.T) {
+	s := storage.NewMemStore()
+	l := NewListener("", 64, 10, s)
+	addr, stop := serve(t, l)
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("servers.a.cpu 12.5 1700000000\nbroken\nservers.a.mem 3\n"))
+	require.NoError(t, err)
+	conn.Close()
+
+	// Соединение снимается с учета после обработки всех строк.
+	waitConns(t, l, 0)
+	_, ok := s.GetGauge("servers.a.mem")
+	assert.True(t, ok)
+	v, ok := s.GetGauge("servers.a.cpu")
+	assert.True(t, ok)
+	assert.Equal(t, "12.5", v)
+}
+
+func TestServeMaxLineLen(t *testing.T) {
+	s := storage.NewMemStore()
+	l := NewListener("", 32, 10, s)
+	addr, stop := serve(t, l)
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("servers." + strings.Repeat("a", 64) + " 1\n"))
+	require.NoError(t, err)
+
+	// Сервер закрывает соединение при превышении длины строки.
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.Error(t, err)
+	waitConns(t, l, 0)
+	assert.Empty(t, s.AllMetrics())
+}
+
+func TestServeMaxConns(t *testing.T) {
+	s := storage.NewMemStore()
+	l := NewListener("", 64, 1, s)
+	addr, stop := serve(t, l)
+	defer stop()
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	waitConns(t, l, 1)
+
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = bufio.NewReader(second).ReadByte()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+}
@@ -2,19 +2,26 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/echo9et/alerting/internal/entities"
 	"github.com/go-chi/chi/v5"
 )
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+	Set       = "set"
 )
 
 type UnknowType struct {
@@ -25,44 +32,78 @@ func (e *UnknowType) Error() string {
 	return "Unknow Type"
 }
 
-var supportMetrics = map[string]func(entities.ManagerValues, string, string) error{
+var supportMetrics = map[string]func(context.Context, entities.StorageV2, string, string) error{
 	Gauge:   handlerGauge,
 	Counter: handlerCounters,
 }
 
-// saveMetricsJSON - запись метрик в хранилище
-func handlerCounters(s entities.ManagerValues, name, sValue string) error {
+// handlerCounters - запись счетчика в хранилище
+func handlerCounters(ctx context.Context, s entities.StorageV2, name, sValue string) error {
 	iValue, err := strconv.ParseInt(sValue, 10, 64)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", entities.ErrInvalidCounter, err)
 	}
-	s.SetCounter(name, iValue)
-	return nil
+	return s.UpdateCounter(ctx, name, iValue)
 }
 
-// saveMetricsJSON - запись метрик в хранилище
-func handlerGauge(s entities.ManagerValues, name, sValue string) error {
+// handlerGauge - запись gauge в хранилище
+func handlerGauge(ctx context.Context, s entities.StorageV2, name, sValue string) error {
 	fValue, err := strconv.ParseFloat(sValue, 64)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", entities.ErrInvalidGauge, err)
 	}
-	s.SetGauge(name, fValue)
-	return nil
+	return s.UpdateGauge(ctx, name, fValue)
+}
+
+// StatusCode возвращает HTTP код ответа для ошибки хранилища.
+func StatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, entities.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, entities.ErrTypeMismatch):
+		return http.StatusConflict
+	case errors.Is(err, entities.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case IsInvalidMetric(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
 
 // WriteMetric запись одной метрики в хранилище
 func WriteMetric(w http.ResponseWriter, r *http.Request, s entities.Storage) error {
+	if err := entities.ValidateMetricID(chi.URLParam(r, "name")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	switch chi.URLParam(r, "type") {
+	case Histogram:
+		return writeObservation(w, r, s)
+	case Summary:
+		return writeSummaryObservation(w, r, s)
+	case Set:
+		return writeSetMember(w, r, s)
+	}
+
 	handlerMetric, ok := supportMetrics[chi.URLParam(r, "type")]
 	if !ok {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil
 	}
-	name, value := chi.URLParam(r, "name"), chi.URLParam(r, "value")
-	err := handlerMetric(s, name, value)
+	labels, _, err := LabelsFromQuery(r.URL.Query())
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return nil
 	}
+	name, value := entities.SeriesKey(chi.URLParam(r, "name"), labels), chi.URLParam(r, "value")
+	err = handlerMetric(r.Context(), s, name, value)
+	if err != nil {
+		w.WriteHeader(StatusCode(err))
+		return nil
+	}
 
 	w.WriteHeader(http.StatusOK)
 	return nil
@@ -81,8 +122,9 @@ func WriteMetricJSON(w http.ResponseWriter, r *http.Request, s entities.Storage)
 		return err
 	}
 
-	if err = saveMetricsJSON(s, mj); err != nil {
-		return err
+	if err = saveMetricsJSON(r.Context(), s, mj); err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
 	}
 
 	out, err := json.Marshal(mj)
@@ -109,7 +151,17 @@ func WriteMetricsJSON(w http.ResponseWriter, r *http.Request, s entities.Storage
 		return err
 	}
 
-	return s.SetMetrics(metricsJSON)
+	for _, m := range metricsJSON {
+		if err := entities.ValidateSeries(m.ID, m.Labels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	if err = s.UpdateMetrics(r.Context(), metricsJSON); err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+	}
+	return nil
 }
 
 // ReadMetricJSON чтение одной метрики из хранилища, отдаются в формате JSON
@@ -125,9 +177,9 @@ func ReadMetricJSON(w http.ResponseWriter, r *http.Request, s entities.Storage)
 		slog.Error("ERROR UNMARSHAL")
 		return err
 	}
-	if err = getMetricsJSON(s, &mj); err != nil {
-		slog.Error("GET DATA")
-		return err
+	if err = getMetricsJSON(r.Context(), s, &mj); err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
 	}
 
 	out, err := json.Marshal(mj)
@@ -142,38 +194,203 @@ func ReadMetricJSON(w http.ResponseWriter, r *http.Request, s entities.Storage)
 	return nil
 }
 
-// ReadMetricJSON получение всех метрик из хранилища, отдаются в формате JSON
-func getMetricsJSON(s entities.Storage, mj *entities.MetricsJSON) error {
+// getMetricsJSON заполняет значение метрики из хранилища
+func getMetricsJSON(ctx context.Context, s entities.StorageV2, mj *entities.MetricsJSON) error {
 	switch mj.MType {
 	case Counter:
-		value, status := s.GetCounter(mj.ID)
-		if !status {
-			return errors.New("counter not found")
+		value, err := s.Counter(ctx, mj.Key())
+		if err != nil {
+			return err
 		}
-		iValue, _ := strconv.ParseInt(value, 10, 64)
-		mj.Delta = &iValue
+		mj.Delta = &value
 	case Gauge:
-		value, status := s.GetGauge(mj.ID)
-		if !status {
-			return errors.New("gauge not found")
+		value, err := s.Gauge(ctx, mj.Key())
+		if err != nil {
+			return err
+		}
+		mj.Value = &value
+	case Histogram:
+		metric, err := s.Metric(ctx, entities.Histogram, mj.Key())
+		if err != nil {
+			return err
+		}
+		mj.Histogram = metric.Histogram
+	case Summary:
+		metric, err := s.Metric(ctx, entities.Summary, mj.Key())
+		if err != nil {
+			return err
+		}
+		mj.Summary = metric.Summary
+	case Set:
+		metric, err := s.Metric(ctx, entities.Set, mj.Key())
+		if err != nil {
+			return err
 		}
-		dValue, _ := strconv.ParseFloat(value, 64)
-		mj.Value = &dValue
+		cardinality := int64(metric.Set.Cardinality())
+		mj.Delta = &cardinality
+	default:
+		return fmt.Errorf("%w %q", entities.ErrUnknownType, mj.MType)
 	}
 
 	return nil
 }
 
 // saveMetricsJSON запись одной метрики в хранилище
-func saveMetricsJSON(s entities.Storage, mj entities.MetricsJSON) error {
+func saveMetricsJSON(ctx context.Context, s entities.StorageV2, mj entities.MetricsJSON) error {
+	if err := entities.ValidateSeries(mj.ID, mj.Labels); err != nil {
+		return err
+	}
+
 	switch mj.MType {
 	case Counter:
-		s.SetCounter(mj.ID, *mj.Delta)
+		if mj.Total != nil || mj.Delta == nil {
+			return s.UpdateMetrics(ctx, []entities.MetricsJSON{mj})
+		}
+		return s.UpdateCounter(ctx, mj.Key(), *mj.Delta)
 	case Gauge:
-		s.SetGauge(mj.ID, *mj.Value)
-	default:
-		return &UnknowType{}
+		if mj.Value == nil {
+			return s.UpdateMetrics(ctx, []entities.MetricsJSON{mj})
+		}
+		return s.UpdateGauge(ctx, mj.Key(), *mj.Value)
+	case Histogram, Summary, Set:
+		return s.UpdateMetrics(ctx, []entities.MetricsJSON{mj})
 	}
 
-	return nil
+	return fmt.Errorf("%w %q", entities.ErrUnknownType, mj.MType)
+}
+
+// maxRangePoints ограничение на количество точек в ответе на запрос истории.
+const maxRangePoints = 11000
+
+// RangeJSON история значений метрики.
+type RangeJSON struct {
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []entities.Sample `json:"points"`
+}
+
+// ReadRange отдает историю значений метрики в формате JSON.
+// Параметры from и to задаются в RFC3339 или unix секундах, step - длительностью или секундами,
+// остальные параметры запроса задают метки серии.
+func ReadRange(w http.ResponseWriter, r *http.Request, s entities.Storage) {
+	mType, name := chi.URLParam(r, "type"), chi.URLParam(r, "name")
+	if _, ok := supportMetrics[mType]; !ok {
+		http.Error(w, "unknown metric type", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	labels, _, err := LabelsFromQuery(query, "from", "to", "step")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-time.Hour)
+	if v := query.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		http.Error(w, "from after to", http.StatusBadRequest)
+		return
+	}
+
+	var step time.Duration
+	if v := query.Get("step"); v != "" {
+		d, err := parseStep(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if to.Sub(from)/d > maxRangePoints {
+			http.Error(w, "too many points, increase step", http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+
+	samples, err := s.History(r.Context(), mType, entities.SeriesKey(name, labels), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	if step > 0 {
+		samples = StepSamples(samples, from, to, step)
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+	out, err := json.Marshal(RangeJSON{ID: name, MType: mType, Labels: labels, Points: samples})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// StepSamples выравнивает значения по сетке from, from+step, ..., to.
+// В каждую точку попадает последнее значение из интервала (t-step, t].
+func StepSamples(samples []entities.Sample, from, to time.Time, step time.Duration) []entities.Sample {
+	out := make([]entities.Sample, 0)
+	i := 0
+	for t := from; !t.After(to); t = t.Add(step) {
+		var last *entities.Sample
+		for ; i < len(samples) && !samples[i].Timestamp.After(t); i++ {
+			last = &samples[i]
+		}
+		if last != nil && last.Timestamp.After(t.Add(-step)) {
+			out = append(out, entities.Sample{Timestamp: t, Value: last.Value})
+		}
+	}
+	return out
+}
+
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Unix(0, int64(sec*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q", v)
+	}
+	return t, nil
+}
+
+// minRangeStep минимальный шаг агрегации истории.
+const minRangeStep = time.Millisecond
+
+// parseStep разбирает шаг в секундах или в формате time.Duration.
+// Шаг меньше minRangeStep (в том числе округленный до нуля) считается ошибкой.
+func parseStep(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if sec, errFloat := strconv.ParseFloat(v, 64); errFloat == nil {
+		d, err = 0, nil
+		if sec < float64(math.MaxInt64/time.Second) {
+			d = time.Duration(sec * float64(time.Second))
+		}
+	}
+	if err != nil || d < minRangeStep {
+		return 0, fmt.Errorf("invalid step %q", v)
+	}
+	return d, nil
 }
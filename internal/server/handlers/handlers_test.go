@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/echo9et/alerting/internal/entities"
 	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/go-chi/chi/v5"
 )
 
 func TestHandlerCounters(t *testing.T) {
@@ -32,7 +41,7 @@ func TestHandlerCounters(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := handlerCounters(s, tt.name, tt.value)
+			got := handlerCounters(context.Background(), s, tt.name, tt.value)
 			if (got != nil || tt.want != nil) && got == tt.want {
 				t.Errorf("handlerGauge(%s, %s) = %s, want: %s", tt.name, tt.value, got, tt.want)
 			}
@@ -65,10 +74,112 @@ func TestHandlerGauge(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := handlerGauge(s, tt.name, tt.value)
+			got := handlerGauge(context.Background(), s, tt.name, tt.value)
 			if (got != nil || tt.want != nil) && got == tt.want {
 				t.Errorf("handlerGauge(%s, %s) = %s, want: %s", tt.name, tt.value, got, tt.want)
 			}
 		})
 	}
 }
+
+func TestStepSamples(t *testing.T) {
+	from := time.Unix(1000, 0)
+	samples := []entities.Sample{
+		{Timestamp: from.Add(1 * time.Second), Value: 1},
+		{Timestamp: from.Add(4 * time.Second), Value: 2},
+		{Timestamp: from.Add(5 * time.Second), Value: 3},
+		{Timestamp: from.Add(21 * time.Second), Value: 4},
+	}
+
+	got := StepSamples(samples, from, from.Add(30*time.Second), 10*time.Second)
+	want := []entities.Sample{
+		{Timestamp: from.Add(10 * time.Second), Value: 3},
+		{Timestamp: from.Add(30 * time.Second), Value: 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("StepSamples() = %v, want: %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Value != want[i].Value {
+			t.Errorf("StepSamples()[%d] = %v, want: %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetGauge("HeapAlloc", 1)
+	s.SetGauge("HeapAlloc", 2)
+
+	router := chi.NewRouter()
+	router.Get("/range/{type}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		ReadRange(w, r, s)
+	})
+
+	tests := []struct {
+		name   string
+		url    string
+		code   int
+		points int
+	}{
+		{name: "raw points", url: "/range/gauge/HeapAlloc", code: http.StatusOK, points: 2},
+		{name: "unknown metric", url: "/range/gauge/Unknown", code: http.StatusOK, points: 0},
+		{name: "unknown type", url: "/range/histogram/HeapAlloc", code: http.StatusBadRequest},
+		{name: "bad from", url: "/range/gauge/HeapAlloc?from=yesterday", code: http.StatusBadRequest},
+		{name: "bad step", url: "/range/gauge/HeapAlloc?step=-1s", code: http.StatusBadRequest},
+		{name: "step rounded to zero", url: "/range/gauge/HeapAlloc?step=1e-10", code: http.StatusBadRequest},
+		{name: "step below minimum", url: "/range/gauge/HeapAlloc?step=1us", code: http.StatusBadRequest},
+		{name: "step overflow", url: "/range/gauge/HeapAlloc?step=1e300", code: http.StatusBadRequest},
+		{name: "NaN step", url: "/range/gauge/HeapAlloc?step=NaN", code: http.StatusBadRequest},
+		{name: "seconds step", url: "/range/gauge/HeapAlloc?step=60", code: http.StatusOK, points: 1},
+		{name: "too many points", url: "/range/gauge/HeapAlloc?from=0&step=1ms", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("GET %s = %d, want: %d", tt.url, rec.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var got RangeJSON
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Points) != tt.points {
+				t.Errorf("GET %s points = %d, want: %d", tt.url, len(got.Points), tt.points)
+			}
+		})
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: http.StatusOK},
+		{name: "not found", err: fmt.Errorf("%w: gauge x", entities.ErrNotFound), want: http.StatusNotFound},
+		{name: "type mismatch", err: fmt.Errorf("%w: load is stored as gauge", entities.ErrTypeMismatch), want: http.StatusConflict},
+		{name: "bounds mismatch", err: entities.ErrBoundsMismatch, want: http.StatusBadRequest},
+		{name: "precision mismatch", err: fmt.Errorf("set x: %w", entities.ErrPrecisionMismatch), want: http.StatusBadRequest},
+		{name: "unavailable", err: fmt.Errorf("%w: %w", entities.ErrUnavailable, context.DeadlineExceeded), want: http.StatusServiceUnavailable},
+		{name: "invalid gauge", err: entities.ErrInvalidGauge, want: http.StatusBadRequest},
+		{name: "invalid label", err: entities.ValidateLabels(map[string]string{"1x": "y"}), want: http.StatusBadRequest},
+		{name: "unknown type", err: entities.ErrUnknownType, want: http.StatusBadRequest},
+		{name: "other", err: errors.New("boom"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusCode(tt.err); got != tt.want {
+				t.Errorf("StatusCode(%v) = %d, want: %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
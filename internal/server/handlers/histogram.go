@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/go-chi/chi/v5"
+)
+
+// paramBounds параметр запроса с границами корзин гистограммы.
+const paramBounds = "bounds"
+
+// writeObservation добавляет одно значение в гистограмму: /update/histogram/{name}/{value}.
+// Границы корзин берутся из существующей серии, из параметра bounds или entities.DefaultBuckets.
+func writeObservation(w http.ResponseWriter, r *http.Request, s entities.Storage) error {
+	query := r.URL.Query()
+	labels, _, err := LabelsFromQuery(query, paramBounds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(chi.URLParam(r, "value"), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	name := chi.URLParam(r, "name")
+	bounds := entities.DefaultBuckets
+	existing, err := s.Metric(r.Context(), entities.Histogram, entities.SeriesKey(name, labels))
+	switch {
+	case err == nil:
+		bounds = existing.Histogram.Bounds
+	case !errors.Is(err, entities.ErrNotFound):
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
+	}
+	if v := query.Get(paramBounds); v != "" {
+		bounds, err = ParseBounds(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	h := entities.NewHistogram(bounds)
+	h.Observe(value)
+	err = s.UpdateMetrics(r.Context(), []entities.MetricsJSON{{ID: name, MType: entities.Histogram, Labels: labels, Histogram: h}})
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// ParseBounds разбирает границы корзин, перечисленные через запятую.
+func ParseBounds(v string) ([]float64, error) {
+	parts := strings.Split(v, ",")
+	bounds := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		b, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bound %q", entities.ErrInvalidHistogram, p)
+		}
+		bounds = append(bounds, b)
+	}
+	return bounds, entities.ValidateBounds(bounds)
+}
+
+// IsInvalidMetric проверяет, что ошибка записи вызвана некорректными данными клиента.
+func IsInvalidMetric(err error) bool {
+	return errors.Is(err, entities.ErrInvalidHistogram) || errors.Is(err, entities.ErrBoundsMismatch) ||
+		errors.Is(err, entities.ErrInvalidSummary) || errors.Is(err, entities.ErrAccuracyMismatch) ||
+		errors.Is(err, entities.ErrInvalidSet) || errors.Is(err, entities.ErrPrecisionMismatch) ||
+		errors.Is(err, entities.ErrInvalidCounter) ||
+		errors.Is(err, entities.ErrInvalidGauge) || errors.Is(err, entities.ErrInvalidLabel) ||
+		errors.Is(err, entities.ErrInvalidMetricID) ||
+		errors.Is(err, entities.ErrUnknownType)
+}
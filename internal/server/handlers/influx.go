@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// maxInfluxBodySize ограничение на размер тела запроса line protocol.
+const maxInfluxBodySize = 32 << 20
+
+var ErrInvalidLineProtocol = errors.New("invalid line protocol")
+
+// FieldKind тип значения поля line protocol.
+type FieldKind int
+
+const (
+	FieldFloat FieldKind = iota
+	FieldInteger
+	FieldUnsigned
+	FieldBoolean
+	FieldString
+)
+
+// Field поле точки line protocol: Value заполняется для float, Int - для integer и unsigned.
+type Field struct {
+	Key   string
+	Kind  FieldKind
+	Value float64
+	Int   int64
+}
+
+// Point строка InfluxDB line protocol.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Timestamp   *int64
+}
+
+// LineError ошибка разбора строки.
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// InfluxError тело ответа при ошибках разбора.
+type InfluxError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Errors  []LineError `json:"errors"`
+}
+
+// WriteInflux принимает метрики в формате InfluxDB line protocol.
+// Поле сохраняется под именем measurement.field с тегами в качестве меток:
+// float как gauge, integer и unsigned как counter. Telegraf передает целые поля
+// накопленным значением, поэтому они записываются как Total: хранилище само
+// вычисляет приращение, и повторная отправка того же значения его не увеличивает.
+// Строки без ошибок записываются, при наличии ошибок возвращается 400 со списком ошибок по строкам.
+// Поле, отклоненное хранилищем (например, серия другого типа), считается ошибкой его строки.
+func WriteInflux(w http.ResponseWriter, r *http.Request, s entities.Storage) {
+	metrics := make([]entities.MetricsJSON, 0)
+	lines := make([]int, 0)
+	lineErrors := make([]LineError, 0)
+	accepted := 0
+
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, maxInfluxBodySize))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInfluxBodySize)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		point, err := ParseLine(line)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: n, Error: err.Error()})
+			continue
+		}
+		pointMetrics, err := point.toMetrics()
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: n, Error: err.Error()})
+			continue
+		}
+		metrics = append(metrics, pointMetrics...)
+		for range pointMetrics {
+			lines = append(lines, n)
+		}
+		accepted++
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rejected, err := entities.UpdatePartial(r.Context(), s, metrics)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	if len(rejected) > 0 {
+		rejectedLines := make(map[int]bool)
+		for i := range metrics {
+			if err, ok := rejected[i]; ok {
+				lineErrors = append(lineErrors, LineError{Line: lines[i], Error: err.Error()})
+				rejectedLines[lines[i]] = true
+			}
+		}
+		accepted -= len(rejectedLines)
+		sort.SliceStable(lineErrors, func(i, j int) bool { return lineErrors[i].Line < lineErrors[j].Line })
+	}
+
+	if len(lineErrors) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	out, err := json.Marshal(InfluxError{
+		Code:    "invalid",
+		Message: fmt.Sprintf("%d of %d lines rejected", len(lineErrors), len(lineErrors)+accepted),
+		Errors:  lineErrors,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(out)
+}
+
+// toMetrics преобразует поля точки в метрики, некорректное имя серии
+// и отрицательное накопленное значение - ошибка.
+func (p Point) toMetrics() ([]entities.MetricsJSON, error) {
+	labels := SanitizeLabels(p.Tags)
+	metrics := make([]entities.MetricsJSON, 0, len(p.Fields))
+	for _, f := range p.Fields {
+		id := p.Measurement + "." + f.Key
+		if f.Kind != FieldBoolean && f.Kind != FieldString {
+			if err := entities.ValidateMetricID(id); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidLineProtocol, err)
+			}
+		}
+		switch f.Kind {
+		case FieldFloat:
+			value := f.Value
+			metrics = append(metrics, entities.MetricsJSON{ID: id, MType: entities.Gauge, Value: &value, Labels: labels})
+		case FieldInteger, FieldUnsigned:
+			if f.Int < 0 {
+				return nil, fmt.Errorf("%w: integer field %q must not be negative", ErrInvalidLineProtocol, f.Key)
+			}
+			total := f.Int
+			metrics = append(metrics, entities.MetricsJSON{ID: id, MType: entities.Counter, Total: &total, Labels: labels})
+		}
+	}
+	return metrics, nil
+}
+
+// ParseLine разбирает строку вида measurement[,tag=value...] field=value[,field=value...] [timestamp].
+func ParseLine(line string) (Point, error) {
+	var p Point
+
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return p, fmt.Errorf("%w: expected measurement, fields and optional timestamp", ErrInvalidLineProtocol)
+	}
+
+	keys := splitUnescaped(sections[0], ',', false)
+	p.Measurement = unescape(keys[0])
+	if p.Measurement == "" {
+		return p, fmt.Errorf("%w: empty measurement", ErrInvalidLineProtocol)
+	}
+
+	p.Tags = make(map[string]string, len(keys)-1)
+	for _, tag := range keys[1:] {
+		k, v, ok := cutUnescaped(tag, '=')
+		if !ok || k == "" || v == "" {
+			return p, fmt.Errorf("%w: tag %q", ErrInvalidLineProtocol, tag)
+		}
+		p.Tags[unescape(k)] = unescape(v)
+	}
+
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+		k, v, ok := cutUnescaped(field, '=')
+		if !ok || k == "" || v == "" {
+			return p, fmt.Errorf("%w: field %q", ErrInvalidLineProtocol, field)
+		}
+		f, err := parseField(unescape(k), v)
+		if err != nil {
+			return p, err
+		}
+		p.Fields = append(p.Fields, f)
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("%w: timestamp %q", ErrInvalidLineProtocol, sections[2])
+		}
+		p.Timestamp = &ts
+	}
+	return p, nil
+}
+
+func parseField(key, v string) (Field, error) {
+	f := Field{Key: key}
+
+	switch {
+	case v[0] == '"':
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return f, fmt.Errorf("%w: unterminated string field %q", ErrInvalidLineProtocol, key)
+		}
+		f.Kind = FieldString
+		return f, nil
+	case v == "t" || v == "T" || v == "true" || v == "True" || v == "TRUE" ||
+		v == "f" || v == "F" || v == "false" || v == "False" || v == "FALSE":
+		f.Kind = FieldBoolean
+		return f, nil
+	case strings.HasSuffix(v, "i"):
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("%w: integer field %q", ErrInvalidLineProtocol, key)
+		}
+		f.Kind, f.Int = FieldInteger, i
+	case strings.HasSuffix(v, "u"):
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil || u > math.MaxInt64 {
+			return f, fmt.Errorf("%w: unsigned field %q", ErrInvalidLineProtocol, key)
+		}
+		f.Kind, f.Int = FieldUnsigned, int64(u)
+	default:
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return f, fmt.Errorf("%w: float field %q", ErrInvalidLineProtocol, key)
+		}
+		f.Kind, f.Value = FieldFloat, value
+	}
+	return f, nil
+}
+
+// splitUnescaped делит строку по sep, пропуская экранированные символы и, если quotes, строки в кавычках.
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	out := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+// cutUnescaped делит строку по первому неэкранированному sep.
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(", =\\\"", s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantErr     bool
+		measurement string
+		tags        map[string]string
+		fields      []Field
+		timestamp   bool
+	}{
+		{
+			name:        "full line",
+			line:        "cpu,host=server01,region=eu usage_idle=98.5,procs=12i 1465839830100400200",
+			measurement: "cpu",
+			tags:        map[string]string{"host": "server01", "region": "eu"},
+			fields: []Field{
+				{Key: "usage_idle", Kind: FieldFloat, Value: 98.5},
+				{Key: "procs", Kind: FieldInteger, Int: 12},
+			},
+			timestamp: true,
+		},
+		{
+			name:        "escaped and quoted",
+			line:        `disk\ io,path=C:\\data,label=a\=b reads=3u,status="ok, fine",up=true`,
+			measurement: "disk io",
+			tags:        map[string]string{"path": `C:\data`, "label": "a=b"},
+			fields: []Field{
+				{Key: "reads", Kind: FieldUnsigned, Int: 3},
+				{Key: "status", Kind: FieldString},
+				{Key: "up", Kind: FieldBoolean},
+			},
+		},
+		{
+			name:        "integer above 2^53",
+			line:        "net bytes_recv=9007199254740993i",
+			measurement: "net",
+			tags:        map[string]string{},
+			fields:      []Field{{Key: "bytes_recv", Kind: FieldInteger, Int: 9007199254740993}},
+		},
+		{name: "unsigned overflow", line: "net bytes_sent=18446744073709551615u", wantErr: true},
+		{name: "no fields", line: "cpu,host=a", wantErr: true},
+		{name: "bad tag", line: "cpu,host value=1", wantErr: true},
+		{name: "bad float", line: "cpu value=abc", wantErr: true},
+		{name: "bad integer", line: "cpu value=1.5i", wantErr: true},
+		{name: "bad timestamp", line: "cpu value=1 yesterday", wantErr: true},
+		{name: "unterminated string", line: `cpu value="oops`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLineProtocol)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.measurement, p.Measurement)
+			assert.Equal(t, tt.tags, p.Tags)
+			assert.Equal(t, tt.fields, p.Fields)
+			assert.Equal(t, tt.timestamp, p.Timestamp != nil)
+		})
+	}
+}
+
+func TestWriteInflux(t *testing.T) {
+	s := storage.NewMemStore()
+
+	body := "# comment\n" +
+		"mem,host=a used_percent=42.5,active=100i\n" +
+		"\n" +
+		"mem,host=a bad=\n" +
+		"net,host=a bytes_recv=7i 1465839830100400200\n"
+	req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	WriteInflux(rec, req, s)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp InfluxError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, 4, resp.Errors[0].Line)
+	assert.Equal(t, "1 of 3 lines rejected", resp.Message)
+
+	v, _ := s.GetGauge(`mem.used_percent{host="a"}`)
+	assert.Equal(t, "42.5", v)
+	v, _ = s.GetCounter(`mem.active{host="a"}`)
+	assert.Equal(t, "100", v)
+	v, _ = s.GetCounter(`net.bytes_recv{host="a"}`)
+	assert.Equal(t, "7", v)
+
+	req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("mem used_percent=50\n"))
+	rec = httptest.NewRecorder()
+	WriteInflux(rec, req, s)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	v, _ = s.GetGauge("mem.used_percent")
+	assert.Equal(t, "50", v)
+	v, _ = s.GetGauge(`mem.used_percent{host="a"}`)
+	assert.Equal(t, "42.5", v)
+
+	// Целые поля накопительные: повторная отправка не удваивает значение, рост добавляет приращение.
+	for _, line := range []string{"mem,host=a active=100i\n", "mem,host=a active=130i\n"} {
+		req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(line))
+		rec = httptest.NewRecorder()
+		WriteInflux(rec, req, s)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+	v, _ = s.GetCounter(`mem.active{host="a"}`)
+	assert.Equal(t, "130", v)
+
+	req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("mem,host=a active=-1i\n"))
+	rec = httptest.NewRecorder()
+	WriteInflux(rec, req, s)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	v, _ = s.GetCounter(`mem.active{host="a"}`)
+	assert.Equal(t, "130", v)
+
+	// Строка с полем другого типа отклоняется, остальные строки записываются.
+	body = "mem,host=a active=1.5\n" +
+		"mem,host=a used_percent=60\n"
+	req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	WriteInflux(rec, req, s)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, 1, resp.Errors[0].Line)
+	assert.Equal(t, "1 of 2 lines rejected", resp.Message)
+	v, _ = s.GetGauge(`mem.used_percent{host="a"}`)
+	assert.Equal(t, "60", v)
+
+	// Имя серии не может содержать набор меток, зарезервированные теги переименовываются.
+	body = "mem{host} used_percent=1\n" +
+		"latency,le=0.5 count=3i\n"
+	req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	WriteInflux(rec, req, s)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, 1, resp.Errors[0].Line)
+	v, _ = s.GetCounter(`latency.count{_le="0.5"}`)
+	assert.Equal(t, "3", v)
+}
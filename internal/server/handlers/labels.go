@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// LabelsFromQuery возвращает метки из параметров запроса и список меток для группировки из group_by.
+// Параметры из reserved метками не считаются.
+func LabelsFromQuery(query url.Values, reserved ...string) (map[string]string, []string, error) {
+	labels := make(map[string]string)
+	groupBy := make([]string, 0)
+	for k, v := range query {
+		if k == entities.LabelGroupBy {
+			for _, l := range strings.Split(strings.Join(v, ","), ",") {
+				if l = strings.TrimSpace(l); l != "" {
+					groupBy = append(groupBy, l)
+				}
+			}
+			continue
+		}
+		if isReserved(k, reserved) {
+			continue
+		}
+		if len(v) != 1 {
+			return nil, nil, fmt.Errorf("label %q set more than once", k)
+		}
+		labels[k] = v[0]
+	}
+
+	if err := entities.ValidateLabels(labels); err != nil {
+		return nil, nil, err
+	}
+	return labels, groupBy, nil
+}
+
+func isReserved(key string, reserved []string) bool {
+	for _, r := range reserved {
+		if key == r {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeLabels приводит имена меток к виду [a-zA-Z_][a-zA-Z0-9_]*, пустые метки отбрасываются,
+// к зарезервированным именам (group_by, le, quantile) добавляется префикс "_".
+// Возвращает nil для пустого набора.
+func SanitizeLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if k == "" || v == "" {
+			continue
+		}
+		name := strings.ReplaceAll(SanitizeMetricName(k), ":", "_")
+		if entities.IsReservedLabel(name) {
+			name = "_" + name
+		}
+		out[name] = v
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// WriteSeries выводит метрики построчно в виде `ключ серии значение`.
+func WriteSeries(w io.Writer, metrics []entities.MetricsJSON) {
+	for _, m := range metrics {
+		fmt.Fprintln(w, m.Key(), m.FormatValue())
+	}
+}
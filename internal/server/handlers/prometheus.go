@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+const (
+	contentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// WritePrometheus отдает все метрики в текстовом формате Prometheus 0.0.4,
+// либо в формате OpenMetrics, если клиент указал его в заголовке Accept.
+func WritePrometheus(w http.ResponseWriter, r *http.Request, s entities.Storage) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	metrics, err := s.Metrics(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
+		return metrics[i].Key() < metrics[j].Key()
+	})
+
+	var buf bytes.Buffer
+	// families имя семейства -> метрика, которой оно принадлежит.
+	families := make(map[string]string, len(metrics))
+	for _, metric := range metrics {
+		name := SanitizeMetricName(metric.ID)
+
+		var mType, sample string
+		var value float64
+		switch metric.MType {
+		case entities.Gauge:
+			if metric.Value == nil {
+				continue
+			}
+			mType, sample, value = "gauge", name, *metric.Value
+		case entities.Counter:
+			if metric.Delta == nil {
+				continue
+			}
+			mType, sample, value = "counter", name, float64(*metric.Delta)
+			if openMetrics {
+				name = strings.TrimSuffix(name, "_total")
+				sample = name + "_total"
+			}
+		case entities.Set:
+			if metric.Set == nil {
+				continue
+			}
+			mType, sample, value = "gauge", name, float64(metric.Set.Cardinality())
+		case entities.Histogram:
+			if metric.Histogram == nil {
+				continue
+			}
+			mType = "histogram"
+		case entities.Summary:
+			if metric.Summary == nil {
+				continue
+			}
+			mType = "summary"
+		default:
+			continue
+		}
+
+		owner := metric.MType + " " + metric.ID
+		if prev, ok := families[name]; !ok {
+			families[name] = owner
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", name, mType)
+		} else if prev != owner {
+			slog.Warn("prometheus: duplicate metric name after sanitization", "id", metric.ID, "name", name)
+			continue
+		}
+
+		if metric.MType == entities.Histogram {
+			writeHistogram(&buf, name, metric.Labels, metric.Histogram)
+			continue
+		}
+		if metric.MType == entities.Summary {
+			writeSummary(&buf, name, metric.Labels, metric.Summary)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s%s %s\n", sample, formatLabels(metric.Labels), formatFloat(value))
+	}
+
+	if cache, ok := s.(entities.CacheStorage); ok {
+		writeCacheStats(&buf, families, cache.Stats(), openMetrics)
+	}
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypePrometheus)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeCacheStats выводит статистику кэша хранилища: storage_cache_hits_total,
+// storage_cache_misses_total и storage_cache_size. Семейства, имена которых уже заняты
+// метриками клиентов, пропускаются.
+func writeCacheStats(buf *bytes.Buffer, families map[string]string, stats entities.CacheStats, openMetrics bool) {
+	stat := []struct {
+		name  string
+		mType string
+		value uint64
+	}{
+		{name: "storage_cache_hits_total", mType: "counter", value: stats.Hits},
+		{name: "storage_cache_misses_total", mType: "counter", value: stats.Misses},
+		{name: "storage_cache_size", mType: "gauge", value: uint64(stats.Size)},
+	}
+	for _, v := range stat {
+		family := v.name
+		if openMetrics && v.mType == "counter" {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		if _, ok := families[family]; ok {
+			slog.Warn(fmt.Sprintf("prometheus: metric %s hides storage cache stats", family))
+			continue
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n%s %d\n", family, v.mType, v.name, v.value)
+	}
+}
+
+// SanitizeMetricName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+func SanitizeMetricName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// writeHistogram выводит накопительные корзины name_bucket с меткой le, name_sum и name_count.
+func writeHistogram(buf *bytes.Buffer, name string, labels map[string]string, h *entities.HistogramData) {
+	bucketLabels := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		bucketLabels[k] = v
+	}
+
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		bucketLabels[entities.LabelBucket] = "+Inf"
+		if i < len(h.Bounds) {
+			bucketLabels[entities.LabelBucket] = formatFloat(h.Bounds[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, formatLabels(bucketLabels), cumulative)
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, formatLabels(labels), formatFloat(h.Sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, formatLabels(labels), h.Count)
+}
+
+// formatLabels метки в формате {k="v",...}, имена меток отсортированы.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, k, replacer.Replace(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeSummary выводит квантили entities.DefaultQuantiles, _sum и _count.
+func writeSummary(buf *bytes.Buffer, name string, labels map[string]string, sd *entities.SummaryData) {
+	quantileLabels := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		quantileLabels[k] = v
+	}
+
+	for _, q := range entities.DefaultQuantiles {
+		quantileLabels[entities.LabelQuantile] = formatFloat(q)
+		fmt.Fprintf(buf, "%s%s %s\n", name, formatLabels(quantileLabels), formatFloat(sd.Quantile(q)))
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, formatLabels(labels), formatFloat(sd.Sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, formatLabels(labels), sd.Count)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "HeapAlloc", want: "HeapAlloc"},
+		{name: "http.requests-total", want: "http_requests_total"},
+		{name: "1minute", want: "_1minute"},
+		{name: "cpu:usage2", want: "cpu:usage2"},
+		{name: "память", want: "______"},
+		{name: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeMetricName(tt.name))
+		})
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetGauge("HeapAlloc", 1.5)
+	s.SetGauge(`HeapAlloc{host="b\\c"}`, 2.5)
+	s.SetGauge("heap.alloc", 2)
+	s.SetCounter("PollCount", 3)
+	s.SetCounter("requests_total", 4)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "prometheus text",
+			contentType: contentTypePrometheus,
+			want: "# TYPE HeapAlloc gauge\nHeapAlloc 1.5\nHeapAlloc{host=\"b\\\\c\"} 2.5\n" +
+				"# TYPE PollCount counter\nPollCount 3\n" +
+				"# TYPE heap_alloc gauge\nheap_alloc 2\n" +
+				"# TYPE requests_total counter\nrequests_total 4\n",
+		},
+		{
+			name:        "openmetrics",
+			accept:      "application/openmetrics-text;version=1.0.0,text/plain;q=0.5",
+			contentType: contentTypeOpenMetrics,
+			want: "# TYPE HeapAlloc gauge\nHeapAlloc 1.5\nHeapAlloc{host=\"b\\\\c\"} 2.5\n" +
+				"# TYPE PollCount counter\nPollCount_total 3\n" +
+				"# TYPE heap_alloc gauge\nheap_alloc 2\n" +
+				"# TYPE requests counter\nrequests_total 4\n" +
+				"# EOF\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			WritePrometheus(rec, req, s)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestWritePrometheusHistogram(t *testing.T) {
+	s := storage.NewMemStore()
+	h := entities.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+	s.SetMetrics([]entities.MetricsJSON{{ID: "latency", MType: entities.Histogram, Labels: map[string]string{"host": "a"}, Histogram: h}})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	WritePrometheus(rec, req, s)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE latency histogram\n"+
+		"latency_bucket{host=\"a\",le=\"0.1\"} 1\n"+
+		"latency_bucket{host=\"a\",le=\"1\"} 2\n"+
+		"latency_bucket{host=\"a\",le=\"+Inf\"} 3\n"+
+		"latency_sum{host=\"a\"} 3.55\n"+
+		"latency_count{host=\"a\"} 3\n", rec.Body.String())
+}
+
+func TestWritePrometheusSummary(t *testing.T) {
+	s := storage.NewMemStore()
+	sketch := entities.NewSummary(entities.DefaultSummaryAccuracy)
+	sketch.Observe(2)
+	s.SetMetrics([]entities.MetricsJSON{{ID: "latency", MType: entities.Summary, Summary: sketch}})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	WritePrometheus(rec, req, s)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE latency summary\n"+
+		"latency{quantile=\"0.5\"} 2\n"+
+		"latency{quantile=\"0.9\"} 2\n"+
+		"latency{quantile=\"0.95\"} 2\n"+
+		"latency{quantile=\"0.99\"} 2\n"+
+		"latency_sum 2\n"+
+		"latency_count 1\n", rec.Body.String())
+}
+
+func TestWritePrometheusSet(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetMetrics([]entities.MetricsJSON{{ID: "users", MType: entities.Set, Members: []string{"alice", "bob", "alice"}}})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	WritePrometheus(rec, req, s)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE users gauge\nusers 2\n", rec.Body.String())
+}
+
+func TestWritePrometheusCacheStats(t *testing.T) {
+	c := storage.NewCache(storage.NewMemStore(), storage.CacheOptions{TTL: time.Hour, Size: 10})
+	c.SetGauge("load", 1)
+	c.GetGauge("load")
+	c.GetGauge("load")
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{
+			name: "prometheus text",
+			want: "# TYPE load gauge\nload 1\n" +
+				"# TYPE storage_cache_hits_total counter\nstorage_cache_hits_total 1\n" +
+				"# TYPE storage_cache_misses_total counter\nstorage_cache_misses_total 1\n" +
+				"# TYPE storage_cache_size gauge\nstorage_cache_size 1\n",
+		},
+		{
+			name:   "openmetrics",
+			accept: "application/openmetrics-text",
+			want: "# TYPE load gauge\nload 1\n" +
+				"# TYPE storage_cache_hits counter\nstorage_cache_hits_total 1\n" +
+				"# TYPE storage_cache_misses counter\nstorage_cache_misses_total 1\n" +
+				"# TYPE storage_cache_size gauge\nstorage_cache_size 1\n" +
+				"# EOF\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			WritePrometheus(rec, req, c)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxRemoteWriteSize ограничение на размер сжатого тела запроса remote-write.
+const maxRemoteWriteSize = 32 << 20
+
+var errRemoteWriteFormat = errors.New("remote write: malformed protobuf")
+
+// Типы метрик из prometheus.MetricMetadata.
+const (
+	metadataCounter = 1
+	metadataGauge   = 2
+)
+
+// RemoteWriteResult количество принятых и отклоненных значений запроса.
+type RemoteWriteResult struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+type remoteSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+	samples   int
+	rejected  int
+	histogram bool
+}
+
+// RemoteWrite принимает данные по протоколу Prometheus remote-write 1.0.
+// Counter в Prometheus накопительные, поэтому значение передается в хранилище как Total:
+// хранилище помнит последнее накопленное значение серии и само вычисляет приращение
+// и сброс счетчика, в том числе после перезапуска сервера.
+type RemoteWrite struct {
+	storage entities.Storage
+}
+
+// NewRemoteWrite конструктор обработчика remote-write.
+func NewRemoteWrite(storage entities.Storage) *RemoteWrite {
+	return &RemoteWrite{storage: storage}
+}
+
+// ServeHTTP обрабатывает POST /api/v1/write.
+func (rw *RemoteWrite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteWriteSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if n, err := snappy.DecodedLen(compressed); err != nil || n > 8*maxRemoteWriteSize {
+		http.Error(w, "snappy: invalid or too large payload", http.StatusBadRequest)
+		return
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("snappy: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	series, types, err := decodeWriteRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Серии, отклоненные хранилищем (например, записанные ранее с другим типом),
+	// учитываются в Rejected, остальные серии запроса записываются.
+	metrics, samples, result := toMetrics(series, types)
+	rejected, err := entities.UpdatePartial(r.Context(), rw.storage, metrics)
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return
+	}
+	for i, err := range rejected {
+		slog.Debug(fmt.Sprintf("remote write: %s", err))
+		result.Accepted -= samples[i]
+		result.Rejected += samples[i]
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// toMetrics преобразует серии в метрики хранилища и возвращает количество значений каждой метрики.
+// Из нескольких значений серии берется последнее по времени.
+func toMetrics(series []remoteSeries, types map[string]int) ([]entities.MetricsJSON, []int, RemoteWriteResult) {
+	var result RemoteWriteResult
+	metrics := make([]entities.MetricsJSON, 0, len(series))
+	samples := make([]int, 0, len(series))
+	for _, s := range series {
+		result.Rejected += s.rejected
+		name := s.labels["__name__"]
+		if name == "" || s.histogram || entities.ValidateMetricID(name) != nil {
+			result.Rejected += s.samples
+			continue
+		}
+		if s.samples == 0 {
+			continue
+		}
+		isCounter := types[name] == metadataCounter || (types[name] != metadataGauge && strings.HasSuffix(name, "_total"))
+		if isCounter && s.value < 0 {
+			result.Rejected += s.samples
+			continue
+		}
+		result.Accepted += s.samples
+
+		labels := make(map[string]string, len(s.labels))
+		for k, v := range s.labels {
+			if k != "__name__" {
+				labels[k] = v
+			}
+		}
+		labels = SanitizeLabels(labels)
+		samples = append(samples, s.samples)
+
+		if isCounter {
+			total := int64(math.Round(s.value))
+			metrics = append(metrics, entities.MetricsJSON{ID: name, MType: entities.Counter, Total: &total, Labels: labels})
+			continue
+		}
+
+		value := s.value
+		metrics = append(metrics, entities.MetricsJSON{ID: name, MType: entities.Gauge, Value: &value, Labels: labels})
+	}
+	return metrics, samples, result
+}
+
+// decodeWriteRequest разбирает prometheus.WriteRequest:
+// timeseries = 1, metadata = 3.
+func decodeWriteRequest(data []byte) ([]remoteSeries, map[string]int, error) {
+	series := make([]remoteSeries, 0)
+	types := make(map[string]int)
+
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			s, err := decodeTimeSeries(v)
+			if err != nil {
+				return err
+			}
+			series = append(series, s)
+		case num == 3 && typ == protowire.BytesType:
+			name, mType, err := decodeMetadata(v)
+			if err != nil {
+				return err
+			}
+			types[name] = mType
+		}
+		return nil
+	})
+	return series, types, err
+}
+
+// decodeTimeSeries разбирает prometheus.TimeSeries:
+// labels = 1, samples = 2, histograms = 4.
+func decodeTimeSeries(data []byte) (remoteSeries, error) {
+	s := remoteSeries{labels: make(map[string]string), timestamp: math.MinInt64}
+
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var name, value string
+			err := walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ == protowire.BytesType && num == 1 {
+					name = string(v)
+				} else if typ == protowire.BytesType && num == 2 {
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.labels[name] = value
+		case num == 2 && typ == protowire.BytesType:
+			var value float64
+			var timestamp int64
+			err := walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 && typ == protowire.Fixed64Type {
+					bits, _ := protowire.ConsumeFixed64(v)
+					value = math.Float64frombits(bits)
+				} else if num == 2 && typ == protowire.VarintType {
+					t, _ := protowire.ConsumeVarint(v)
+					timestamp = int64(t)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			// NaN используется Prometheus как отметка устаревания серии.
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				s.rejected++
+				return nil
+			}
+			s.samples++
+			if timestamp >= s.timestamp {
+				s.value, s.timestamp = value, timestamp
+			}
+		case num == 4 && typ == protowire.BytesType:
+			s.histogram = true
+			s.rejected++
+		}
+		return nil
+	})
+	return s, err
+}
+
+// decodeMetadata разбирает prometheus.MetricMetadata: type = 1, metric_family_name = 2.
+func decodeMetadata(data []byte) (string, int, error) {
+	var name string
+	var mType int
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num == 1 && typ == protowire.VarintType {
+			t, _ := protowire.ConsumeVarint(v)
+			mType = int(t)
+		} else if num == 2 && typ == protowire.BytesType {
+			name = string(v)
+		}
+		return nil
+	})
+	return name, mType, err
+}
+
+// walkMessage вызывает fn для каждого поля сообщения.
+// Для BytesType в v передается содержимое поля, для остальных типов - закодированное значение.
+func walkMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errRemoteWriteFormat
+		}
+		data = data[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return errRemoteWriteFormat
+			}
+			value, n = v, m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return errRemoteWriteFormat
+			}
+			value = data[:n]
+		}
+
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testSample struct {
+	value     float64
+	timestamp int64
+}
+
+func appendSeries(b []byte, labels [][2]string, samples []testSample, histogram bool) []byte {
+	var ts []byte
+	for _, l := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l[0])
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l[1])
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, label)
+	}
+	for _, s := range samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+	}
+	if histogram {
+		ts = protowire.AppendTag(ts, 4, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, nil)
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+func appendMetadata(b []byte, name string, mType uint64) []byte {
+	var md []byte
+	md = protowire.AppendTag(md, 1, protowire.VarintType)
+	md = protowire.AppendVarint(md, mType)
+	md = protowire.AppendTag(md, 2, protowire.BytesType)
+	md = protowire.AppendString(md, name)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	return protowire.AppendBytes(b, md)
+}
+
+func postRemoteWrite(t *testing.T, rw *RemoteWrite, body []byte) (int, RemoteWriteResult) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(snappy.Encode(nil, body)))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	rw.ServeHTTP(rec, req)
+
+	var result RemoteWriteResult
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	}
+	return rec.Code, result
+}
+
+func TestRemoteWrite(t *testing.T) {
+	s := storage.NewMemStore()
+	rw := NewRemoteWrite(s)
+
+	var body []byte
+	body = appendSeries(body, [][2]string{{"__name__", "temperature"}, {"host", "a"}},
+		[]testSample{{value: 20, timestamp: 1000}, {value: 21.5, timestamp: 2000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "http_requests_total"}}, []testSample{{value: 10, timestamp: 1000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "queue"}}, []testSample{{value: 5, timestamp: 1000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "stale"}}, []testSample{{value: math.NaN(), timestamp: 1000}}, false)
+	body = appendSeries(body, [][2]string{{"job", "no-name"}}, []testSample{{value: 1, timestamp: 1000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "latency"}}, nil, true)
+	body = appendMetadata(body, "queue", metadataCounter)
+
+	code, result := postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, RemoteWriteResult{Accepted: 4, Rejected: 3}, result)
+
+	v, ok := s.GetGauge(`temperature{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, "21.5", v)
+	v, _ = s.GetCounter("http_requests_total")
+	assert.Equal(t, "10", v)
+	v, _ = s.GetCounter("queue")
+	assert.Equal(t, "5", v)
+
+	// Повторная отправка накопительного counter добавляет только приращение.
+	body = appendSeries(nil, [][2]string{{"__name__", "http_requests_total"}}, []testSample{{value: 15, timestamp: 3000}}, false)
+	code, _ = postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	v, _ = s.GetCounter("http_requests_total")
+	assert.Equal(t, "15", v)
+
+	// Сброс counter на стороне клиента.
+	body = appendSeries(nil, [][2]string{{"__name__", "http_requests_total"}}, []testSample{{value: 2, timestamp: 4000}}, false)
+	code, _ = postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	v, _ = s.GetCounter("http_requests_total")
+	assert.Equal(t, "17", v)
+
+	// Новый обработчик (перезапуск сервера) не добавляет накопленное значение повторно.
+	code, _ = postRemoteWrite(t, NewRemoteWrite(s), body)
+	require.Equal(t, http.StatusOK, code)
+	v, _ = s.GetCounter("http_requests_total")
+	assert.Equal(t, "17", v)
+
+	// Отрицательное значение counter отклоняется, остальные серии пакета принимаются.
+	body = appendSeries(nil, [][2]string{{"__name__", "errors_total"}}, []testSample{{value: -1, timestamp: 5000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "queue"}}, []testSample{{value: 6, timestamp: 5000}}, false)
+	body = appendMetadata(body, "queue", metadataCounter)
+	code, result = postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, RemoteWriteResult{Accepted: 1, Rejected: 1}, result)
+	_, ok = s.GetCounter("errors_total")
+	assert.False(t, ok)
+
+	// Серия, сохраненная ранее с другим типом, отклоняется, остальные серии записываются.
+	body = appendSeries(nil, [][2]string{{"__name__", "queue"}}, []testSample{{value: 7, timestamp: 6000}, {value: 8, timestamp: 7000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "temperature"}, {"host", "a"}}, []testSample{{value: 22, timestamp: 6000}}, false)
+	code, result = postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, RemoteWriteResult{Accepted: 1, Rejected: 2}, result)
+	v, _ = s.GetCounter("queue")
+	assert.Equal(t, "6", v)
+	v, _ = s.GetGauge(`temperature{host="a"}`)
+	assert.Equal(t, "22", v)
+
+	// Имя с набором меток отклоняется, метка le переименовывается.
+	body = appendSeries(nil, [][2]string{{"__name__", `fake{host="x"}`}}, []testSample{{value: 1, timestamp: 8000}}, false)
+	body = appendSeries(body, [][2]string{{"__name__", "latency_bucket"}, {"le", "0.5"}}, []testSample{{value: 3, timestamp: 8000}}, false)
+	code, result = postRemoteWrite(t, rw, body)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, RemoteWriteResult{Accepted: 1, Rejected: 1}, result)
+	_, ok = s.GetGauge(`fake{host="x"}`)
+	assert.False(t, ok)
+	v, _ = s.GetGauge(`latency_bucket{_le="0.5"}`)
+	assert.Equal(t, "3", v)
+}
+
+func TestRemoteWriteMalformed(t *testing.T) {
+	rw := NewRemoteWrite(storage.NewMemStore())
+
+	code, _ := postRemoteWrite(t, rw, []byte{0x0a, 0xff})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("not snappy")))
+	rec := httptest.NewRecorder()
+	rw.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/write", iotest.ErrReader(io.ErrUnexpectedEOF))
+	rec = httptest.NewRecorder()
+	rw.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(make([]byte, maxRemoteWriteSize+1)))
+	rec = httptest.NewRecorder()
+	rw.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
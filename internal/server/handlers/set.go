@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/go-chi/chi/v5"
+)
+
+// writeSetMember добавляет значение в метрику set: /update/set/{name}/{value}.
+// Значение передается как есть, спецсимволы экранируются в пути.
+func writeSetMember(w http.ResponseWriter, r *http.Request, s entities.Storage) error {
+	labels, _, err := LabelsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	member := chi.URLParam(r, "value")
+	// chi берет параметры из RawPath, если путь содержит экранированные символы.
+	if r.URL.RawPath != "" {
+		if member, err = url.PathUnescape(member); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	name := chi.URLParam(r, "name")
+	err = s.UpdateMetrics(r.Context(), []entities.MetricsJSON{{ID: name, MType: entities.Set, Labels: labels, Members: []string{member}}})
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
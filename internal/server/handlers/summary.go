@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/go-chi/chi/v5"
+)
+
+// ParamQuantile параметр запроса с квантилем summary.
+const ParamQuantile = "q"
+
+// writeSummaryObservation добавляет одно значение в summary: /update/summary/{name}/{value}.
+// Точность скетча берется из существующей серии или entities.DefaultSummaryAccuracy.
+func writeSummaryObservation(w http.ResponseWriter, r *http.Request, s entities.Storage) error {
+	labels, _, err := LabelsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(chi.URLParam(r, "value"), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+
+	name := chi.URLParam(r, "name")
+	accuracy := entities.DefaultSummaryAccuracy
+	existing, err := s.Metric(r.Context(), entities.Summary, entities.SeriesKey(name, labels))
+	switch {
+	case err == nil:
+		accuracy = existing.Summary.Accuracy
+	case !errors.Is(err, entities.ErrNotFound):
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
+	}
+
+	sketch := entities.NewSummary(accuracy)
+	sketch.Observe(value)
+	err = s.UpdateMetrics(r.Context(), []entities.MetricsJSON{{ID: name, MType: entities.Summary, Labels: labels, Summary: sketch}})
+	if err != nil {
+		http.Error(w, err.Error(), StatusCode(err))
+		return nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// ParseQuantile разбирает квантиль из [0, 1].
+func ParseQuantile(v string) (float64, error) {
+	q, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(q) || q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile %q must be a number in [0, 1]", v)
+	}
+	return q, nil
+}
+
+// QuantileValue значение квантиля q метрики типа summary.
+func QuantileValue(m entities.MetricsJSON, q float64) string {
+	if m.Summary == nil || m.Summary.Count == 0 {
+		return ""
+	}
+	return fmt.Sprint(m.Summary.Quantile(q))
+}
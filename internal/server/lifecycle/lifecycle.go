@@ -0,0 +1,104 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Signals сигналы, по которым сервер завершает работу.
+var Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+
+// Manager останавливает компоненты сервера при завершении работы.
+// Компоненты останавливаются в порядке, обратном регистрации: сначала перестают
+// приниматься новые данные, затем завершаются фоновые задачи и последним - хранилище.
+type Manager struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	hooks   []hook
+	stopped bool
+}
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// New создает Manager, timeout ограничивает общее время остановки всех компонентов.
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// OnStop регистрирует функцию остановки компонента.
+func (m *Manager) OnStop(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Go запускает фоновую задачу run. При остановке контекст задачи отменяется
+// и Manager ждет ее завершения.
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	m.OnStop(name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	})
+}
+
+// Wait ждет сигнала завершения или отмены ctx и останавливает компоненты.
+func (m *Manager) Wait(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, Signals...)
+	defer stop()
+
+	<-ctx.Done()
+	slog.Info("Завершение работы сервера")
+	return m.Shutdown()
+}
+
+// Shutdown останавливает компоненты. После истечения timeout функции остановки
+// все равно вызываются с отмененным контекстом, чтобы освободить ресурсы.
+// Повторный вызов ничего не делает.
+func (m *Manager) Shutdown() error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	hooks := m.hooks
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+		if err := h.stop(ctx); err != nil {
+			slog.Error("Ошибка остановки", "component", h.name, "error", err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", h.name, err))
+			continue
+		}
+		slog.Info("Остановлен", "component", h.name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	m := New(time.Second)
+	var order []string
+	for _, name := range []string{"storage", "grpc", "http"} {
+		m.OnStop(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	assert.NoError(t, m.Shutdown())
+	assert.Equal(t, []string{"http", "grpc", "storage"}, order)
+
+	// Повторная остановка не вызывает функции еще раз.
+	assert.NoError(t, m.Shutdown())
+	assert.Len(t, order, 3)
+}
+
+func TestShutdownErrors(t *testing.T) {
+	m := New(time.Second)
+	errStop := errors.New("stop failed")
+	called := false
+	m.OnStop("storage", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	m.OnStop("http", func(ctx context.Context) error {
+		return errStop
+	})
+
+	err := m.Shutdown()
+	assert.ErrorIs(t, err, errStop)
+	assert.ErrorContains(t, err, "stop http")
+	assert.True(t, called, "components after failed one must be stopped")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	m := New(50 * time.Millisecond)
+	var storageCtxErr error
+	m.OnStop("storage", func(ctx context.Context) error {
+		storageCtxErr = ctx.Err()
+		return nil
+	})
+	m.Go("stuck", func(ctx context.Context) {
+		time.Sleep(time.Second)
+	})
+
+	start := time.Now()
+	err := m.Shutdown()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.ErrorIs(t, storageCtxErr, context.DeadlineExceeded)
+}
+
+func TestGo(t *testing.T) {
+	m := New(time.Second)
+	finished := false
+	m.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		finished = true
+	})
+
+	assert.NoError(t, m.Shutdown())
+	assert.True(t, finished)
+}
+
+func TestWait(t *testing.T) {
+	m := New(time.Second)
+	stopped := make(chan struct{})
+	m.OnStop("http", func(ctx context.Context) error {
+		close(stopped)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	assert.NoError(t, m.Wait(ctx))
+	select {
+	case <-stopped:
+	default:
+		t.Error("Wait returned before components were stopped")
+	}
+}
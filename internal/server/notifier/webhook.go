@@ -0,0 +1,307 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/echo9et/alerting/internal/hashing"
+	"github.com/echo9et/alerting/internal/server/alerts"
+)
+
+// maxAttempts количество циклов повторов, после которого уведомление удаляется из очереди.
+const maxAttempts = 10
+
+var errRetry = errors.New("webhook temporary error")
+
+// Notification тело запроса, отправляемого на webhook.
+type Notification struct {
+	Rule       string     `json:"rule"`
+	Metric     string     `json:"metric"`
+	MType      string     `json:"type"`
+	Value      *float64   `json:"value,omitempty"`
+	State      string     `json:"state"`
+	ActiveAt   *time.Time `json:"active_at,omitempty"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+type item struct {
+	URL          string       `json:"url"`
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+}
+
+// Webhook отправляет уведомления о правилах на webhook адреса.
+// У каждого адреса своя очередь и свой обработчик, поэтому недоступный адрес не задерживает остальные.
+// Очереди неотправленных уведомлений хранятся в файле и переживают перезапуск сервера.
+type Webhook struct {
+	urls      []string
+	secretKey string
+	filename  string
+	client    *http.Client
+	delays    []time.Duration
+
+	mu     sync.Mutex
+	queues map[string][]item
+	wake   map[string]chan struct{}
+
+	// saveMu упорядочивает запись очередей в файл, запись идет без mu.
+	saveMu sync.Mutex
+}
+
+// NewWebhook конструктор уведомлений, восстанавливает очереди из filename.
+// Уведомления для адресов, которых больше нет в urls, отбрасываются.
+func NewWebhook(urls []string, secretKey string, filename string) (*Webhook, error) {
+	w := &Webhook{
+		urls:      make([]string, 0, len(urls)),
+		secretKey: secretKey,
+		filename:  filename,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		delays:    []time.Duration{1 * time.Second, 2 * time.Second, 5 * time.Second},
+		queues:    make(map[string][]item, len(urls)),
+		wake:      make(map[string]chan struct{}, len(urls)),
+	}
+	for _, url := range urls {
+		if _, ok := w.queues[url]; ok {
+			continue
+		}
+		w.urls = append(w.urls, url)
+		w.queues[url] = make([]item, 0)
+		w.wake[url] = make(chan struct{}, 1)
+	}
+
+	if err := w.restoreQueue(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Notify ставит уведомление в очередь каждого webhook адреса.
+func (w *Webhook) Notify(alert alerts.Alert) {
+	n := Notification{
+		Rule:       alert.Name,
+		Metric:     alert.Metric,
+		MType:      alert.MType,
+		Value:      alert.Value,
+		State:      string(alert.State),
+		ActiveAt:   alert.ActiveAt,
+		FiredAt:    alert.FiredAt,
+		ResolvedAt: alert.ResolvedAt,
+		Timestamp:  time.Now(),
+	}
+
+	w.mu.Lock()
+	for _, url := range w.urls {
+		w.queues[url] = append(w.queues[url], item{URL: url, Notification: n})
+	}
+	w.mu.Unlock()
+	w.save()
+
+	for _, url := range w.urls {
+		select {
+		case w.wake[url] <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run отправляет уведомления из очередей всех адресов до отмены контекста.
+func (w *Webhook) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, url := range w.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, url)
+		}()
+	}
+	wg.Wait()
+}
+
+// run отправляет уведомления из очереди адреса url по порядку.
+func (w *Webhook) run(ctx context.Context, url string) {
+	for {
+		it, ok := w.front(url)
+		if !ok {
+			select {
+			case <-w.wake[url]:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := w.sendRetry(ctx, it)
+		if ctx.Err() != nil {
+			return
+		}
+		w.complete(url, err)
+
+		if errors.Is(err, errRetry) {
+			select {
+			case <-time.After(w.delays[len(w.delays)-1]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *Webhook) front(url string) (item, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.queues[url]) == 0 {
+		return item{}, false
+	}
+	return w.queues[url][0], true
+}
+
+// complete убирает первый элемент очереди адреса после попытки отправки.
+// При временной ошибке элемент переносится в конец очереди, пока не исчерпаны попытки.
+func (w *Webhook) complete(url string, err error) {
+	w.mu.Lock()
+	it := w.queues[url][0]
+	w.queues[url] = w.queues[url][1:]
+	if err != nil {
+		it.Attempts++
+		if errors.Is(err, errRetry) && it.Attempts < maxAttempts {
+			w.queues[url] = append(w.queues[url], it)
+		} else {
+			slog.Error(fmt.Sprintf("webhook %s: drop notification %s: %s", it.URL, it.Notification.Rule, err))
+		}
+	}
+	w.mu.Unlock()
+	w.save()
+}
+
+// sendRetry отправляет уведомление с повторами по аналогии с entities.Retry.
+func (w *Webhook) sendRetry(ctx context.Context, it item) error {
+	var err error
+	for _, delay := range w.delays {
+		if err = w.send(ctx, it); err == nil || !errors.Is(err, errRetry) {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (w *Webhook) send(ctx context.Context, it item) error {
+	data, err := json.Marshal(it.Notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, it.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secretKey != "" {
+		req.Header.Set("HashSHA256", hashing.GetHash(data, w.secretKey))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errRetry, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", errRetry, resp.StatusCode)
+	default:
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+}
+
+// Len возвращает количество уведомлений во всех очередях.
+func (w *Webhook) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := 0
+	for _, queue := range w.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+func (w *Webhook) restoreQueue() error {
+	data, err := os.ReadFile(w.filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var items []item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	dropped := 0
+	for _, it := range items {
+		if _, ok := w.queues[it.URL]; !ok {
+			dropped++
+			continue
+		}
+		w.queues[it.URL] = append(w.queues[it.URL], it)
+	}
+	if dropped > 0 {
+		slog.Warn(fmt.Sprintf("webhook: drop %d queued notifications for urls no longer configured", dropped))
+	}
+	return nil
+}
+
+// save записывает очереди в файл и протоколирует ошибку записи.
+func (w *Webhook) save() {
+	if err := w.saveQueue(); err != nil {
+		slog.Error(fmt.Sprintf("webhook save queue: %s", err))
+	}
+}
+
+// saveQueue записывает очереди во временный файл и переименовывает его.
+// Снимок очередей берется под mu, запись в файл - только под saveMu.
+func (w *Webhook) saveQueue() error {
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+
+	w.mu.Lock()
+	items := make([]item, 0)
+	for _, url := range w.urls {
+		items = append(items, w.queues[url]...)
+	}
+	data, err := json.Marshal(items)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := w.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.filename)
+}
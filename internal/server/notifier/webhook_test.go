@@ -0,0 +1,141 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/hashing"
+	"github.com/echo9et/alerting/internal/server/alerts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAlert() alerts.Alert {
+	value := 42.
+	now := time.Now()
+	return alerts.Alert{
+		Name:     "heap",
+		Metric:   "HeapAlloc",
+		MType:    "gauge",
+		State:    alerts.StateFiring,
+		Value:    &value,
+		ActiveAt: &now,
+		FiredAt:  &now,
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	const secretKey = "secret"
+	received := make(chan Notification, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, hashing.GetHash(body, secretKey), r.Header.Get("HashSHA256"))
+
+		var n Notification
+		require.NoError(t, json.Unmarshal(body, &n))
+		received <- n
+	}))
+	defer ts.Close()
+
+	w, err := NewWebhook([]string{ts.URL}, secretKey, filepath.Join(t.TempDir(), "queue.json"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	w.Notify(testAlert())
+
+	select {
+	case n := <-received:
+		assert.Equal(t, "heap", n.Rule)
+		assert.Equal(t, "HeapAlloc", n.Metric)
+		assert.Equal(t, "gauge", n.MType)
+		assert.Equal(t, "firing", n.State)
+		assert.Equal(t, 42., *n.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+	assert.Eventually(t, func() bool { return w.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	w, err := NewWebhook([]string{ts.URL}, "", filepath.Join(t.TempDir(), "queue.json"))
+	require.NoError(t, err)
+	w.delays = []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	w.Notify(testAlert())
+	assert.Eventually(t, func() bool { return w.Len() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWebhookQueueRestore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "queue.json")
+
+	w, err := NewWebhook([]string{"http://first", "http://second"}, "", filename)
+	require.NoError(t, err)
+	w.Notify(testAlert())
+	require.Equal(t, 2, w.Len())
+
+	// Уведомления для адреса, убранного из настроек, не восстанавливаются.
+	restored, err := NewWebhook([]string{"http://first"}, "", filename)
+	require.NoError(t, err)
+	require.Equal(t, 1, restored.Len())
+
+	it, ok := restored.front("http://first")
+	require.True(t, ok)
+	assert.Equal(t, "http://first", it.URL)
+	assert.Equal(t, "heap", it.Notification.Rule)
+}
+
+func TestWebhookDeadURL(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	received := make(chan struct{}, 2)
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer alive.Close()
+
+	w, err := NewWebhook([]string{dead.URL, alive.URL, alive.URL}, "", filepath.Join(t.TempDir(), "queue.json"))
+	require.NoError(t, err)
+	require.Equal(t, []string{dead.URL, alive.URL}, w.urls)
+	w.delays = []time.Duration{time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// Недоступный адрес повторяет отправку, уведомления на другой адрес приходят без задержки.
+	w.Notify(testAlert())
+	w.Notify(testAlert())
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+	assert.Eventually(t, func() bool { return w.Len() == 2 }, time.Second, 10*time.Millisecond)
+}
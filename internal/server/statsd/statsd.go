@@ -0,0 +1,262 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// maxPacketSize максимальный размер UDP пакета.
+const maxPacketSize = 65535
+
+var ErrInvalidLine = errors.New("statsd: invalid line")
+
+type gauge struct {
+	value    float64
+	relative bool
+}
+
+// timer значения таймера за интервал, count - количество измерений с учетом частоты выборки.
+type timer struct {
+	values []float64
+	count  float64
+}
+
+// Listener принимает метрики в формате StatsD по UDP, агрегирует их
+// в пределах интервала flush и записывает в хранилище.
+type Listener struct {
+	addr    string
+	flush   time.Duration
+	storage entities.Storage
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]gauge
+	timers   map[string]*timer
+	sets     map[string]map[string]struct{}
+}
+
+// NewListener конструктор StatsD listener.
+func NewListener(addr string, flush time.Duration, storage entities.Storage) *Listener {
+	return &Listener{
+		addr:     addr,
+		flush:    flush,
+		storage:  storage,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]gauge),
+		timers:   make(map[string]*timer),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+// ListenAndServe принимает пакеты до отмены контекста, при завершении записывает накопленные значения.
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(l.flush)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.Flush(); err != nil {
+					slog.Error(fmt.Sprintf("statsd flush: %s", err))
+				}
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	slog.Info("StatsD listener начал работу", "addr", conn.LocalAddr().String())
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return l.Flush()
+			}
+			return err
+		}
+		l.Handle(buf[:n])
+	}
+}
+
+// Handle разбирает пакет, строки с ошибками пропускаются.
+func (l *Listener) Handle(packet []byte) {
+	for _, line := range bytes.Split(packet, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := l.handleLine(string(line)); err != nil {
+			slog.Debug(err.Error())
+		}
+	}
+}
+
+// handleLine разбирает строку вида name:value|type[|@rate][|#tags].
+func (l *Listener) handleLine(line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	if err := entities.ValidateMetricID(name); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLine, err)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	sValue, mType := parts[0], parts[1]
+
+	rate := 1.
+	for _, part := range parts[2:] {
+		if r, ok := strings.CutPrefix(part, "@"); ok {
+			v, err := strconv.ParseFloat(r, 64)
+			if err != nil || v <= 0 || v > 1 {
+				return fmt.Errorf("%w: sample rate %q", ErrInvalidLine, line)
+			}
+			rate = v
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Значение set - произвольная строка, числом оно не является.
+	if mType == "s" {
+		if sValue == "" {
+			return fmt.Errorf("%w: value %q", ErrInvalidLine, line)
+		}
+		if l.sets[name] == nil {
+			l.sets[name] = make(map[string]struct{})
+		}
+		l.sets[name][sValue] = struct{}{}
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(sValue, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: value %q", ErrInvalidLine, line)
+	}
+
+	switch mType {
+	case "c":
+		l.counters[name] += value / rate
+	case "g":
+		if sValue[0] == '+' || sValue[0] == '-' {
+			g, ok := l.gauges[name]
+			if !ok {
+				g.relative = true
+			}
+			g.value += value
+			l.gauges[name] = g
+		} else {
+			l.gauges[name] = gauge{value: value}
+		}
+	case "ms", "h":
+		t, ok := l.timers[name]
+		if !ok {
+			t = &timer{}
+			l.timers[name] = t
+		}
+		t.values = append(t.values, value)
+		t.count += 1 / rate
+	default:
+		return fmt.Errorf("%w: type %q", ErrInvalidLine, line)
+	}
+	return nil
+}
+
+// Flush записывает накопленные за интервал значения в хранилище.
+// Таймеры сохраняются как gauge name.min, name.max, name.mean и counter name.count,
+// count учитывает частоту выборки так же, как counter,
+// значения set добавляются в одноименную метрику set.
+// Метрики, отклоненные хранилищем, не мешают записи остальных и возвращаются в общей ошибке.
+func (l *Listener) Flush() error {
+	l.mu.Lock()
+	counters, gauges, timers, sets := l.counters, l.gauges, l.timers, l.sets
+	l.counters = make(map[string]float64)
+	l.gauges = make(map[string]gauge)
+	l.timers = make(map[string]*timer)
+	l.sets = make(map[string]map[string]struct{})
+	l.mu.Unlock()
+
+	metrics := make([]entities.MetricsJSON, 0, len(counters)+len(gauges)+4*len(timers))
+	addGauge := func(name string, value float64) {
+		metrics = append(metrics, entities.MetricsJSON{ID: name, MType: entities.Gauge, Value: &value})
+	}
+	addCounter := func(name string, delta int64) {
+		metrics = append(metrics, entities.MetricsJSON{ID: name, MType: entities.Counter, Delta: &delta})
+	}
+
+	for name, value := range counters {
+		addCounter(name, int64(math.Round(value)))
+	}
+
+	for name, g := range gauges {
+		value := g.value
+		if g.relative {
+			if current, ok := l.storage.GetGauge(name); ok {
+				base, err := strconv.ParseFloat(strings.TrimSpace(current), 64)
+				if err == nil {
+					value += base
+				}
+			}
+		}
+		addGauge(name, value)
+	}
+
+	for name, t := range timers {
+		values := t.values
+		min, max, sum := values[0], values[0], 0.
+		for _, v := range values {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+			sum += v
+		}
+		addGauge(name+".min", min)
+		addGauge(name+".max", max)
+		addGauge(name+".mean", sum/float64(len(values)))
+		addCounter(name+".count", int64(math.Round(t.count)))
+	}
+
+	for name, members := range sets {
+		metric := entities.MetricsJSON{ID: name, MType: entities.Set, Members: make([]string, 0, len(members))}
+		for member := range members {
+			metric.Members = append(metric.Members, member)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+	rejected, err := entities.UpdatePartial(context.Background(), l.storage, metrics)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0, len(rejected))
+	for i := range metrics {
+		if err, ok := rejected[i]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
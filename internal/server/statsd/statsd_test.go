@@ -0,0 +1,156 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/echo9et/alerting/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{name: "counter", line: "requests:1|c"},
+		{name: "counter with rate", line: "requests:1|c|@0.5"},
+		{name: "gauge", line: "temperature:21.5|g"},
+		{name: "relative gauge", line: "temperature:-1|g"},
+		{name: "timer with tags", line: "latency:320|ms|#host:a"},
+		{name: "sampled timer", line: "latency:320|ms|@0.1"},
+		{name: "no value", line: "requests|c", wantErr: true},
+		{name: "no type", line: "requests:1", wantErr: true},
+		{name: "bad value", line: "requests:x|c", wantErr: true},
+		{name: "bad rate", line: "requests:1|c|@2", wantErr: true},
+		{name: "set", line: "users:bob|s"},
+		{name: "empty set member", line: "users:|s", wantErr: true},
+		{name: "unsupported type", line: "users:1|x", wantErr: true},
+		{name: "labels in name", line: `requests{host="x"}:1|c`, wantErr: true},
+	}
+
+	l := NewListener("", time.Second, storage.NewMemStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.handleLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetGauge("queue", 10)
+	l := NewListener("", time.Second, s)
+
+	l.Handle([]byte("requests:1|c\nrequests:2|c|@0.5\ntemperature:20|g\ntemperature:+2|g\nqueue:-3|g\n" +
+		"latency:100|ms\nlatency:300|ms\nbroken\n" +
+		"sampled:50|ms|@0.1\nsampled:150|ms|@0.1\nsampled:100|h|@0.5\n"))
+	require.NoError(t, l.Flush())
+
+	tests := []struct {
+		name    string
+		counter bool
+		want    string
+	}{
+		{name: "requests", counter: true, want: "5"},
+		{name: "temperature", want: "22"},
+		{name: "queue", want: "7"},
+		{name: "latency.min", want: "100"},
+		{name: "latency.max", want: "300"},
+		{name: "latency.mean", want: "200"},
+		{name: "latency.count", counter: true, want: "2"},
+		{name: "sampled.mean", want: "100"},
+		{name: "sampled.count", counter: true, want: "22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v string
+			var ok bool
+			if tt.counter {
+				v, ok = s.GetCounter(tt.name)
+			} else {
+				v, ok = s.GetGauge(tt.name)
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+
+	// Значения агрегируются только в пределах интервала.
+	l.Handle([]byte("requests:1|c"))
+	require.NoError(t, l.Flush())
+	v, _ := s.GetCounter("requests")
+	assert.Equal(t, "6", v)
+}
+
+func TestFlushRejected(t *testing.T) {
+	s := storage.NewMemStore()
+	s.SetGauge("requests", 1)
+	l := NewListener("", time.Second, s)
+
+	// Counter, записанный ранее как gauge, отклоняется, остальные метрики интервала сохраняются.
+	l.Handle([]byte("requests:1|c\ntemperature:20|g\nlatency:100|ms\n"))
+	assert.ErrorIs(t, l.Flush(), entities.ErrTypeMismatch)
+
+	v, _ := s.GetGauge("temperature")
+	assert.Equal(t, "20", v)
+	v, _ = s.GetCounter("latency.count")
+	assert.Equal(t, "1", v)
+	_, ok := s.GetCounter("requests")
+	assert.False(t, ok)
+}
+
+func TestFlushSet(t *testing.T) {
+	s := storage.NewMemStore()
+	l := NewListener("", time.Second, s)
+
+	l.Handle([]byte("users:alice|s\nusers:bob|s\nusers:alice|s\n"))
+	require.NoError(t, l.Flush())
+	l.Handle([]byte("users:bob|s\nusers:carol|s\n"))
+	require.NoError(t, l.Flush())
+
+	metric, ok := s.GetMetric(entities.Set, "users")
+	require.True(t, ok)
+	assert.Equal(t, uint64(3), metric.Set.Cardinality())
+}
+
+func TestListenAndServe(t *testing.T) {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	probe, err := net.ListenUDP("udp", addr)
+	require.NoError(t, err)
+	listenAddr := probe.LocalAddr().String()
+	probe.Close()
+
+	s := storage.NewMemStore()
+	l := NewListener(listenAddr, time.Hour, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.ListenAndServe(ctx) }()
+
+	conn, err := net.Dial("udp", listenAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Eventually(t, func() bool {
+		conn.Write([]byte("hits:1|c"))
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.counters["hits"] > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	_, ok := s.GetCounter("hits")
+	assert.True(t, ok)
+}
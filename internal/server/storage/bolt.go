@@ -0,0 +1,744 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout ожидание блокировки файла базы, занятого другим процессом.
+const boltOpenTimeout = time.Second
+
+// Бакеты верхнего уровня базы bbolt.
+var (
+	// bucketMetrics текущие значения: metrics/<тип>/<ключ серии>.
+	bucketMetrics = []byte("metrics")
+	// bucketTotals последние накопленные значения counter, переданные с Total: totals/<ключ серии>.
+	bucketTotals = []byte("totals")
+	// bucketSamples сырая история: samples/<тип>/<ключ серии>/<время><номер>.
+	bucketSamples = []byte("samples")
+	// bucketRollups агрегированная история: rollups/<интервал>/<тип>/<ключ серии>/<время>.
+	bucketRollups = []byte("rollups")
+	// bucketWatermarks граница уже агрегированных данных: watermarks/<интервал>.
+	bucketWatermarks = []byte("watermarks")
+)
+
+// Bolt хранилище метрик во встраиваемой базе bbolt в одном файле.
+// Подходит для небольших площадок, где нужна сохранность данных без отдельного сервера базы.
+// Как и в Base, у каждого типа свои серии. Пакет SetMetrics проверяется и записывается
+// в одной транзакции, поэтому применяется либо целиком, либо не применяется совсем.
+// Ошибки открытия и фиксации транзакций, закрытая база и отмена контекста
+// возвращаются как entities.ErrUnavailable.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// NewBolt открывает файл базы path, создавая его при отсутствии.
+func NewBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketMetrics, bucketTotals, bucketSamples, bucketRollups, bucketWatermarks} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init bolt %s: %w", path, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Close закрывает файл базы.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// view выполняет fn в транзакции чтения. Ошибки fn возвращаются как есть,
+// ошибки самой базы - как ErrUnavailable.
+func (b *Bolt) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	var fnErr error
+	err := b.db.View(func(tx *bolt.Tx) error {
+		fnErr = fn(tx)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return unavailable(err)
+}
+
+// update выполняет fn в транзакции записи, при ошибке fn транзакция откатывается.
+// Ошибки fn возвращаются как есть, ошибки открытия и фиксации транзакции - как ErrUnavailable.
+func (b *Bolt) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	var fnErr error
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		fnErr = fn(tx)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return unavailable(err)
+}
+
+// Ping проверяет, что база открыта.
+func (b *Bolt) Ping() bool {
+	return b.Check(context.Background()) == nil
+}
+
+// Check проверяет, что база открыта.
+func (b *Bolt) Check(ctx context.Context) error {
+	return b.view(ctx, func(tx *bolt.Tx) error { return nil })
+}
+
+// GetCounter значение counter в том же виде, что и в MemStore.
+func (b *Bolt) GetCounter(name string) (string, bool) {
+	value, err := b.Counter(context.Background(), name)
+	if err != nil {
+		logBoltError("GetCounter", err)
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// Counter значение counter, ErrNotFound если серии нет.
+func (b *Bolt) Counter(ctx context.Context, name string) (int64, error) {
+	m, err := b.Metric(ctx, entities.Counter, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Delta, nil
+}
+
+func (b *Bolt) SetCounter(name string, iValue int64) {
+	logBoltError("SetCounter", b.UpdateCounter(context.Background(), name, iValue))
+}
+
+// UpdateCounter добавляет приращение counter.
+func (b *Bolt) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	id, labels := entities.ParseSeriesKey(name)
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		return applyMetric(tx, name, entities.MetricsJSON{ID: id, MType: entities.Counter, Labels: labels, Delta: &delta})
+	})
+}
+
+// GetGauge значение gauge в том же виде, что и в MemStore.
+func (b *Bolt) GetGauge(name string) (string, bool) {
+	value, err := b.Gauge(context.Background(), name)
+	if err != nil {
+		logBoltError("GetGauge", err)
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// Gauge значение gauge, ErrNotFound если серии нет.
+func (b *Bolt) Gauge(ctx context.Context, name string) (float64, error) {
+	m, err := b.Metric(ctx, entities.Gauge, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Value, nil
+}
+
+func (b *Bolt) SetGauge(name string, fValue float64) {
+	logBoltError("SetGauge", b.UpdateGauge(context.Background(), name, fValue))
+}
+
+// UpdateGauge сохраняет значение gauge.
+func (b *Bolt) UpdateGauge(ctx context.Context, name string, value float64) error {
+	id, labels := entities.ParseSeriesKey(name)
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		return applyMetric(tx, name, entities.MetricsJSON{ID: id, MType: entities.Gauge, Labels: labels, Value: &value})
+	})
+}
+
+// GetMetric возвращает метрику типа mType по ключу серии.
+func (b *Bolt) GetMetric(mType, name string) (entities.MetricsJSON, bool) {
+	m, err := b.Metric(context.Background(), mType, name)
+	if err != nil {
+		logBoltError("GetMetric", err)
+		return entities.MetricsJSON{}, false
+	}
+	return m, true
+}
+
+// Metric возвращает метрику типа mType по ключу серии, ErrNotFound если серии нет.
+func (b *Bolt) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	var m entities.MetricsJSON
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		var ok bool
+		var err error
+		m, ok, err = getMetric(tx, mType, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s %s", entities.ErrNotFound, mType, name)
+		}
+		return nil
+	})
+	return m, err
+}
+
+// AllMetrics возвращает значения всех метрик по ключу серии.
+func (b *Bolt) AllMetrics() map[string]string {
+	out := make(map[string]string)
+	for _, m := range b.AllMetricsJSON() {
+		out[m.Key()] = m.FormatValue()
+	}
+	return out
+}
+
+// AllMetricsJSON возвращает согласованный снимок всех метрик.
+func (b *Bolt) AllMetricsJSON() []entities.MetricsJSON {
+	metrics, err := b.Metrics(context.Background())
+	if err != nil {
+		slog.Error(fmt.Sprintf("AllMetricsJSON: %s", err))
+		return make([]entities.MetricsJSON, 0)
+	}
+	return metrics
+}
+
+// Metrics возвращает согласованный снимок всех метрик.
+func (b *Bolt) Metrics(ctx context.Context) ([]entities.MetricsJSON, error) {
+	out := make([]entities.MetricsJSON, 0)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMetrics).ForEachBucket(func(mType []byte) error {
+			return tx.Bucket(bucketMetrics).Bucket(mType).ForEach(func(_, v []byte) error {
+				m, err := decodeMetric(string(mType), v)
+				if err != nil {
+					return err
+				}
+				out = append(out, m)
+				return nil
+			})
+		})
+	})
+	return out, err
+}
+
+// SetMetrics записывает пакет метрик в одной транзакции.
+func (b *Bolt) SetMetrics(metrics []entities.MetricsJSON) error {
+	return b.UpdateMetrics(context.Background(), metrics)
+}
+
+// UpdateMetrics проверяет пакет метрик и записывает его в одной транзакции:
+// при некорректной метрике или несовпадении параметров скетчей пакет не применяется.
+func (b *Bolt) UpdateMetrics(ctx context.Context, metrics []entities.MetricsJSON) error {
+	for _, v := range metrics {
+		if err := validateMetric(v); err != nil {
+			return err
+		}
+	}
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		for _, v := range metrics {
+			if err := applyMetric(tx, v.Key(), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyMetric применяет проверенную метрику v к серии key в транзакции записи.
+// Для gauge и counter значение дописывается в историю.
+func applyMetric(tx *bolt.Tx, key string, v entities.MetricsJSON) error {
+	current, exists, err := getMetric(tx, v.MType, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := checkType(tx, key, v.MType); err != nil {
+			return err
+		}
+		current = entities.MetricsJSON{ID: v.ID, MType: v.MType, Labels: v.Labels}
+	}
+	now := time.Now()
+
+	switch v.MType {
+	case entities.Gauge:
+		current.Value = v.Value
+		if err := putMetric(tx, key, current); err != nil {
+			return err
+		}
+		return addSample(tx, entities.Gauge, key, entities.Sample{Timestamp: now, Value: *v.Value})
+	case entities.Counter:
+		delta, err := counterDelta(tx, key, v)
+		if err != nil {
+			return err
+		}
+		value := delta
+		if exists {
+			value += *current.Delta
+		}
+		current.Delta = &value
+		if err := putMetric(tx, key, current); err != nil {
+			return err
+		}
+		sum := float64(delta)
+		return addSample(tx, entities.Counter, key, entities.Sample{Timestamp: now, Value: float64(value), Sum: &sum})
+	case entities.Histogram:
+		if !exists {
+			current.Histogram = v.Histogram.Clone()
+		} else if err := current.Histogram.Merge(*v.Histogram); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	case entities.Summary:
+		if !exists {
+			current.Summary = v.Summary.Clone()
+		} else if err := current.Summary.Merge(*v.Summary); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	case entities.Set:
+		if !exists {
+			current.Set = entities.NewSet(entities.DefaultSetPrecision)
+			if v.Set != nil {
+				current.Set = entities.NewSet(v.Set.Precision)
+			}
+		}
+		if v.Set != nil {
+			if err := current.Set.Merge(*v.Set); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		for _, member := range v.Members {
+			current.Set.Add(member)
+		}
+	}
+	return putMetric(tx, key, current)
+}
+
+// checkType возвращает ErrTypeMismatch, если серия key сохранена в бакете другого типа.
+func checkType(tx *bolt.Tx, key, mType string) error {
+	return tx.Bucket(bucketMetrics).ForEachBucket(func(stored []byte) error {
+		if string(stored) != mType && tx.Bucket(bucketMetrics).Bucket(stored).Get([]byte(key)) != nil {
+			return fmt.Errorf("%w: %s is stored as %s, not %s", entities.ErrTypeMismatch, key, stored, mType)
+		}
+		return nil
+	})
+}
+
+// counterDelta приращение counter с учетом сохраненного накопленного значения, новое Total запоминается.
+func counterDelta(tx *bolt.Tx, key string, v entities.MetricsJSON) (int64, error) {
+	totals := tx.Bucket(bucketTotals)
+	var last int64
+	stored := totals.Get([]byte(key))
+	if stored != nil {
+		last = int64(binary.BigEndian.Uint64(stored))
+	}
+
+	delta, err := v.CounterDelta(last, stored != nil)
+	if err != nil || v.Total == nil {
+		return delta, err
+	}
+	if stored != nil && *v.Total < last {
+		slog.Info("counter reset", "key", key, "total", *v.Total, "last", last)
+	}
+	return delta, totals.Put([]byte(key), binary.BigEndian.AppendUint64(nil, uint64(*v.Total)))
+}
+
+// getMetric читает метрику типа mType по ключу серии.
+func getMetric(tx *bolt.Tx, mType, key string) (entities.MetricsJSON, bool, error) {
+	metrics := tx.Bucket(bucketMetrics).Bucket([]byte(mType))
+	if metrics == nil {
+		return entities.MetricsJSON{}, false, nil
+	}
+	data := metrics.Get([]byte(key))
+	if data == nil {
+		return entities.MetricsJSON{}, false, nil
+	}
+	m, err := decodeMetric(mType, data)
+	return m, err == nil, err
+}
+
+// boltMetric сохраняемое значение метрики, тип задается бакетом.
+// Используется gob, а не JSON, чтобы сохранять NaN и бесконечности gauge. Значения gauge и counter
+// хранятся не указателями: gob не передает указатель на нулевое значение.
+type boltMetric struct {
+	ID        string
+	Labels    map[string]string
+	Value     float64
+	Delta     int64
+	Histogram *entities.HistogramData
+	Summary   *entities.SummaryData
+	Set       *entities.SetData
+}
+
+// putMetric сохраняет текущее значение метрики.
+func putMetric(tx *bolt.Tx, key string, m entities.MetricsJSON) error {
+	metrics, err := tx.Bucket(bucketMetrics).CreateBucketIfNotExists([]byte(m.MType))
+	if err != nil {
+		return err
+	}
+
+	stored := boltMetric{ID: m.ID, Labels: m.Labels, Histogram: m.Histogram, Summary: m.Summary, Set: m.Set}
+	if m.Value != nil {
+		stored.Value = *m.Value
+	}
+	if m.Delta != nil {
+		stored.Delta = *m.Delta
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(stored); err != nil {
+		return err
+	}
+	return metrics.Put([]byte(key), buf.Bytes())
+}
+
+// decodeMetric декодирует метрику типа mType, сохраненную putMetric.
+func decodeMetric(mType string, data []byte) (entities.MetricsJSON, error) {
+	var stored boltMetric
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stored); err != nil {
+		return entities.MetricsJSON{}, fmt.Errorf("decode %s metric: %w", mType, err)
+	}
+
+	m := entities.MetricsJSON{ID: stored.ID, MType: mType, Labels: stored.Labels, Histogram: stored.Histogram, Summary: stored.Summary, Set: stored.Set}
+	switch mType {
+	case entities.Gauge:
+		m.Value = &stored.Value
+	case entities.Counter:
+		m.Delta = &stored.Delta
+	}
+	return m, nil
+}
+
+// addSample дописывает значение в историю серии. К времени в ключе добавляется
+// порядковый номер, чтобы значения с одинаковым временем не перезаписывали друг друга.
+func addSample(tx *bolt.Tx, mType, key string, sample entities.Sample) error {
+	series, err := createBuckets(tx.Bucket(bucketSamples), []byte(mType), []byte(key))
+	if err != nil {
+		return err
+	}
+	seq, err := series.NextSequence()
+	if err != nil {
+		return err
+	}
+	return series.Put(binary.BigEndian.AppendUint64(timeKey(sample.Timestamp), seq), encodeSample(sample))
+}
+
+// createBuckets возвращает вложенный бакет по пути names, создавая отсутствующие.
+func createBuckets(b *bolt.Bucket, names ...[]byte) (*bolt.Bucket, error) {
+	for _, name := range names {
+		var err error
+		if b, err = b.CreateBucketIfNotExists(name); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// lookupBuckets возвращает вложенный бакет по пути names или nil, если его нет.
+func lookupBuckets(b *bolt.Bucket, names ...[]byte) *bolt.Bucket {
+	for _, name := range names {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// timeKey время в наносекундах big-endian: порядок ключей совпадает с порядком времени.
+// Время до 1970 года приводится к нулю.
+func timeKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(max(t.UnixNano(), 0)))
+}
+
+// durationKey ключ уровня агрегации: интервал в секундах big-endian, уровни упорядочены по возрастанию.
+func durationKey(d time.Duration) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(d/time.Second))
+}
+
+// Флаги заполненных полей значения истории.
+const (
+	sampleMin byte = 1 << iota
+	sampleMax
+	sampleCount
+	sampleSum
+)
+
+// encodeSample кодирует значение истории: время в наносекундах, флаги заполненных полей,
+// value и заполненные min, max, count, sum по 8 байт.
+func encodeSample(s entities.Sample) []byte {
+	var flags byte
+	out := make([]byte, 9, 49)
+	binary.BigEndian.PutUint64(out, uint64(s.Timestamp.UnixNano()))
+	out = binary.BigEndian.AppendUint64(out, math.Float64bits(s.Value))
+	if s.Min != nil {
+		flags |= sampleMin
+		out = binary.BigEndian.AppendUint64(out, math.Float64bits(*s.Min))
+	}
+	if s.Max != nil {
+		flags |= sampleMax
+		out = binary.BigEndian.AppendUint64(out, math.Float64bits(*s.Max))
+	}
+	if s.Count != 0 {
+		flags |= sampleCount
+		out = binary.BigEndian.AppendUint64(out, uint64(s.Count))
+	}
+	if s.Sum != nil {
+		flags |= sampleSum
+		out = binary.BigEndian.AppendUint64(out, math.Float64bits(*s.Sum))
+	}
+	out[8] = flags
+	return out
+}
+
+// errInvalidSample значение истории повреждено.
+var errInvalidSample = errors.New("invalid sample")
+
+// decodeSample декодирует значение истории, закодированное encodeSample.
+func decodeSample(data []byte) (entities.Sample, error) {
+	var s entities.Sample
+	if len(data) < 17 {
+		return s, errInvalidSample
+	}
+	s.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	flags := data[8]
+	s.Value = math.Float64frombits(binary.BigEndian.Uint64(data[9:]))
+	data = data[17:]
+
+	next := func() (uint64, bool) {
+		if len(data) < 8 {
+			return 0, false
+		}
+		v := binary.BigEndian.Uint64(data)
+		data = data[8:]
+		return v, true
+	}
+	float := func(flag byte) (*float64, error) {
+		if flags&flag == 0 {
+			return nil, nil
+		}
+		v, ok := next()
+		if !ok {
+			return nil, errInvalidSample
+		}
+		f := math.Float64frombits(v)
+		return &f, nil
+	}
+
+	var err error
+	if s.Min, err = float(sampleMin); err != nil {
+		return s, err
+	}
+	if s.Max, err = float(sampleMax); err != nil {
+		return s, err
+	}
+	if flags&sampleCount != 0 {
+		v, ok := next()
+		if !ok {
+			return s, errInvalidSample
+		}
+		s.Count = int64(v)
+	}
+	s.Sum, err = float(sampleSum)
+	return s, err
+}
+
+// samplesBetween значения серии в интервале [from, to] в порядке времени.
+func samplesBetween(series *bolt.Bucket, from, to time.Time) ([]entities.Sample, error) {
+	out := make([]entities.Sample, 0)
+	end := timeKey(to)
+	c := series.Cursor()
+	for k, v := c.Seek(timeKey(from)); k != nil && bytes.Compare(k[:8], end) <= 0; k, v = c.Next() {
+		sample, err := decodeSample(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sample)
+	}
+	return out, nil
+}
+
+// oldestSample время первого значения серии.
+func oldestSample(series *bolt.Bucket) (time.Time, bool) {
+	k, _ := series.Cursor().First()
+	if k == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k))), true
+}
+
+// Range возвращает историю значений метрики в интервале [from, to].
+func (b *Bolt) Range(mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return b.History(context.Background(), mType, name, from, to)
+}
+
+// History возвращает историю значений метрики в интервале [from, to].
+// Для интервала, уже удаленного из сырых значений, отдаются агрегированные значения.
+func (b *Bolt) History(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	out := make([]entities.Sample, 0)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		cutoff := to.Add(time.Nanosecond)
+		if series := lookupBuckets(tx.Bucket(bucketSamples), []byte(mType), []byte(name)); series != nil {
+			samples, err := samplesBetween(series, from, to)
+			if err != nil {
+				return err
+			}
+			out = samples
+			if oldest, ok := oldestSample(series); ok {
+				cutoff = oldest
+			}
+		}
+
+		// Уровни перебираются от меньшего интервала к большему.
+		c := tx.Bucket(bucketRollups).Cursor()
+		for k, _ := c.First(); k != nil && cutoff.After(from); k, _ = c.Next() {
+			resolution := time.Duration(binary.BigEndian.Uint64(k)) * time.Second
+			series := lookupBuckets(tx.Bucket(bucketRollups), k, []byte(mType), []byte(name))
+			if series == nil {
+				continue
+			}
+			samples, err := samplesBetween(series, from, to)
+			if err != nil {
+				return err
+			}
+			older := make([]entities.Sample, 0)
+			for _, sample := range samples {
+				// Значение уровня попадает в ответ, только если его интервал целиком раньше cutoff.
+				if !sample.Timestamp.Add(resolution).After(cutoff) {
+					older = append(older, sample)
+				}
+			}
+			out = append(older, out...)
+			if oldest, ok := oldestSample(series); ok && oldest.Before(cutoff) {
+				cutoff = oldest
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Compact агрегирует историю по уровням политики и удаляет устаревшие значения в одной транзакции.
+func (b *Bolt) Compact(ctx context.Context, now time.Time, retention Retention) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		source := tx.Bucket(bucketSamples)
+		watermarks := tx.Bucket(bucketWatermarks)
+		for _, t := range retention.Tiers {
+			level := durationKey(t.Resolution)
+			target, err := tx.Bucket(bucketRollups).CreateBucketIfNotExists(level)
+			if err != nil {
+				return err
+			}
+
+			var watermark time.Time
+			if v := watermarks.Get(level); v != nil {
+				watermark = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			}
+			complete := now.Truncate(t.Resolution)
+			if complete.After(watermark) {
+				err := eachSeries(source, func(mType, key []byte, series *bolt.Bucket) error {
+					pending, err := samplesBetween(series, watermark, complete.Add(-time.Nanosecond))
+					if err != nil || len(pending) == 0 {
+						return err
+					}
+					rollups, err := createBuckets(target, mType, key)
+					if err != nil {
+						return err
+					}
+					for _, sample := range rollupSamples(pending, string(mType), t.Resolution) {
+						if err := rollups.Put(timeKey(sample.Timestamp), encodeSample(sample)); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if err := watermarks.Put(level, timeKey(complete)); err != nil {
+					return err
+				}
+			}
+			source = target
+		}
+
+		if err := deleteBefore(tx.Bucket(bucketSamples), now.Add(-retention.Raw)); err != nil {
+			return err
+		}
+		for _, t := range retention.Tiers {
+			if err := deleteBefore(tx.Bucket(bucketRollups).Bucket(durationKey(t.Resolution)), now.Add(-t.Keep)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// eachSeries вызывает fn для каждой серии бакета истории вида <тип>/<ключ серии>.
+func eachSeries(root *bolt.Bucket, fn func(mType, key []byte, series *bolt.Bucket) error) error {
+	return root.ForEachBucket(func(mType []byte) error {
+		types := root.Bucket(mType)
+		return types.ForEachBucket(func(key []byte) error {
+			return fn(mType, key, types.Bucket(key))
+		})
+	})
+}
+
+// deleteBefore удаляет значения истории раньше before, опустевшие серии удаляются.
+func deleteBefore(root *bolt.Bucket, before time.Time) error {
+	type emptySeries struct {
+		types *bolt.Bucket
+		key   []byte
+	}
+	var empty []emptySeries
+
+	end := timeKey(before)
+	err := eachSeries(root, func(mType, key []byte, series *bolt.Bucket) error {
+		var expired [][]byte
+		c := series.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.Next() {
+			expired = append(expired, bytes.Clone(k))
+		}
+		for _, k := range expired {
+			if err := series.Delete(k); err != nil {
+				return err
+			}
+		}
+		if k, _ := series.Cursor().First(); k == nil {
+			empty = append(empty, emptySeries{types: root.Bucket(mType), key: bytes.Clone(key)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range empty {
+		if err := s.types.DeleteBucket(s.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logBoltError протоколирует ошибку методов без возврата ошибки, отсутствие серии не протоколируется.
+func logBoltError(method string, err error) {
+	if err != nil && !errors.Is(err, entities.ErrNotFound) {
+		slog.Error(fmt.Sprintf("%s: %s", method, err))
+	}
+}
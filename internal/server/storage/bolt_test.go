@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	b, err := NewBolt(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	total := int64(100)
+	h := entities.NewHistogram([]float64{1})
+	h.Observe(2)
+	require.NoError(t, b.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "zero", MType: entities.Gauge, Value: new(float64)},
+		{ID: "Mallocs", MType: entities.Counter, Total: &total, Labels: map[string]string{"host": "a"}},
+		{ID: "latency", MType: entities.Histogram, Histogram: h},
+		{ID: "users", MType: entities.Set, Members: []string{"a", "b"}},
+	}))
+	require.NoError(t, b.UpdateGauge(ctx, "nan", math.NaN()))
+	require.NoError(t, b.Close())
+
+	b, err = NewBolt(path)
+	require.NoError(t, err)
+	defer b.Close()
+
+	zero, err := b.Gauge(ctx, "zero")
+	require.NoError(t, err)
+	assert.Equal(t, 0., zero)
+	nan, err := b.Gauge(ctx, "nan")
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(nan))
+
+	m, err := b.Metric(ctx, entities.Histogram, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1}, m.Histogram.Counts)
+	m, err = b.Metric(ctx, entities.Set, "users")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), m.Set.Cardinality())
+
+	// Накопленное значение counter сохраняется, повторная отправка того же Total дает 0.
+	require.NoError(t, b.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "Mallocs", MType: entities.Counter, Total: &total, Labels: map[string]string{"host": "a"}},
+	}))
+	counter, err := b.Counter(ctx, `Mallocs{host="a"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), counter)
+}
+
+func TestBoltCompact(t *testing.T) {
+	retention, err := ParseRetention("raw:1h,1m:2h,1h:24h")
+	require.NoError(t, err)
+
+	b, err := NewBolt(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer b.Close()
+
+	b.SetGauge("g", 1)
+	b.SetGauge("g", 3)
+	b.SetCounter("c", 2)
+	b.SetCounter("c", 5)
+	created := time.Now()
+
+	now := created.Add(90 * time.Minute)
+
+	// Отмененное сжатие не изменяет историю.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, b.Compact(canceled, now, retention), entities.ErrUnavailable)
+	gauges, err := b.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+
+	require.NoError(t, b.Compact(context.Background(), now, retention))
+
+	gauges, err = b.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 1)
+	assert.Equal(t, 2., gauges[0].Value)
+	assert.Equal(t, int64(2), gauges[0].Count)
+
+	counters, err := b.Range(entities.Counter, "c", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, counters, 1)
+	assert.Equal(t, 7., counters[0].Value)
+	assert.Equal(t, 7., *counters[0].Sum)
+
+	now = created.Add(3 * time.Hour)
+	require.NoError(t, b.Compact(context.Background(), now, retention))
+
+	gauges, err = b.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 1)
+	assert.True(t, created.Truncate(time.Hour).Equal(gauges[0].Timestamp))
+	assert.Equal(t, 2., gauges[0].Value)
+	assert.Equal(t, 1., *gauges[0].Min)
+	assert.Equal(t, 3., *gauges[0].Max)
+
+	// Текущие значения не зависят от удаления истории.
+	v, ok := b.GetGauge("g")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+}
+
+func TestBoltBatchRollback(t *testing.T) {
+	b, err := NewBolt(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer b.Close()
+
+	ctx := context.Background()
+	require.NoError(t, b.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{1})},
+	}))
+
+	// Несовпадение границ обнаруживается внутри транзакции, уже записанный gauge откатывается.
+	value := 1.
+	err = b.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "load", MType: entities.Gauge, Value: &value},
+		{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{5})},
+	})
+	assert.ErrorIs(t, err, entities.ErrBoundsMismatch)
+	assert.NotErrorIs(t, err, entities.ErrUnavailable)
+
+	_, err = b.Gauge(ctx, "load")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+	samples, err := b.History(ctx, entities.Gauge, "load", time.Now().Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestBoltClosed(t *testing.T) {
+	b, err := NewBolt(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	ctx := context.Background()
+	assert.ErrorIs(t, b.UpdateGauge(ctx, "load", 1), entities.ErrUnavailable)
+	_, err = b.Gauge(ctx, "load")
+	assert.ErrorIs(t, err, entities.ErrUnavailable)
+	assert.ErrorIs(t, b.Check(ctx), entities.ErrUnavailable)
+	assert.False(t, b.Ping())
+}
+
+func TestSampleEncoding(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name   string
+		sample entities.Sample
+	}{
+		{name: "gauge", sample: entities.Sample{Timestamp: time.Unix(600, 5), Value: 1.5}},
+		{name: "counter", sample: entities.Sample{Timestamp: time.Unix(600, 0), Value: 7, Sum: value(0)}},
+		{name: "rollup", sample: entities.Sample{Timestamp: time.Unix(3600, 0), Value: 2, Min: value(-1), Max: value(math.Inf(1)), Count: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeSample(encodeSample(tt.sample))
+			require.NoError(t, err)
+			assert.Equal(t, tt.sample, got)
+		})
+	}
+
+	_, err := decodeSample(encodeSample(tests[2].sample)[:30])
+	assert.ErrorIs(t, err, errInvalidSample)
+}
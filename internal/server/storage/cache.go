@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// Cache хранилище, кэширующее в памяти текущие значения gauge и counter из Store.
+// Записи сразу передаются в Store, после чего затронутые серии удаляются из кэша,
+// поэтому запись через Cache видна следующему чтению. Изменения, сделанные в Store
+// в обход Cache (например, другим экземпляром сервера), становятся видны не позже чем через ttl.
+// Остальные типы метрик и история читаются из Store напрямую.
+type Cache struct {
+	Store entities.Storage
+	ttl   time.Duration
+	size  int
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// loading чтения из Store, начатые до появления значения в кэше. Запись серии во время
+	// чтения помечает его устаревшим, и прочитанное значение не попадает в кэш.
+	loading map[cacheKey]*cacheLoad
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CacheOptions настройки Cache.
+type CacheOptions struct {
+	// TTL время, через которое значение перечитывается из Store.
+	TTL time.Duration
+	// Size максимальное количество серий в кэше, 0 - без ограничения.
+	Size int
+}
+
+type cacheKey struct {
+	mType string
+	name  string
+}
+
+type cacheEntry struct {
+	metric  entities.MetricsJSON
+	expires time.Time
+}
+
+type cacheLoad struct {
+	readers int
+	stale   bool
+}
+
+func NewCache(store entities.Storage, options CacheOptions) *Cache {
+	return &Cache{
+		Store:   store,
+		ttl:     options.TTL,
+		size:    options.Size,
+		entries: make(map[cacheKey]cacheEntry),
+		loading: make(map[cacheKey]*cacheLoad),
+	}
+}
+
+// Stats количество попаданий и промахов с момента создания кэша.
+func (c *Cache) Stats() entities.CacheStats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+	return entities.CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+// cached типы метрик, значения которых хранятся в кэше.
+func cached(mType string) bool {
+	return mType == entities.Gauge || mType == entities.Counter
+}
+
+func (c *Cache) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	if !cached(mType) {
+		return c.Store.Metric(ctx, mType, name)
+	}
+
+	key := cacheKey{mType: mType, name: name}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return cloneValue(entry.metric), nil
+	}
+	load := c.loading[key]
+	if load == nil {
+		load = &cacheLoad{}
+		c.loading[key] = load
+	}
+	load.readers++
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	m, err := c.Store.Metric(ctx, mType, name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if load.readers--; load.readers == 0 {
+		delete(c.loading, key)
+	}
+	if err != nil || load.stale {
+		return m, err
+	}
+	c.put(key, m)
+	return cloneValue(m), nil
+}
+
+// put сохраняет значение серии, при заполненном кэше вытесняет устаревшие значения,
+// а если их нет - произвольную серию. Вызывается под mu.
+func (c *Cache) put(key cacheKey, m entities.MetricsJSON) {
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && c.size > 0 && len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{metric: m, expires: now.Add(c.ttl)}
+}
+
+// invalidate удаляет серии из кэша и помечает устаревшими идущие по ним чтения.
+func (c *Cache) invalidate(keys ...cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+		if load := c.loading[key]; load != nil {
+			load.stale = true
+		}
+	}
+}
+
+// invalidateMetrics удаляет из кэша gauge и counter пакета.
+func (c *Cache) invalidateMetrics(metrics []entities.MetricsJSON) {
+	keys := make([]cacheKey, 0, len(metrics))
+	for _, m := range metrics {
+		if cached(m.MType) {
+			keys = append(keys, cacheKey{mType: m.MType, name: m.Key()})
+		}
+	}
+	c.invalidate(keys...)
+}
+
+// cloneValue копия значения из кэша, изменения которой не затрагивают кэш.
+func cloneValue(m entities.MetricsJSON) entities.MetricsJSON {
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+	m.Labels = maps.Clone(m.Labels)
+	return m
+}
+
+// Gauge значение gauge.
+func (c *Cache) Gauge(ctx context.Context, name string) (float64, error) {
+	m, err := c.Metric(ctx, entities.Gauge, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Value, nil
+}
+
+// Counter значение counter.
+func (c *Cache) Counter(ctx context.Context, name string) (int64, error) {
+	m, err := c.Metric(ctx, entities.Counter, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Delta, nil
+}
+
+func (c *Cache) UpdateGauge(ctx context.Context, name string, value float64) error {
+	defer c.invalidate(cacheKey{mType: entities.Gauge, name: name})
+	return c.Store.UpdateGauge(ctx, name, value)
+}
+
+func (c *Cache) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	defer c.invalidate(cacheKey{mType: entities.Counter, name: name})
+	return c.Store.UpdateCounter(ctx, name, delta)
+}
+
+// UpdateMetrics записывает пакет в Store и удаляет его серии из кэша,
+// в том числе при ошибке, после которой состояние Store неизвестно.
+func (c *Cache) UpdateMetrics(ctx context.Context, metrics []entities.MetricsJSON) error {
+	defer c.invalidateMetrics(metrics)
+	return c.Store.UpdateMetrics(ctx, metrics)
+}
+
+func (c *Cache) SetMetrics(metrics []entities.MetricsJSON) error {
+	return c.UpdateMetrics(context.Background(), metrics)
+}
+
+// GetGauge значение gauge в том же виде, что и в MemStore.
+func (c *Cache) GetGauge(name string) (string, bool) {
+	value, err := c.Gauge(context.Background(), name)
+	if err != nil {
+		if !errors.Is(err, entities.ErrNotFound) {
+			slog.Error(fmt.Sprintf("GetGauge %s: %v", name, err))
+		}
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+func (c *Cache) SetGauge(name string, fValue float64) {
+	if err := c.UpdateGauge(context.Background(), name, fValue); err != nil {
+		slog.Error(fmt.Sprintf("SetGauge %s: %v", name, err))
+	}
+}
+
+// GetCounter значение counter в том же виде, что и в MemStore.
+func (c *Cache) GetCounter(name string) (string, bool) {
+	value, err := c.Counter(context.Background(), name)
+	if err != nil {
+		if !errors.Is(err, entities.ErrNotFound) {
+			slog.Error(fmt.Sprintf("GetCounter %s: %v", name, err))
+		}
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+func (c *Cache) SetCounter(name string, iValue int64) {
+	if err := c.UpdateCounter(context.Background(), name, iValue); err != nil {
+		slog.Error(fmt.Sprintf("SetCounter %s: %v", name, err))
+	}
+}
+
+func (c *Cache) GetMetric(mType, name string) (entities.MetricsJSON, bool) {
+	if !cached(mType) {
+		return c.Store.GetMetric(mType, name)
+	}
+	m, err := c.Metric(context.Background(), mType, name)
+	if err != nil {
+		if !errors.Is(err, entities.ErrNotFound) {
+			slog.Error(fmt.Sprintf("GetMetric %s %s: %v", mType, name, err))
+		}
+		return entities.MetricsJSON{}, false
+	}
+	return m, true
+}
+
+func (c *Cache) Metrics(ctx context.Context) ([]entities.MetricsJSON, error) {
+	return c.Store.Metrics(ctx)
+}
+
+func (c *Cache) AllMetrics() map[string]string {
+	return c.Store.AllMetrics()
+}
+
+func (c *Cache) AllMetricsJSON() []entities.MetricsJSON {
+	return c.Store.AllMetricsJSON()
+}
+
+func (c *Cache) Range(mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return c.Store.Range(mType, name, from, to)
+}
+
+func (c *Cache) History(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return c.Store.History(ctx, mType, name, from, to)
+}
+
+func (c *Cache) Ping() bool {
+	return c.Store.Ping()
+}
+
+func (c *Cache) Check(ctx context.Context) error {
+	return c.Store.Check(ctx)
+}
+
+// Compact применяет политику хранения, если ее поддерживает хранилище.
+func (c *Cache) Compact(ctx context.Context, now time.Time, retention Retention) error {
+	if s, ok := c.Store.(Compacter); ok {
+		return s.Compact(ctx, now, retention)
+	}
+	return nil
+}
+
+// Close пишет итоговую статистику кэша и закрывает Store, если его нужно закрывать.
+// Во время работы статистика отдается в /metrics.
+func (c *Cache) Close() error {
+	stats := c.Stats()
+	slog.Info(fmt.Sprintf("storage cache: %d hits, %d misses, %d series", stats.Hits, stats.Misses, stats.Size))
+	if s, ok := c.Store.(io.Closer); ok {
+		return s.Close()
+	}
+	return nil
+}
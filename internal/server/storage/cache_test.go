@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	value := func(v float64) *float64 { return &v }
+	delta := func(d int64) *int64 { return &d }
+
+	tests := []struct {
+		name   string
+		write  func(c *Cache) error
+		gauge  float64
+		count  int64
+		misses uint64
+	}{
+		{
+			name:   "read only",
+			write:  func(c *Cache) error { return nil },
+			gauge:  1,
+			count:  2,
+			misses: 2,
+		},
+		{
+			name:   "update gauge",
+			write:  func(c *Cache) error { return c.UpdateGauge(ctx, "load", 5) },
+			gauge:  5,
+			count:  2,
+			misses: 3,
+		},
+		{
+			name:   "update counter",
+			write:  func(c *Cache) error { return c.UpdateCounter(ctx, "requests", 3) },
+			gauge:  1,
+			count:  5,
+			misses: 3,
+		},
+		{
+			name: "set metrics",
+			write: func(c *Cache) error {
+				return c.SetMetrics([]entities.MetricsJSON{
+					{ID: "load", MType: entities.Gauge, Value: value(7)},
+					{ID: "requests", MType: entities.Counter, Delta: delta(1)},
+				})
+			},
+			gauge:  7,
+			count:  3,
+			misses: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(NewMemStore(), CacheOptions{TTL: time.Hour, Size: 10})
+			c.SetGauge("load", 1)
+			c.SetCounter("requests", 2)
+
+			_, err := c.Gauge(ctx, "load")
+			require.NoError(t, err)
+			_, err = c.Counter(ctx, "requests")
+			require.NoError(t, err)
+			require.NoError(t, tt.write(c))
+
+			gauge, err := c.Gauge(ctx, "load")
+			require.NoError(t, err)
+			assert.Equal(t, tt.gauge, gauge)
+			count, err := c.Counter(ctx, "requests")
+			require.NoError(t, err)
+			assert.Equal(t, tt.count, count)
+
+			// Значения записаны в Store, а не только в кэш.
+			v, ok := c.Store.GetGauge("load")
+			assert.True(t, ok)
+			assert.Equal(t, entities.MetricsJSON{ID: "load", MType: entities.Gauge, Value: &gauge}.FormatValue(), v)
+
+			stats := c.Stats()
+			assert.Equal(t, tt.misses, stats.Misses)
+			assert.Equal(t, 4-tt.misses, stats.Hits)
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	c := NewCache(store, CacheOptions{TTL: 50 * time.Millisecond, Size: 10})
+	c.SetGauge("load", 1)
+
+	value, err := c.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1., value)
+
+	// Запись в обход кэша видна только после истечения ttl.
+	store.SetGauge("load", 2)
+	value, err = c.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1., value)
+
+	assert.Eventually(t, func() bool {
+		value, err := c.Gauge(ctx, "load")
+		return err == nil && value == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCacheSize(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(NewMemStore(), CacheOptions{TTL: time.Hour, Size: 2})
+	for _, name := range []string{"a", "b", "c"} {
+		c.SetGauge(name, 1)
+		_, err := c.Gauge(ctx, name)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, c.Stats().Size)
+
+	// Ошибки не кэшируются.
+	_, err := c.Gauge(ctx, "missing")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+	assert.Equal(t, 2, c.Stats().Size)
+}
+
+// blockingStore хранилище, чтение из которого сообщает о себе в started и ждет закрытия release.
+type blockingStore struct {
+	entities.Storage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	m, err := s.Storage.Metric(ctx, mType, name)
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return m, err
+}
+
+func TestCacheWriteDuringRead(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingStore{Storage: NewMemStore(), started: make(chan struct{}, 1), release: make(chan struct{})}
+	c := NewCache(store, CacheOptions{TTL: time.Hour, Size: 10})
+	store.Storage.SetGauge("load", 1)
+
+	done := make(chan float64)
+	go func() {
+		value, _ := c.Gauge(ctx, "load")
+		done <- value
+	}()
+
+	// Чтение получило старое значение, запись завершается до его возврата.
+	<-store.started
+	require.NoError(t, c.UpdateGauge(ctx, "load", 2))
+	close(store.release)
+	assert.Equal(t, 1., <-done)
+	assert.Equal(t, 0, c.Stats().Size)
+
+	value, err := c.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 2., value)
+	assert.Equal(t, entities.CacheStats{Hits: 0, Misses: 2, Size: 1}, c.Stats())
+}
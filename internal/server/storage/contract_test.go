@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storageContract проверки поведения, одинакового для всех реализаций entities.Storage.
+var storageContract = []struct {
+	name string
+	test func(t *testing.T, s entities.Storage)
+}{
+	{name: "gauge", test: contractGauge},
+	{name: "counter", test: contractCounter},
+	{name: "labels", test: contractLabels},
+	{name: "counter total", test: contractCounterTotal},
+	{name: "batch is atomic", test: contractBatchAtomic},
+	{name: "histogram", test: contractHistogram},
+	{name: "summary", test: contractSummary},
+	{name: "set", test: contractSet},
+	{name: "all metrics", test: contractAllMetrics},
+	{name: "range", test: contractRange},
+	{name: "ping", test: contractPing},
+	{name: "v2 values", test: contractV2Values},
+	{name: "v2 errors", test: contractV2Errors},
+	{name: "type mismatch", test: contractTypeMismatch},
+}
+
+func runStorageContract(t *testing.T, newStorage func(t *testing.T) entities.Storage) {
+	for _, tt := range storageContract {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func TestMemStoreContract(t *testing.T) {
+	runStorageContract(t, func(t *testing.T) entities.Storage {
+		return NewMemStore()
+	})
+}
+
+func TestSaverContract(t *testing.T) {
+	runStorageContract(t, func(t *testing.T) entities.Storage {
+		dir := t.TempDir()
+		options := SaverOptions{WAL: WALOptions{Filename: filepath.Join(dir, "data.wal"), Sync: SyncNever}}
+		saver, err := NewSaver(NewMemStore(), filepath.Join(dir, "data.json"), true, 0, options)
+		require.NoError(t, err)
+		t.Cleanup(func() { saver.Close() })
+		return saver
+	})
+}
+
+func TestBoltContract(t *testing.T) {
+	runStorageContract(t, func(t *testing.T) entities.Storage {
+		b, err := NewBolt(filepath.Join(t.TempDir(), "metrics.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { b.Close() })
+		return b
+	})
+}
+
+func TestCacheContract(t *testing.T) {
+	runStorageContract(t, func(t *testing.T) entities.Storage {
+		return NewCache(NewMemStore(), CacheOptions{TTL: time.Hour, Size: 100})
+	})
+}
+
+func TestBaseContract(t *testing.T) {
+	dsn := testDatabaseDSN(t)
+
+	runStorageContract(t, func(t *testing.T) entities.Storage {
+		base, err := NewPDatabase(dsn, PoolOptions{})
+		require.NoError(t, err)
+		t.Cleanup(func() { base.Close() })
+
+		_, err = base.pool.Exec(context.Background(), `TRUNCATE metrics_gauge, metrics_counter, metrics_samples, metrics_rollups,
+			metrics_histogram, metrics_summary, metrics_set, metrics_series;`)
+		require.NoError(t, err)
+		return base
+	})
+}
+
+func contractGauge(t *testing.T, s entities.Storage) {
+	_, ok := s.GetGauge("load")
+	assert.False(t, ok)
+
+	s.SetGauge("load", 0.1)
+	s.SetGauge("load", 0.30000000000000004)
+	v, ok := s.GetGauge("load")
+	assert.True(t, ok)
+	assert.Equal(t, "0.30000000000000004", v)
+
+	m, ok := s.GetMetric(entities.Gauge, "load")
+	require.True(t, ok)
+	assert.Equal(t, 0.30000000000000004, *m.Value)
+
+	_, ok = s.GetMetric(entities.Counter, "load")
+	assert.False(t, ok)
+}
+
+func contractCounter(t *testing.T, s entities.Storage) {
+	_, ok := s.GetCounter("requests")
+	assert.False(t, ok)
+
+	s.SetCounter("requests", 5)
+	s.SetCounter("requests", math.MaxInt32)
+	v, ok := s.GetCounter("requests")
+	assert.True(t, ok)
+	assert.Equal(t, "2147483652", v)
+
+	m, ok := s.GetMetric(entities.Counter, "requests")
+	require.True(t, ok)
+	assert.Equal(t, int64(2147483652), *m.Delta)
+}
+
+func contractLabels(t *testing.T, s entities.Storage) {
+	value := 2.
+	err := s.SetMetrics([]entities.MetricsJSON{
+		{ID: "load", MType: entities.Gauge, Value: &value, Labels: map[string]string{"host": "a", "env": "prod"}},
+	})
+	require.NoError(t, err)
+
+	m, ok := s.GetMetric(entities.Gauge, `load{env="prod",host="a"}`)
+	require.True(t, ok)
+	assert.Equal(t, "load", m.ID)
+	assert.Equal(t, map[string]string{"host": "a", "env": "prod"}, m.Labels)
+
+	_, ok = s.GetGauge("load")
+	assert.False(t, ok)
+}
+
+func contractCounterTotal(t *testing.T, s entities.Storage) {
+	counter := func(delta, total int64) entities.MetricsJSON {
+		return entities.MetricsJSON{ID: "Mallocs", MType: entities.Counter, Delta: &delta, Total: &total}
+	}
+
+	for _, step := range []struct {
+		metric entities.MetricsJSON
+		want   string
+	}{
+		{metric: counter(10, 100), want: "10"},
+		{metric: counter(30, 130), want: "40"},
+		{metric: counter(30, 130), want: "40"},
+		{metric: counter(5, 5), want: "45"},
+	} {
+		require.NoError(t, s.SetMetrics([]entities.MetricsJSON{step.metric}))
+		v, _ := s.GetCounter("Mallocs")
+		assert.Equal(t, step.want, v)
+	}
+
+	err := s.SetMetrics([]entities.MetricsJSON{{ID: "Mallocs", MType: entities.Counter}})
+	assert.ErrorIs(t, err, entities.ErrInvalidCounter)
+}
+
+func contractBatchAtomic(t *testing.T, s entities.Storage) {
+	value := 1.
+	delta := int64(1)
+	tests := []struct {
+		name    string
+		invalid entities.MetricsJSON
+		wantErr error
+	}{
+		{name: "counter", invalid: entities.MetricsJSON{ID: "c", MType: entities.Counter}, wantErr: entities.ErrInvalidCounter},
+		{name: "gauge", invalid: entities.MetricsJSON{ID: "g", MType: entities.Gauge}, wantErr: entities.ErrInvalidGauge},
+		{name: "unknown type", invalid: entities.MetricsJSON{ID: "u", MType: "meter", Delta: &delta}, wantErr: entities.ErrUnknownType},
+		{name: "histogram", invalid: entities.MetricsJSON{ID: "h", MType: entities.Histogram}, wantErr: entities.ErrInvalidHistogram},
+	}
+
+	for _, tt := range tests {
+		err := s.SetMetrics([]entities.MetricsJSON{
+			{ID: "load", MType: entities.Gauge, Value: &value},
+			tt.invalid,
+		})
+		assert.ErrorIs(t, err, tt.wantErr, tt.name)
+	}
+	_, ok := s.GetGauge("load")
+	assert.False(t, ok, "batch with invalid metric must not be applied")
+}
+
+func contractHistogram(t *testing.T, s entities.Storage) {
+	h := entities.NewHistogram([]float64{1, 10})
+	h.Observe(0.5)
+	h.Observe(5)
+	metric := entities.MetricsJSON{ID: "latency", MType: entities.Histogram, Histogram: h}
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{metric}))
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{metric}))
+
+	m, ok := s.GetMetric(entities.Histogram, "latency")
+	require.True(t, ok)
+	assert.Equal(t, []uint64{2, 2, 0}, m.Histogram.Counts)
+	assert.Equal(t, uint64(4), m.Histogram.Count)
+	assert.Equal(t, 11., m.Histogram.Sum)
+
+	other := entities.MetricsJSON{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{5})}
+	assert.ErrorIs(t, s.SetMetrics([]entities.MetricsJSON{other}), entities.ErrBoundsMismatch)
+}
+
+func contractSummary(t *testing.T, s entities.Storage) {
+	sd := entities.NewSummary(entities.DefaultSummaryAccuracy)
+	for i := 1; i <= 100; i++ {
+		sd.Observe(float64(i))
+	}
+	metric := entities.MetricsJSON{ID: "size", MType: entities.Summary, Summary: sd}
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{metric}))
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{metric}))
+
+	m, ok := s.GetMetric(entities.Summary, "size")
+	require.True(t, ok)
+	assert.Equal(t, uint64(200), m.Summary.Count)
+	assert.InEpsilon(t, 50, m.Summary.Quantile(0.5), 0.02)
+
+	other := entities.MetricsJSON{ID: "size", MType: entities.Summary, Summary: entities.NewSummary(0.05)}
+	assert.ErrorIs(t, s.SetMetrics([]entities.MetricsJSON{other}), entities.ErrAccuracyMismatch)
+}
+
+func contractSet(t *testing.T, s entities.Storage) {
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{
+		{ID: "users", MType: entities.Set, Members: []string{"a", "b", "c"}},
+	}))
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{
+		{ID: "users", MType: entities.Set, Members: []string{"c", "d"}},
+	}))
+
+	m, ok := s.GetMetric(entities.Set, "users")
+	require.True(t, ok)
+	assert.Equal(t, uint64(4), m.Set.Cardinality())
+
+	other := entities.MetricsJSON{ID: "users", MType: entities.Set, Set: entities.NewSet(entities.MinSetPrecision)}
+	assert.ErrorIs(t, s.SetMetrics([]entities.MetricsJSON{other}), entities.ErrPrecisionMismatch)
+}
+
+func contractAllMetrics(t *testing.T, s entities.Storage) {
+	assert.Empty(t, s.AllMetricsJSON())
+	assert.Empty(t, s.AllMetrics())
+
+	s.SetGauge(`load{host="a"}`, 1.5)
+	s.SetCounter("requests", 3)
+	h := entities.NewHistogram([]float64{1})
+	h.Observe(2)
+	require.NoError(t, s.SetMetrics([]entities.MetricsJSON{
+		{ID: "latency", MType: entities.Histogram, Histogram: h},
+		{ID: "users", MType: entities.Set, Members: []string{"a"}},
+	}))
+
+	got := make(map[string]entities.MetricsJSON)
+	for _, m := range s.AllMetricsJSON() {
+		got[m.MType+" "+m.Key()] = m
+	}
+	require.Len(t, got, 4)
+	assert.Equal(t, map[string]string{"host": "a"}, got[`gauge load{host="a"}`].Labels)
+	assert.Equal(t, 1.5, *got[`gauge load{host="a"}`].Value)
+	assert.Nil(t, got["counter requests"].Labels)
+	assert.Equal(t, int64(3), *got["counter requests"].Delta)
+	assert.Equal(t, []uint64{0, 1}, got["histogram latency"].Histogram.Counts)
+	assert.Equal(t, uint64(1), got["set users"].Set.Cardinality())
+
+	assert.Equal(t, map[string]string{
+		`load{host="a"}`: "1.5",
+		"requests":       "3",
+		"latency":        `{"bounds":[1],"counts":[0,1],"sum":2,"count":1}`,
+		"users":          "1",
+	}, s.AllMetrics())
+}
+
+func contractRange(t *testing.T, s entities.Storage) {
+	from := time.Now().Add(-time.Minute)
+	s.SetGauge("load", 1)
+	s.SetGauge("load", 2)
+	s.SetCounter("requests", 3)
+	s.SetCounter("requests", 4)
+	to := time.Now().Add(time.Minute)
+
+	samples, err := s.Range(entities.Gauge, "load", from, to)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 1., samples[0].Value)
+	assert.Equal(t, 2., samples[1].Value)
+	assert.Nil(t, samples[0].Sum)
+
+	samples, err = s.Range(entities.Counter, "requests", from, to)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 7., samples[1].Value)
+	require.NotNil(t, samples[1].Sum)
+	assert.Equal(t, 4., *samples[1].Sum)
+
+	samples, err = s.Range(entities.Gauge, "missing", from, to)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func contractPing(t *testing.T, s entities.Storage) {
+	assert.True(t, s.Ping())
+	// Проверка соединения не должна закрывать хранилище.
+	assert.True(t, s.Ping())
+	s.SetGauge("load", 1)
+	_, ok := s.GetGauge("load")
+	assert.True(t, ok)
+}
+
+func contractV2Values(t *testing.T, s entities.Storage) {
+	ctx := context.Background()
+	require.NoError(t, s.UpdateGauge(ctx, "load", 0.5))
+	require.NoError(t, s.UpdateCounter(ctx, "requests", 2))
+	require.NoError(t, s.UpdateCounter(ctx, "requests", 3))
+
+	gauge, err := s.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, gauge)
+	counter, err := s.Counter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	m, err := s.Metric(ctx, entities.Gauge, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, *m.Value)
+
+	metrics, err := s.Metrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	samples, err := s.History(ctx, entities.Counter, "requests", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, samples, 2)
+
+	assert.NoError(t, s.Check(ctx))
+}
+
+func contractV2Errors(t *testing.T, s entities.Storage) {
+	ctx := context.Background()
+	_, err := s.Gauge(ctx, "load")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+	_, err = s.Counter(ctx, "requests")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+
+	require.NoError(t, s.UpdateGauge(ctx, "load", 1))
+	_, err = s.Metric(ctx, entities.Counter, "load")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+
+	h := entities.NewHistogram([]float64{1})
+	require.NoError(t, s.UpdateMetrics(ctx, []entities.MetricsJSON{{ID: "latency", MType: entities.Histogram, Histogram: h}}))
+	err = s.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{2})},
+	})
+	assert.ErrorIs(t, err, entities.ErrBoundsMismatch)
+
+	err = s.UpdateMetrics(ctx, []entities.MetricsJSON{{ID: "load", MType: entities.Gauge}})
+	assert.ErrorIs(t, err, entities.ErrInvalidGauge)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, s.UpdateGauge(canceled, "load", 2), entities.ErrUnavailable)
+	_, err = s.Gauge(canceled, "load")
+	assert.ErrorIs(t, err, entities.ErrUnavailable)
+	assert.ErrorIs(t, s.Check(canceled), entities.ErrUnavailable)
+
+	gauge, err := s.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1., gauge, "update with canceled context must not be applied")
+}
+
+func contractTypeMismatch(t *testing.T, s entities.Storage) {
+	ctx := context.Background()
+	value := func(v float64) *float64 { return &v }
+	delta := func(d int64) *int64 { return &d }
+	require.NoError(t, s.UpdateGauge(ctx, "load", 1))
+
+	assert.ErrorIs(t, s.UpdateCounter(ctx, "load", 2), entities.ErrTypeMismatch)
+	err := s.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "requests", MType: entities.Counter, Delta: delta(1)},
+		{ID: "load", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{1})},
+	})
+	assert.ErrorIs(t, err, entities.ErrTypeMismatch)
+	err = s.UpdateMetrics(ctx, []entities.MetricsJSON{
+		{ID: "queue", MType: entities.Gauge, Value: value(1)},
+		{ID: "queue", MType: entities.Counter, Delta: delta(1)},
+	})
+	assert.ErrorIs(t, err, entities.ErrTypeMismatch)
+
+	// Сохраненная серия не изменилась, пакеты с ошибкой не применены.
+	gauge, err := s.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 1., gauge)
+	_, err = s.Counter(ctx, "load")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+	_, err = s.Counter(ctx, "requests")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+	_, err = s.Gauge(ctx, "queue")
+	assert.ErrorIs(t, err, entities.ErrNotFound)
+}
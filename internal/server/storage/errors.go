@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// unavailable помечает ошибку как недоступность хранилища, исходная ошибка сохраняется.
+func unavailable(err error) error {
+	if err == nil || errors.Is(err, entities.ErrUnavailable) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", entities.ErrUnavailable, err)
+}
+
+// contextErr ошибка отмененного или истекшего контекста вызова.
+func contextErr(ctx context.Context) error {
+	return unavailable(ctx.Err())
+}
+
+// pgTypeMismatch код ошибки, с которым триггер metrics_register_series отклоняет запись
+// серии, уже сохраненной с другим типом (миграция 0007).
+const pgTypeMismatch = "AM001"
+
+// dbError приводит ошибку базы к ошибкам хранилища: запись серии другого типа - ErrTypeMismatch,
+// ошибки соединения, таймауты, отмена контекста и остановка сервера базы - ErrUnavailable,
+// остальные возвращаются как есть.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == pgTypeMismatch {
+			return fmt.Errorf("%w: %s", entities.ErrTypeMismatch, pgErr.Message)
+		}
+		switch pgErr.Code[:2] {
+		// 08 - ошибки соединения, 53 - нехватка ресурсов, 57 - вмешательство оператора,
+		// в том числе statement_timeout и остановка сервера.
+		case "08", "53", "57":
+			return unavailable(err)
+		}
+		return err
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		pgconn.Timeout(err) || errors.As(err, &connectErr) || errors.As(err, &netErr) {
+		return unavailable(err)
+	}
+	return err
+}
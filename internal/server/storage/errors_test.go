@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBError(t *testing.T) {
+	unique := &pgconn.PgError{Code: "23505", Message: "duplicate key"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "type mismatch", err: &pgconn.PgError{Code: pgTypeMismatch, Message: "load is stored as gauge"}, want: entities.ErrTypeMismatch},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: entities.ErrUnavailable},
+		{name: "statement timeout", err: &pgconn.PgError{Code: "57014"}, want: entities.ErrUnavailable},
+		{name: "cancelled context", err: context.Canceled, want: entities.ErrUnavailable},
+		{name: "other database error", err: unique, want: unique},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, dbError(tt.err), tt.want)
+		})
+	}
+	assert.NoError(t, dbError(nil))
+	assert.ErrorContains(t, dbError(tests[0].err), "load is stored as gauge")
+	assert.False(t, errors.Is(dbError(unique), entities.ErrUnavailable))
+}
+
+// Код ошибки триггера в миграции должен совпадать с кодом, который dbError приводит к ErrTypeMismatch.
+func TestTypeCheckMigrationErrcode(t *testing.T) {
+	fsys, err := fs.Sub(migrationsFS, "migrations")
+	require.NoError(t, err)
+	migrations, err := loadMigrations(fsys)
+	require.NoError(t, err)
+
+	var up string
+	for _, m := range migrations {
+		if m.Name == "type_check" {
+			up = m.Up
+		}
+	}
+	require.NotEmpty(t, up)
+	assert.Contains(t, up, "ERRCODE = '"+pgTypeMismatch+"'")
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(data string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(data)} }
+
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		errText string
+	}{
+		{
+			name: "ordered by version",
+			fsys: fstest.MapFS{
+				"0002_b.up.sql":   file("up b"),
+				"0001_a.up.sql":   file("up a"),
+				"0001_a.down.sql": file("down a"),
+				"0010_c.up.sql":   file("up c"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "a", Up: "up a", Down: "down a"},
+				{Version: 2, Name: "b", Up: "up b"},
+				{Version: 10, Name: "c", Up: "up c"},
+			},
+		},
+		{name: "bad direction", fsys: fstest.MapFS{"0001_a.sql": file("")}, errText: "expected NNNN_name"},
+		{name: "bad version", fsys: fstest.MapFS{"first_a.up.sql": file("")}, errText: "invalid version"},
+		{name: "zero version", fsys: fstest.MapFS{"0000_a.up.sql": file("")}, errText: "invalid version"},
+		{
+			name:    "duplicate version",
+			fsys:    fstest.MapFS{"0001_a.up.sql": file("a"), "0001_b.up.sql": file("b")},
+			errText: "version 1 is already used",
+		},
+		{name: "missing up", fsys: fstest.MapFS{"0001_a.down.sql": file("down")}, errText: "missing up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.fsys)
+			if tt.errText != "" {
+				assert.ErrorContains(t, err, tt.errText)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	fsys, err := fs.Sub(migrationsFS, "migrations")
+	require.NoError(t, err)
+	migrations, err := loadMigrations(fsys)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "versions must be consecutive")
+		assert.NotEmpty(t, m.Down, "migration %04d_%s has no down", m.Version, m.Name)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	dsn := testDatabaseDSN(t)
+
+	ctx := context.Background()
+	migrator, err := OpenMigrator(dsn)
+	require.NoError(t, err)
+	defer migrator.Close()
+	total := len(migrator.migrations)
+
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	n, err := migrator.Down(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, total)
+	assert.NotNil(t, statuses[total-3].AppliedAt)
+	assert.Nil(t, statuses[total-2].AppliedAt)
+	assert.Nil(t, statuses[total-1].AppliedAt)
+
+	n, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS metrics_counter;
+DROP TABLE IF EXISTS metrics_gauge;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS metrics_samples (
+	name varchar(255) NOT NULL,
+	type varchar(16) NOT NULL,
+	value DOUBLE PRECISION NOT NULL,
+	ts timestamptz NOT NULL DEFAULT now());
+CREATE INDEX IF NOT EXISTS metrics_samples_name_ts ON metrics_samples (type, name, ts);
+ALTER TABLE metrics_samples ADD COLUMN IF NOT EXISTS delta DOUBLE PRECISION;
+CREATE TABLE IF NOT EXISTS metrics_rollups (
+	name varchar(255) NOT NULL,
+	type varchar(16) NOT NULL,
+	resolution bigint NOT NULL,
+	ts timestamptz NOT NULL,
+	value DOUBLE PRECISION NOT NULL,
+	min DOUBLE PRECISION,
+	max DOUBLE PRECISION,
+	count bigint NOT NULL,
+	sum DOUBLE PRECISION,
+	PRIMARY KEY (type, name, resolution, ts));
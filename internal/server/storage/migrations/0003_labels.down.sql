@@ -0,0 +1,9 @@
+-- Ключи серий длиннее 255 символов не помещаются в прежний тип, такие строки нужно удалить до отката.
+DROP INDEX IF EXISTS metrics_counter_labels;
+DROP INDEX IF EXISTS metrics_gauge_labels;
+ALTER TABLE metrics_counter DROP COLUMN IF EXISTS labels;
+ALTER TABLE metrics_gauge DROP COLUMN IF EXISTS labels;
+ALTER TABLE metrics_rollups ALTER COLUMN name TYPE varchar(255);
+ALTER TABLE metrics_samples ALTER COLUMN name TYPE varchar(255);
+ALTER TABLE metrics_counter ALTER COLUMN name TYPE varchar(255);
+ALTER TABLE metrics_gauge ALTER COLUMN name TYPE varchar(255);
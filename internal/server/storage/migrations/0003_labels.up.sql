@@ -0,0 +1,9 @@
+-- Имя хранит ключ серии name{k="v",...}, метки дублируются в labels для выборок по ним.
+ALTER TABLE metrics_gauge ALTER COLUMN name TYPE text;
+ALTER TABLE metrics_counter ALTER COLUMN name TYPE text;
+ALTER TABLE metrics_samples ALTER COLUMN name TYPE text;
+ALTER TABLE metrics_rollups ALTER COLUMN name TYPE text;
+ALTER TABLE metrics_gauge ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE metrics_counter ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS metrics_gauge_labels ON metrics_gauge USING gin (labels);
+CREATE INDEX IF NOT EXISTS metrics_counter_labels ON metrics_counter USING gin (labels);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS metrics_histogram (
+	name text PRIMARY KEY,
+	labels jsonb NOT NULL DEFAULT '{}',
+	bounds DOUBLE PRECISION[] NOT NULL,
+	counts bigint[] NOT NULL,
+	sum DOUBLE PRECISION NOT NULL,
+	count bigint NOT NULL);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS metrics_set;
+DROP TABLE IF EXISTS metrics_summary;
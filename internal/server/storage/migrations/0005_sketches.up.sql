@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS metrics_summary (
+	name text PRIMARY KEY,
+	labels jsonb NOT NULL DEFAULT '{}',
+	sketch jsonb NOT NULL);
+CREATE TABLE IF NOT EXISTS metrics_set (
+	name text PRIMARY KEY,
+	labels jsonb NOT NULL DEFAULT '{}',
+	precision smallint NOT NULL,
+	registers bytea NOT NULL);
@@ -0,0 +1 @@
+ALTER TABLE metrics_counter DROP COLUMN IF EXISTS total;
@@ -0,0 +1 @@
+ALTER TABLE metrics_counter ADD COLUMN IF NOT EXISTS total bigint;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS metrics_set_series ON metrics_set;
+DROP TRIGGER IF EXISTS metrics_summary_series ON metrics_summary;
+DROP TRIGGER IF EXISTS metrics_histogram_series ON metrics_histogram;
+DROP TRIGGER IF EXISTS metrics_counter_series ON metrics_counter;
+DROP TRIGGER IF EXISTS metrics_gauge_series ON metrics_gauge;
+DROP FUNCTION IF EXISTS metrics_register_series();
+DROP TABLE IF EXISTS metrics_series;
@@ -0,0 +1,45 @@
+-- Серия хранится только в одной таблице типа: тип серии записывается в metrics_series
+-- при создании серии, первичный ключ по имени не дает двум транзакциям одновременно
+-- создать серию с разными типами. Запись ключа, уже сохраненного с другим типом,
+-- завершается ошибкой AM001, которую сервер возвращает как ErrTypeMismatch.
+CREATE TABLE IF NOT EXISTS metrics_series (
+	name text PRIMARY KEY,
+	type text NOT NULL
+);
+
+-- Для уже сохраненных серий тип берется из первой таблицы, в которой серия найдена.
+INSERT INTO metrics_series (name, type)
+	SELECT name, 'gauge' FROM metrics_gauge
+	UNION ALL SELECT name, 'counter' FROM metrics_counter
+	UNION ALL SELECT name, 'histogram' FROM metrics_histogram
+	UNION ALL SELECT name, 'summary' FROM metrics_summary
+	UNION ALL SELECT name, 'set' FROM metrics_set
+ON CONFLICT (name) DO NOTHING;
+
+-- Триггер AFTER INSERT срабатывает только для новой строки: при обновлении существующей серии
+-- через ON CONFLICT DO UPDATE он не вызывается, поэтому обычная запись значения не проверяется.
+CREATE OR REPLACE FUNCTION metrics_register_series() RETURNS trigger AS $$
+DECLARE
+	stored text;
+BEGIN
+	INSERT INTO metrics_series (name, type) VALUES (NEW.name, TG_ARGV[0])
+		ON CONFLICT (name) DO NOTHING;
+	IF NOT FOUND THEN
+		SELECT type INTO stored FROM metrics_series WHERE name = NEW.name;
+		IF stored <> TG_ARGV[0] THEN
+			RAISE EXCEPTION '% is stored as %', NEW.name, stored USING ERRCODE = 'AM001';
+		END IF;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS metrics_gauge_series ON metrics_gauge;
+CREATE TRIGGER metrics_gauge_series AFTER INSERT ON metrics_gauge FOR EACH ROW EXECUTE FUNCTION metrics_register_series('gauge');
+DROP TRIGGER IF EXISTS metrics_counter_series ON metrics_counter;
+CREATE TRIGGER metrics_counter_series AFTER INSERT ON metrics_counter FOR EACH ROW EXECUTE FUNCTION metrics_register_series('counter');
+DROP TRIGGER IF EXISTS metrics_histogram_series ON metrics_histogram;
+CREATE TRIGGER metrics_histogram_series AFTER INSERT ON metrics_histogram FOR EACH ROW EXECUTE FUNCTION metrics_register_series('histogram');
+DROP TRIGGER IF EXISTS metrics_summary_series ON metrics_summary;
+CREATE TRIGGER metrics_summary_series AFTER INSERT ON metrics_summary FOR EACH ROW EXECUTE FUNCTION metrics_register_series('summary');
+DROP TRIGGER IF EXISTS metrics_set_series ON metrics_set;
+CREATE TRIGGER metrics_set_series AFTER INSERT ON metrics_set FOR EACH ROW EXECUTE FUNCTION metrics_register_series('set');
@@ -2,25 +2,40 @@ package storage
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/echo9et/alerting/internal/entities"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
+// PoolOptions настройки пула соединений с базой.
+type PoolOptions struct {
+	// MaxConns максимальное количество соединений, 0 - значение pgxpool по умолчанию.
+	MaxConns int32
+	// StatementTimeout ограничение времени выполнения запроса на сервере, 0 - без ограничения.
+	StatementTimeout time.Duration
+}
+
+// Base хранилище метрик в Postgres.
+// Ошибки соединения, таймауты запросов и отмена контекста возвращаются как entities.ErrUnavailable.
 type Base struct {
-	addr string
-	conn *sql.DB
+	addr    string
+	options PoolOptions
+	pool    *pgxpool.Pool
 }
 
-func NewPDatabase(a string) (*Base, error) {
+func NewPDatabase(a string, options PoolOptions) (*Base, error) {
 	base := &Base{
-		addr: a,
-		conn: nil,
+		addr:    a,
+		options: options,
 	}
 	if err := base.Open(); err != nil {
 		return nil, err
@@ -30,190 +45,894 @@ func NewPDatabase(a string) (*Base, error) {
 }
 
 func (b *Base) Open() error {
-	bd, err := sql.Open("pgx", b.addr)
+	config, err := pgxpool.ParseConfig(b.addr)
 	if err != nil {
 		return err
 	}
+	if b.options.MaxConns > 0 {
+		config.MaxConns = b.options.MaxConns
+	}
+	if b.options.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(b.options.StatementTimeout.Milliseconds(), 10)
+	}
 
-	b.conn = bd
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return err
+	}
+	b.pool = pool
 
 	if err := b.InitTable(); err != nil {
+		pool.Close()
 		return err
 	}
 	return nil
-
 }
 
+// InitTable применяет миграции схемы.
 func (b *Base) InitTable() error {
-	if b.conn == nil {
-		return fmt.Errorf("b.conn is nil")
-	}
-	rows, err := b.conn.QueryContext(context.Background(),
-		`CREATE TABLE IF NOT EXISTS metrics_gauge (name varchar(255) PRIMARY KEY UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL);`)
-	if err != nil {
-		return err
+	if b.pool == nil {
+		return fmt.Errorf("b.pool is nil")
 	}
-	if rows.Err() != nil {
-		return err
-	}
-	rows.Close()
 
-	rows, err = b.conn.QueryContext(context.Background(),
-		`CREATE TABLE IF NOT EXISTS metrics_counter (name varchar(255) PRIMARY KEY UNIQUE NOT NULL, value bigint NOT NULL);`)
+	db := stdlib.OpenDBFromPool(b.pool)
+	defer db.Close()
 
+	migrator, err := NewMigrator(db)
 	if err != nil {
 		return err
 	}
+	_, err = migrator.Up(context.Background())
+	return err
+}
 
-	if rows.Err() != nil {
-		return err
-	}
-	rows.Close()
+// Запросы обновляют последнее значение метрики и добавляют его в историю metrics_samples.
+const (
+	querySetGauge = `WITH upd AS (
+		INSERT INTO metrics_gauge (name, value, labels)
+		VALUES ($1, $2, $3) ON CONFLICT (name)
+		DO UPDATE SET value = EXCLUDED.value
+		RETURNING name, value)
+	INSERT INTO metrics_samples (name, type, value) SELECT name, 'gauge', value FROM upd;`
+
+	// Если передано накопленное значение $4, приращение вычисляется от сохраненного total,
+	// уменьшение total считается сбросом счетчика. Без известного total используется приращение $2.
+	querySetCounter = `WITH prev AS (
+		SELECT value FROM metrics_counter WHERE name = $1 FOR UPDATE),
+	upd AS (
+		INSERT INTO metrics_counter (name, value, labels, total)
+		VALUES ($1, COALESCE($2::bigint, $4::bigint), $3, $4::bigint) ON CONFLICT (name)
+		DO UPDATE SET
+			value = metrics_counter.value + CASE
+				WHEN EXCLUDED.total IS NULL OR metrics_counter.total IS NULL THEN EXCLUDED.value
+				WHEN EXCLUDED.total >= metrics_counter.total THEN EXCLUDED.total - metrics_counter.total
+				ELSE EXCLUDED.total END,
+			total = COALESCE(EXCLUDED.total, metrics_counter.total)
+		RETURNING name, value)
+	INSERT INTO metrics_samples (name, type, value, delta)
+	SELECT name, 'counter', value, value - COALESCE((SELECT value FROM prev), 0) FROM upd;`
+
+	// Корзины складываются поэлементно, при несовпадении границ строка не обновляется.
+	querySetHistogram = `INSERT INTO metrics_histogram AS h (name, labels, bounds, counts, sum, count)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (name)
+		DO UPDATE SET
+			counts = (SELECT array_agg(a + b ORDER BY i)
+				FROM unnest(h.counts, EXCLUDED.counts) WITH ORDINALITY AS t(a, b, i)),
+			sum = h.sum + EXCLUDED.sum,
+			count = h.count + EXCLUDED.count
+		WHERE h.bounds = EXCLUDED.bounds;`
 
+	// Скетч объединяется на стороне сервера: строка блокируется до конца транзакции.
+	querySelectSummary = `SELECT sketch FROM metrics_summary WHERE name = $1 FOR UPDATE;`
+	querySetSummary    = `INSERT INTO metrics_summary (name, labels, sketch)
+		VALUES ($1, $2, $3) ON CONFLICT (name)
+		DO UPDATE SET sketch = EXCLUDED.sketch;`
+
+	querySelectSet = `SELECT precision, registers FROM metrics_set WHERE name = $1 FOR UPDATE;`
+	querySetSet    = `INSERT INTO metrics_set (name, labels, precision, registers)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (name)
+		DO UPDATE SET registers = EXCLUDED.registers;`
+)
+
+// Close закрывает пул соединений с базой.
+func (b *Base) Close() error {
+	if b.pool != nil {
+		b.pool.Close()
+	}
 	return nil
 }
 
+// Ping проверяет соединение с базой, пул соединений остается открытым.
 func (b *Base) Ping() bool {
-	defer b.conn.Close()
-	if b.conn == nil {
-		slog.Error("Ping nil b.conn")
-		return false
-	}
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
-	if err := b.conn.PingContext(ctx); err != nil {
+	if err := b.Check(ctx); err != nil {
 		slog.Error(fmt.Sprintln(" Context False", err))
 		return false
 	}
 	return true
 }
 
-func (b *Base) GetCounter(name string) (string, bool) {
-	query := `SELECT value FROM metrics_counter WHERE name=$1;`
-	var desc sql.NullString
-	err := b.conn.QueryRow(query, name).Scan(&desc)
+// Check проверяет соединение с базой.
+func (b *Base) Check(ctx context.Context) error {
+	if b.pool == nil {
+		return fmt.Errorf("%w: b.pool is nil", entities.ErrUnavailable)
+	}
+	return dbError(b.pool.Ping(ctx))
+}
 
+// GetCounter значение counter в том же виде, что и в MemStore.
+func (b *Base) GetCounter(name string) (string, bool) {
+	value, err := b.Counter(context.Background(), name)
 	if err != nil {
-		slog.Error(fmt.Sprintln("ERROR GetCounter ", name, err))
+		if !errors.Is(err, entities.ErrNotFound) {
+			slog.Error(fmt.Sprintln("ERROR GetCounter ", name, err))
+		}
 		return "", false
 	}
+	return fmt.Sprint(value), true
+}
 
-	return desc.String, true
+// Counter значение counter.
+func (b *Base) Counter(ctx context.Context, name string) (int64, error) {
+	m, err := b.Metric(ctx, entities.Counter, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Delta, nil
 }
 
 func (b *Base) SetCounter(name string, iValue int64) {
-	_, err := b.conn.Exec(
-		`INSERT INTO metrics_counter (name, value) 
-		VALUES ($1, $2) 
-		ON CONFLICT (name) 
-		DO UPDATE SET value = metrics_counter.value + EXCLUDED.value;`, name, iValue)
-	if err != nil {
+	if err := b.UpdateCounter(context.Background(), name, iValue); err != nil {
 		slog.Error(fmt.Sprintln("SetCounter ", err))
 	}
 }
 
-func (b *Base) GetGauge(name string) (string, bool) {
-	query := `SELECT value FROM metrics_gauge WHERE name=$1;`
-	var desc sql.NullString
-	err := b.conn.QueryRow(query, name).Scan(&desc)
+// UpdateCounter добавляет приращение counter.
+func (b *Base) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	_, err := b.pool.Exec(ctx, querySetCounter, name, delta, labelsJSON(name), nil)
+	return dbError(err)
+}
 
+// GetGauge значение gauge в том же виде, что и в MemStore.
+func (b *Base) GetGauge(name string) (string, bool) {
+	value, err := b.Gauge(context.Background(), name)
 	if err != nil {
-		slog.Error("GetGauge ", name, err)
+		if !errors.Is(err, entities.ErrNotFound) {
+			slog.Error("GetGauge", "name", name, "error", err)
+		}
 		return "", false
 	}
+	return fmt.Sprint(value), true
+}
 
-	return desc.String, true
+// Gauge значение gauge.
+func (b *Base) Gauge(ctx context.Context, name string) (float64, error) {
+	m, err := b.Metric(ctx, entities.Gauge, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Value, nil
 }
 
 func (b *Base) SetGauge(name string, fValue float64) {
-	_, err := b.conn.Exec(
-		`INSERT INTO metrics_gauge (name, value) 
-		VALUES ($1, $2) ON CONFLICT (name) 
-		DO UPDATE SET value = EXCLUDED.value;`, name, fValue)
-	if err != nil {
-		slog.Error("SetGauge ", name, err)
+	if err := b.UpdateGauge(context.Background(), name, fValue); err != nil {
+		slog.Error("SetGauge", "name", name, "error", err)
 	}
 }
 
+// UpdateGauge сохраняет значение gauge.
+func (b *Base) UpdateGauge(ctx context.Context, name string, value float64) error {
+	_, err := b.pool.Exec(ctx, querySetGauge, name, value, labelsJSON(name))
+	return dbError(err)
+}
+
+// AllMetrics возвращает значения всех метрик по ключу серии.
 func (b *Base) AllMetrics() map[string]string {
 	out := make(map[string]string)
+	for _, m := range b.AllMetricsJSON() {
+		out[m.Key()] = m.FormatValue()
+	}
+	return out
+}
 
-	query := `SELECT * FROM metrics_gauge
-			  UNION ALL
-		      SELECT * FROM metrics_counter;`
-	rows, err := b.conn.Query(query)
+func (b *Base) Range(mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return b.History(context.Background(), mType, name, from, to)
+}
+
+// History возвращает историю значений метрики в интервале [from, to].
+// Для интервала, уже удаленного из сырых значений, отдаются агрегированные значения.
+func (b *Base) History(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	out, err := b.history(ctx, mType, name, from, to)
+	return out, dbError(err)
+}
+
+func (b *Base) history(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	out := make([]entities.Sample, 0)
+
+	rows, err := b.pool.Query(ctx,
+		`SELECT ts, value, delta FROM metrics_samples
+		WHERE type = $1 AND name = $2 AND ts BETWEEN $3 AND $4
+		ORDER BY ts;`, mType, name, from, to)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sample entities.Sample
+		if err := rows.Scan(&sample.Timestamp, &sample.Value, &sample.Sum); err != nil {
+			return out, err
+		}
+		out = append(out, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	var oldest *time.Time
+	err = b.pool.QueryRow(ctx, `SELECT min(ts) FROM metrics_samples WHERE type = $1 AND name = $2;`, mType, name).Scan(&oldest)
+	if err != nil {
+		return out, err
+	}
+	cutoff := to.Add(time.Nanosecond)
+	if oldest != nil {
+		cutoff = *oldest
+	}
+	if !cutoff.After(from) {
+		return out, nil
+	}
+
+	tiers, err := b.rangeRollups(ctx, mType, name, from, to)
+	if err != nil {
+		return out, err
+	}
+	for _, t := range tiers {
+		if !cutoff.After(from) {
+			break
+		}
+		older := make([]entities.Sample, 0)
+		for _, sample := range t.samples {
+			// Значение уровня попадает в ответ, только если его интервал целиком раньше cutoff.
+			if !sample.Timestamp.Add(t.resolution).After(cutoff) {
+				older = append(older, sample)
+			}
+		}
+		out = append(older, out...)
+		if t.oldest.Before(cutoff) {
+			cutoff = t.oldest
+		}
+	}
+	return out, nil
+}
+
+type rollupTier struct {
+	resolution time.Duration
+	oldest     time.Time
+	samples    []entities.Sample
+}
+
+// rangeRollups возвращает агрегированные значения метрики по уровням от меньшего интервала к большему.
+func (b *Base) rangeRollups(ctx context.Context, mType, name string, from, to time.Time) ([]rollupTier, error) {
+	rows, err := b.pool.Query(ctx,
+		`SELECT resolution, min(ts) FROM metrics_rollups
+		WHERE type = $1 AND name = $2
+		GROUP BY resolution ORDER BY resolution;`, mType, name)
 	if err != nil {
-		return out
+		return nil, err
 	}
 	defer rows.Close()
 
-	var name, value string
+	tiers := make([]rollupTier, 0)
+	index := make(map[int64]int)
 	for rows.Next() {
-		err = rows.Scan(&name, &value)
+		var resolution int64
+		var t rollupTier
+		if err := rows.Scan(&resolution, &t.oldest); err != nil {
+			return nil, err
+		}
+		t.resolution = time.Duration(resolution) * time.Second
+		index[resolution] = len(tiers)
+		tiers = append(tiers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	samples, err := b.pool.Query(ctx,
+		`SELECT resolution, ts, value, min, max, count, sum FROM metrics_rollups
+		WHERE type = $1 AND name = $2 AND ts BETWEEN $3 AND $4
+		ORDER BY resolution, ts;`, mType, name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer samples.Close()
+
+	for samples.Next() {
+		var resolution int64
+		var sample entities.Sample
+		if err := samples.Scan(&resolution, &sample.Timestamp, &sample.Value, &sample.Min, &sample.Max, &sample.Count, &sample.Sum); err != nil {
+			return nil, err
+		}
+		if i, ok := index[resolution]; ok {
+			tiers[i].samples = append(tiers[i].samples, sample)
+		}
+	}
+	return tiers, samples.Err()
+}
+
+// Compact агрегирует историю по уровням политики и удаляет устаревшие значения в одной транзакции,
+// при отмене ctx транзакция откатывается.
+func (b *Base) Compact(ctx context.Context, now time.Time, retention Retention) error {
+	return dbError(b.compact(ctx, now, retention))
+}
+
+func (b *Base) compact(ctx context.Context, now time.Time, retention Retention) error {
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	for i, t := range retention.Tiers {
+		resolution := int64(t.Resolution / time.Second)
+
+		var watermark time.Time
+		err := tx.QueryRow(ctx,
+			`SELECT coalesce(max(ts) + $1::bigint * interval '1 second', 'epoch'::timestamptz)
+			FROM metrics_rollups WHERE resolution = $1::bigint;`, resolution).Scan(&watermark)
 		if err != nil {
-			slog.Error(fmt.Sprintln("AllMetrics ", err))
-			return out
+			return err
+		}
+
+		query := queryRollupRaw
+		args := []any{resolution, watermark, now.Truncate(t.Resolution)}
+		if i > 0 {
+			query = queryRollupTier
+			args = append(args, int64(retention.Tiers[i-1].Resolution/time.Second))
+		}
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return err
 		}
-		out[name] = value
 	}
-	err = rows.Err()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM metrics_samples WHERE ts < $1;`, now.Add(-retention.Raw)); err != nil {
+		return err
+	}
+	for _, t := range retention.Tiers {
+		_, err := tx.Exec(ctx, `DELETE FROM metrics_rollups WHERE resolution = $1 AND ts < $2;`,
+			int64(t.Resolution/time.Second), now.Add(-t.Keep))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// Запросы агрегации: gauge - среднее, минимум, максимум и количество, counter - последнее значение и сумма приращений.
+const (
+	queryRollupRaw = `INSERT INTO metrics_rollups (name, type, resolution, ts, value, min, max, count, sum)
+	SELECT name, type, $1::bigint, to_timestamp(floor(extract(epoch FROM ts) / $1::bigint) * $1::bigint) AS bucket,
+		CASE WHEN type = 'counter' THEN (array_agg(value ORDER BY ts DESC))[1] ELSE avg(value) END,
+		CASE WHEN type = 'gauge' THEN min(value) END,
+		CASE WHEN type = 'gauge' THEN max(value) END,
+		count(*),
+		CASE WHEN type = 'counter' THEN coalesce(sum(delta), 0) END
+	FROM metrics_samples WHERE ts >= $2 AND ts < $3
+	GROUP BY name, type, bucket
+	ON CONFLICT DO NOTHING;`
+
+	queryRollupTier = `INSERT INTO metrics_rollups (name, type, resolution, ts, value, min, max, count, sum)
+	SELECT name, type, $1::bigint, to_timestamp(floor(extract(epoch FROM ts) / $1::bigint) * $1::bigint) AS bucket,
+		CASE WHEN type = 'counter' THEN (array_agg(value ORDER BY ts DESC))[1] ELSE sum(value * count) / sum(count) END,
+		min(min), max(max), sum(count), sum(sum)
+	FROM metrics_rollups WHERE resolution = $4::bigint AND ts >= $2 AND ts < $3
+	GROUP BY name, type, bucket
+	ON CONFLICT DO NOTHING;`
+)
+
+func (b *Base) AllMetricsJSON() []entities.MetricsJSON {
+	out, err := b.Metrics(context.Background())
 	if err != nil {
-		slog.Error(fmt.Sprintln("AllMetrics ", err))
+		slog.Error(fmt.Sprintln("AllMetricsJSON ", err))
 	}
 	return out
 }
 
-func (b *Base) AllMetricsJSON() []entities.MetricsJSON {
+// Metrics возвращает все метрики, при ошибке - уже прочитанные метрики и ошибку.
+func (b *Base) Metrics(ctx context.Context) ([]entities.MetricsJSON, error) {
 	out := make([]entities.MetricsJSON, 0)
-	return out
+
+	query := `SELECT name, 'gauge', value, 0, labels FROM metrics_gauge
+			  UNION ALL
+			  SELECT name, 'counter', 0, value, labels FROM metrics_counter;`
+	rows, err := b.pool.Query(ctx, query)
+	if err != nil {
+		return out, dbError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value float64
+		var delta int64
+		var labels []byte
+		var m entities.MetricsJSON
+		if err := rows.Scan(&key, &m.MType, &value, &delta, &labels); err != nil {
+			return out, dbError(err)
+		}
+		m.ID, _ = entities.ParseSeriesKey(key)
+		if err := json.Unmarshal(labels, &m.Labels); err != nil || len(m.Labels) == 0 {
+			m.Labels = nil
+		}
+		if m.MType == entities.Gauge {
+			m.Value = &value
+		} else {
+			m.Delta = &delta
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return out, dbError(err)
+	}
+
+	for _, all := range []func(ctx context.Context) ([]entities.MetricsJSON, error){b.allHistograms, b.allSummaries, b.allSets} {
+		metrics, err := all(ctx)
+		out = append(out, metrics...)
+		if err != nil {
+			return out, dbError(err)
+		}
+	}
+	return out, nil
 }
 
-func (b *Base) SetMetrics(mertics []entities.MetricsJSON) error {
-	return entities.Retry(func() error { return b.requestSaveMerics(mertics) })
+func (b *Base) GetMetric(mType, name string) (entities.MetricsJSON, bool) {
+	m, err := b.Metric(context.Background(), mType, name)
+	if err != nil && !errors.Is(err, entities.ErrNotFound) {
+		slog.Error(fmt.Sprintln("GetMetric ", err))
+	}
+	return m, err == nil
 }
 
-func (b *Base) requestSaveMerics(mertics []entities.MetricsJSON) error {
-	tx, err := b.conn.Begin()
+// Metric возвращает метрику типа mType по ключу серии.
+func (b *Base) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	m := entities.MetricsJSON{MType: mType}
+	m.ID, m.Labels = entities.ParseSeriesKey(name)
+
+	var err error
+	switch mType {
+	case entities.Gauge:
+		var value float64
+		err = b.pool.QueryRow(ctx, `SELECT value FROM metrics_gauge WHERE name=$1;`, name).Scan(&value)
+		m.Value = &value
+	case entities.Counter:
+		var delta int64
+		err = b.pool.QueryRow(ctx, `SELECT value FROM metrics_counter WHERE name=$1;`, name).Scan(&delta)
+		m.Delta = &delta
+	case entities.Histogram:
+		m.Histogram, err = scanHistogram(b.pool.QueryRow(ctx, `SELECT bounds, counts, sum, count FROM metrics_histogram WHERE name=$1;`, name))
+	case entities.Summary:
+		var sketch []byte
+		err = b.pool.QueryRow(ctx, `SELECT sketch FROM metrics_summary WHERE name=$1;`, name).Scan(&sketch)
+		if err == nil {
+			err = json.Unmarshal(sketch, &m.Summary)
+		}
+	case entities.Set:
+		m.Set = &entities.SetData{}
+		err = b.pool.QueryRow(ctx, `SELECT precision, registers FROM metrics_set WHERE name=$1;`, name).Scan(&m.Set.Precision, &m.Set.Registers)
+	default:
+		return m, fmt.Errorf("%w %q: %s", entities.ErrNotFound, mType, name)
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, fmt.Errorf("%w: %s %s", entities.ErrNotFound, mType, name)
+	}
+	return m, dbError(err)
+}
+
+// allHistograms возвращает все гистограммы.
+func (b *Base) allHistograms(ctx context.Context) ([]entities.MetricsJSON, error) {
+	out := make([]entities.MetricsJSON, 0)
+	rows, err := b.pool.Query(ctx, `SELECT name, bounds, counts, sum, count FROM metrics_histogram;`)
 	if err != nil {
-		return err
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		h, err := scanHistogram(rows, &key)
+		if err != nil {
+			return out, err
+		}
+		m := entities.MetricsJSON{MType: entities.Histogram, Histogram: h}
+		m.ID, m.Labels = entities.ParseSeriesKey(key)
+		out = append(out, m)
 	}
-	defer tx.Rollback()
+	return out, rows.Err()
+}
 
-	stmtGauge, err := tx.Prepare(
-		`INSERT INTO metrics_gauge (name, value) 
-		VALUES ($1, $2) 
-		ON CONFLICT (name) 
-		DO UPDATE SET value = EXCLUDED.value;`)
+// allSummaries возвращает все summary.
+func (b *Base) allSummaries(ctx context.Context) ([]entities.MetricsJSON, error) {
+	out := make([]entities.MetricsJSON, 0)
+	rows, err := b.pool.Query(ctx, `SELECT name, sketch FROM metrics_summary;`)
 	if err != nil {
-		return err
+		return out, err
 	}
-	defer stmtGauge.Close()
+	defer rows.Close()
 
-	stmtCounter, err := tx.Prepare(
-		`INSERT INTO metrics_counter (name, value) 
-		VALUES ($1, $2) 
-		ON CONFLICT (name) 
-		DO UPDATE SET value = metrics_counter.value + EXCLUDED.value;`)
+	for rows.Next() {
+		var key string
+		var sketch []byte
+		if err := rows.Scan(&key, &sketch); err != nil {
+			return out, err
+		}
+		m := entities.MetricsJSON{MType: entities.Summary}
+		if err := json.Unmarshal(sketch, &m.Summary); err != nil {
+			return out, err
+		}
+		m.ID, m.Labels = entities.ParseSeriesKey(key)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// allSets возвращает все скетчи set.
+func (b *Base) allSets(ctx context.Context) ([]entities.MetricsJSON, error) {
+	out := make([]entities.MetricsJSON, 0)
+	rows, err := b.pool.Query(ctx, `SELECT name, precision, registers FROM metrics_set;`)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		m := entities.MetricsJSON{MType: entities.Set, Set: &entities.SetData{}}
+		if err := rows.Scan(&key, &m.Set.Precision, &m.Set.Registers); err != nil {
+			return out, err
+		}
+		m.ID, m.Labels = entities.ParseSeriesKey(key)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanHistogram читает bounds, counts, sum, count, перед ними - колонки prefix.
+func scanHistogram(row rowScanner, prefix ...any) (*entities.HistogramData, error) {
+	var bounds []float64
+	var counts []int64
+	h := &entities.HistogramData{}
+	dest := append(prefix, &bounds, &counts, &h.Sum, &h.Count)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	h.Bounds = bounds
+	h.Counts = make([]uint64, len(counts))
+	for i, c := range counts {
+		h.Counts[i] = uint64(c)
+	}
+	return h, nil
+}
+
+// labelsJSON метки ключа серии в формате jsonb.
+func labelsJSON(key string) string {
+	_, labels := entities.ParseSeriesKey(key)
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// SetMetrics сохраняет метрики одной транзакцией.
+// Gauge и counter отправляются одним пакетом запросов за один обмен с базой.
+// Для histogram, summary и set сохраненные значения сначала читаются одним пакетом
+// с блокировкой строк, объединяются на стороне сервера и записываются вторым пакетом.
+func (b *Base) SetMetrics(mertics []entities.MetricsJSON) error {
+	return b.UpdateMetrics(context.Background(), mertics)
+}
+
+// UpdateMetrics сохраняет пакет метрик, см. SetMetrics.
+func (b *Base) UpdateMetrics(ctx context.Context, mertics []entities.MetricsJSON) error {
+	for _, v := range mertics {
+		if err := validateMetric(v); err != nil {
+			return err
+		}
+	}
+	return dbError(entities.Retry(func() error { return b.requestSaveMerics(ctx, mertics) }))
+}
+
+// validateMetric проверяет метрику до обращения к базе, чтобы некорректный пакет не отправлялся.
+func validateMetric(v entities.MetricsJSON) error {
+	switch v.MType {
+	case entities.Gauge:
+		if v.Value == nil {
+			return fmt.Errorf("%w: %s has no value", entities.ErrInvalidGauge, v.Key())
+		}
+	case entities.Counter:
+		if _, err := v.CounterDelta(0, false); err != nil {
+			return err
+		}
+	case entities.Histogram:
+		if v.Histogram == nil {
+			return fmt.Errorf("%w: %s has no histogram value", entities.ErrInvalidHistogram, v.Key())
+		}
+		if err := v.Histogram.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", v.Key(), err)
+		}
+	case entities.Summary:
+		if v.Summary == nil {
+			return fmt.Errorf("%w: %s has no summary value", entities.ErrInvalidSummary, v.Key())
+		}
+		if err := v.Summary.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", v.Key(), err)
+		}
+	case entities.Set:
+		if v.Set == nil && len(v.Members) == 0 {
+			return fmt.Errorf("%w: %s has no members", entities.ErrInvalidSet, v.Key())
+		}
+		if v.Set != nil {
+			if err := v.Set.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", v.Key(), err)
+			}
+		}
+	default:
+		return fmt.Errorf("%w %q: %s", entities.ErrUnknownType, v.MType, v.Key())
+	}
+	return nil
+}
+
+// batchSender пул или транзакция, через которые отправляется пакет запросов.
+type batchSender interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+func (b *Base) requestSaveMerics(ctx context.Context, mertics []entities.MetricsJSON) error {
+	var sender batchSender = b.pool
+	var tx pgx.Tx
+	state := newSketchState()
+
+	if hasSketches(mertics) {
+		var err error
+		tx, err = b.pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(context.Background())
+
+		if err := state.load(ctx, tx, mertics); err != nil {
+			return err
+		}
+		sender = tx
+	}
+
+	batch, err := state.batch(mertics)
 	if err != nil {
 		return err
 	}
-	defer stmtCounter.Close()
+	// Без явной транзакции пакет выполняется в неявной транзакции и применяется целиком.
+	if err := sender.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	if tx != nil {
+		return tx.Commit(ctx)
+	}
+	return nil
+}
+
+// hasSketches есть ли в пакете метрики, которые объединяются с сохраненными значениями.
+func hasSketches(mertics []entities.MetricsJSON) bool {
+	for _, v := range mertics {
+		switch v.MType {
+		case entities.Histogram, entities.Summary, entities.Set:
+			return true
+		}
+	}
+	return false
+}
+
+// sketchState сохраненные значения histogram, summary и set из пакета по ключу серии.
+type sketchState struct {
+	bounds    map[string][]float64
+	summaries map[string]*entities.SummaryData
+	sets      map[string]*entities.SetData
+}
+
+func newSketchState() *sketchState {
+	return &sketchState{
+		bounds:    make(map[string][]float64),
+		summaries: make(map[string]*entities.SummaryData),
+		sets:      make(map[string]*entities.SetData),
+	}
+}
 
+// load читает сохраненные значения метрик пакета и блокирует их строки до конца транзакции.
+func (s *sketchState) load(ctx context.Context, tx pgx.Tx, mertics []entities.MetricsJSON) error {
+	keys := make(map[string][]string)
 	for _, v := range mertics {
-		if v.MType == entities.Gauge {
-			_, err := stmtGauge.Exec(v.ID, v.Value)
-			if err != nil {
-				return err
+		keys[v.MType] = append(keys[v.MType], v.Key())
+	}
+
+	batch := &pgx.Batch{}
+	if len(keys[entities.Histogram]) > 0 {
+		batch.Queue(`SELECT name, bounds FROM metrics_histogram WHERE name = ANY($1) FOR UPDATE;`,
+			keys[entities.Histogram]).Query(func(rows pgx.Rows) error {
+			for rows.Next() {
+				var key string
+				var bounds []float64
+				if err := rows.Scan(&key, &bounds); err != nil {
+					return err
+				}
+				s.bounds[key] = bounds
 			}
-		} else if v.MType == entities.Counter {
-			_, err := stmtCounter.Exec(v.ID, v.Delta)
-			if err != nil {
-				return err
+			return rows.Err()
+		})
+	}
+	if len(keys[entities.Summary]) > 0 {
+		batch.Queue(`SELECT name, sketch FROM metrics_summary WHERE name = ANY($1) FOR UPDATE;`,
+			keys[entities.Summary]).Query(func(rows pgx.Rows) error {
+			for rows.Next() {
+				var key string
+				var sketch []byte
+				if err := rows.Scan(&key, &sketch); err != nil {
+					return err
+				}
+				var summary entities.SummaryData
+				if err := json.Unmarshal(sketch, &summary); err != nil {
+					return err
+				}
+				s.summaries[key] = &summary
 			}
-		} else {
-			return errors.New("Неизвестный тип метрики " + v.ID)
+			return rows.Err()
+		})
+	}
+	if len(keys[entities.Set]) > 0 {
+		batch.Queue(`SELECT name, precision, registers FROM metrics_set WHERE name = ANY($1) FOR UPDATE;`,
+			keys[entities.Set]).Query(func(rows pgx.Rows) error {
+			for rows.Next() {
+				var key string
+				set := &entities.SetData{}
+				if err := rows.Scan(&key, &set.Precision, &set.Registers); err != nil {
+					return err
+				}
+				s.sets[key] = set
+			}
+			return rows.Err()
+		})
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// batch собирает пакет запросов записи. Summary и set объединяются с сохраненными
+// значениями и записываются один раз на серию, при несовпадении границ или точности
+// возвращается ошибка до отправки пакета.
+func (s *sketchState) batch(mertics []entities.MetricsJSON) (*pgx.Batch, error) {
+	batch := &pgx.Batch{}
+	// Серии summary и set в порядке первого появления в пакете.
+	var summaries, sets []string
+	seen := make(map[string]bool)
+
+	for _, v := range mertics {
+		key := v.Key()
+		switch v.MType {
+		case entities.Gauge:
+			batch.Queue(querySetGauge, key, *v.Value, labelsJSON(key))
+		case entities.Counter:
+			batch.Queue(querySetCounter, key, v.Delta, labelsJSON(key), v.Total)
+		case entities.Histogram:
+			if err := s.setHistogram(batch, v); err != nil {
+				return nil, err
+			}
+		case entities.Summary:
+			if err := s.mergeSummary(v); err != nil {
+				return nil, err
+			}
+			if !seen[v.MType+" "+key] {
+				seen[v.MType+" "+key] = true
+				summaries = append(summaries, key)
+			}
+		case entities.Set:
+			if err := s.mergeSet(v); err != nil {
+				return nil, err
+			}
+			if !seen[v.MType+" "+key] {
+				seen[v.MType+" "+key] = true
+				sets = append(sets, key)
+			}
+		}
+	}
+
+	for _, key := range summaries {
+		data, err := json.Marshal(s.summaries[key])
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(querySetSummary, key, labelsJSON(key), data)
+	}
+	for _, key := range sets {
+		set := s.sets[key]
+		batch.Queue(querySetSet, key, labelsJSON(key), int16(set.Precision), set.Registers)
+	}
+	return batch, nil
+}
+
+// setHistogram добавляет приращение гистограммы, при несовпадении границ возвращает ErrBoundsMismatch.
+func (s *sketchState) setHistogram(batch *pgx.Batch, v entities.MetricsJSON) error {
+	key := v.Key()
+	if bounds, ok := s.bounds[key]; ok {
+		if !equalBounds(bounds, v.Histogram.Bounds) {
+			return fmt.Errorf("%s: %w", key, entities.ErrBoundsMismatch)
+		}
+	} else {
+		s.bounds[key] = v.Histogram.Bounds
+	}
+
+	counts := make([]int64, len(v.Histogram.Counts))
+	for i, c := range v.Histogram.Counts {
+		counts[i] = int64(c)
+	}
+	batch.Queue(querySetHistogram, key, labelsJSON(key), v.Histogram.Bounds, counts, v.Histogram.Sum, int64(v.Histogram.Count)).
+		Exec(func(ct pgconn.CommandTag) error {
+			if ct.RowsAffected() == 0 {
+				return fmt.Errorf("%s: %w", key, entities.ErrBoundsMismatch)
+			}
+			return nil
+		})
+	return nil
+}
+
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
 	}
-	slog.Info("All right commit ")
-	return tx.Commit()
+	return true
+}
+
+// mergeSummary объединяет приращение summary с сохраненным скетчем,
+// при несовпадении точности возвращает ErrAccuracyMismatch.
+func (s *sketchState) mergeSummary(v entities.MetricsJSON) error {
+	key := v.Key()
+	current, ok := s.summaries[key]
+	if !ok {
+		s.summaries[key] = v.Summary.Clone()
+		return nil
+	}
+	if err := current.Merge(*v.Summary); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// mergeSet объединяет скетч set с сохраненным и добавляет новые значения,
+// при несовпадении точности возвращает ErrPrecisionMismatch.
+func (s *sketchState) mergeSet(v entities.MetricsJSON) error {
+	key := v.Key()
+	set, ok := s.sets[key]
+	if !ok {
+		set = entities.NewSet(entities.DefaultSetPrecision)
+		if v.Set != nil {
+			set = entities.NewSet(v.Set.Precision)
+		}
+		s.sets[key] = set
+	}
+	if v.Set != nil {
+		if err := set.Merge(*v.Set); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	for _, member := range v.Members {
+		set.Add(member)
+	}
+	return nil
 }
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchStateBatch(t *testing.T) {
+	value := 1.
+	delta := int64(2)
+	summary := entities.NewSummary(entities.DefaultSummaryAccuracy)
+	summary.Observe(1)
+	histogram := entities.NewHistogram([]float64{1, 10})
+
+	tests := []struct {
+		name    string
+		stored  func(s *sketchState)
+		metrics []entities.MetricsJSON
+		wantLen int
+		wantErr error
+	}{
+		{
+			name: "gauge and counter",
+			metrics: []entities.MetricsJSON{
+				{ID: "load", MType: entities.Gauge, Value: &value},
+				{ID: "requests", MType: entities.Counter, Delta: &delta},
+				{ID: "requests", MType: entities.Counter, Delta: &delta},
+			},
+			wantLen: 3,
+		},
+		{
+			name: "summary is written once per series",
+			metrics: []entities.MetricsJSON{
+				{ID: "size", MType: entities.Summary, Summary: summary},
+				{ID: "size", MType: entities.Summary, Summary: summary},
+				{ID: "users", MType: entities.Set, Members: []string{"a"}},
+				{ID: "users", MType: entities.Set, Members: []string{"b"}},
+			},
+			wantLen: 2,
+		},
+		{
+			name:    "stored histogram bounds",
+			stored:  func(s *sketchState) { s.bounds["latency"] = []float64{5} },
+			metrics: []entities.MetricsJSON{{ID: "latency", MType: entities.Histogram, Histogram: histogram}},
+			wantErr: entities.ErrBoundsMismatch,
+		},
+		{
+			name: "histogram bounds within batch",
+			metrics: []entities.MetricsJSON{
+				{ID: "latency", MType: entities.Histogram, Histogram: histogram},
+				{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{5})},
+			},
+			wantErr: entities.ErrBoundsMismatch,
+		},
+		{
+			name:    "stored summary accuracy",
+			stored:  func(s *sketchState) { s.summaries["size"] = entities.NewSummary(0.05) },
+			metrics: []entities.MetricsJSON{{ID: "size", MType: entities.Summary, Summary: summary}},
+			wantErr: entities.ErrAccuracyMismatch,
+		},
+		{
+			name:    "stored set precision",
+			stored:  func(s *sketchState) { s.sets["users"] = entities.NewSet(entities.MinSetPrecision) },
+			metrics: []entities.MetricsJSON{{ID: "users", MType: entities.Set, Set: entities.NewSet(entities.DefaultSetPrecision)}},
+			wantErr: entities.ErrPrecisionMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newSketchState()
+			if tt.stored != nil {
+				tt.stored(state)
+			}
+			batch, err := state.batch(tt.metrics)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLen, batch.Len())
+		})
+	}
+}
+
+func TestBaseLargeBatch(t *testing.T) {
+	dsn := testDatabaseDSN(t)
+
+	base, err := NewPDatabase(dsn, PoolOptions{MaxConns: 2})
+	require.NoError(t, err)
+	defer base.Close()
+	_, err = base.pool.Exec(context.Background(), `TRUNCATE metrics_gauge, metrics_counter, metrics_samples, metrics_series;`)
+	require.NoError(t, err)
+
+	metrics := make([]entities.MetricsJSON, 0, 10000)
+	for i := range 5000 {
+		value := float64(i)
+		delta := int64(i)
+		metrics = append(metrics,
+			entities.MetricsJSON{ID: fmt.Sprintf("gauge%d", i), MType: entities.Gauge, Value: &value},
+			entities.MetricsJSON{ID: fmt.Sprintf("counter%d", i), MType: entities.Counter, Delta: &delta})
+	}
+	require.NoError(t, base.SetMetrics(metrics))
+	assert.Len(t, base.AllMetricsJSON(), 10000)
+
+	// Запрос в отмененном контексте не выполняется.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, base.UpdateMetrics(ctx, metrics[:1]), entities.ErrUnavailable)
+	assert.ErrorIs(t, base.Check(ctx), entities.ErrUnavailable)
+	assert.ErrorIs(t, base.Compact(ctx, time.Now(), Retention{Raw: time.Hour}), entities.ErrUnavailable)
+}
+
+func TestBaseTypeMismatchConcurrent(t *testing.T) {
+	dsn := testDatabaseDSN(t)
+
+	base, err := NewPDatabase(dsn, PoolOptions{MaxConns: 4})
+	require.NoError(t, err)
+	defer base.Close()
+	_, err = base.pool.Exec(context.Background(), `TRUNCATE metrics_gauge, metrics_counter, metrics_samples, metrics_series;`)
+	require.NoError(t, err)
+
+	// Одновременное создание серии с разными типами: сохраняется только один тип.
+	ctx := context.Background()
+	for i := range 20 {
+		name := fmt.Sprintf("series%d", i)
+		errs := make(chan error, 2)
+		go func() { errs <- base.UpdateGauge(ctx, name, 1) }()
+		go func() { errs <- base.UpdateCounter(ctx, name, 1) }()
+
+		first, second := <-errs, <-errs
+		if first == nil {
+			first, second = second, first
+		}
+		require.NoError(t, second, name)
+		assert.ErrorIs(t, first, entities.ErrTypeMismatch, name)
+	}
+
+	// Обновление существующей серии проходит без проверки типа.
+	require.NoError(t, base.UpdateGauge(ctx, "load", 1))
+	require.NoError(t, base.UpdateGauge(ctx, "load", 2))
+	value, err := base.Gauge(ctx, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 2., value)
+}
@@ -1,24 +1,154 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/echo9et/alerting/internal/entities"
 )
 
+// memStoreShards количество шардов MemStore по умолчанию.
+const memStoreShards = 64
+
+// MemStore хранилище метрик в памяти, безопасное для конкурентного доступа.
+// Серии распределены по шардам по хешу ключа, у каждого шарда своя блокировка,
+// поэтому запись в разные серии не конкурирует за одну блокировку.
+// Пакет SetMetrics и снимок AllMetricsJSON блокируют шарды в порядке возрастания номера,
+// поэтому снимок видит пакет либо целиком, либо не видит совсем.
 type MemStore struct {
-	Metrics map[string]entities.MetricsJSON
+	shards []*shard
+}
+
+// shard часть серий MemStore, поля защищены mu.
+type shard struct {
+	// historySize количество сырых значений, хранимых для одной серии.
+	historySize int
+
+	mu      sync.RWMutex
+	metrics map[string]entities.MetricsJSON
+	history map[string]*series
+	// totals последние накопленные значения counter, переданные с Total.
+	totals map[string]int64
+}
+
+// series история метрики: сырые значения и агрегированные уровни.
+type series struct {
+	raw   *ring
+	tiers []*tier
+}
+
+// tier агрегированные значения одного уровня, watermark - граница уже агрегированных данных.
+type tier struct {
+	Tier
+	samples   *ring
+	watermark time.Time
 }
 
 func NewMemStore() *MemStore {
-	return &MemStore{
-		Metrics: make(map[string]entities.MetricsJSON),
+	return newMemStore(memStoreShards, historySize)
+}
+
+// NewMemStoreHistory хранилище, сохраняющее до size сырых значений каждой серии.
+// Чтобы сырая история покрывала Retention.Raw, size считается через Retention.RawSamples.
+func NewMemStoreHistory(size int) *MemStore {
+	return newMemStore(memStoreShards, size)
+}
+
+func newMemStore(shards, historySize int) *MemStore {
+	s := &MemStore{shards: make([]*shard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			historySize: historySize,
+			metrics:     make(map[string]entities.MetricsJSON),
+			history:     make(map[string]*series),
+			totals:      make(map[string]int64),
+		}
 	}
+	return s
+}
+
+func (s *MemStore) shardIndex(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+func (s *MemStore) shard(name string) *shard {
+	return s.shards[s.shardIndex(name)]
+}
+
+// lookup возвращает серию без блокировки, шард серии должен быть заблокирован вызывающим.
+func (s *MemStore) lookup(name string) (entities.MetricsJSON, bool) {
+	metric, ok := s.shard(name).metrics[name]
+	return metric, ok
+}
+
+// lockAll блокирует все шарды на чтение и возвращает функцию снятия блокировок.
+func (s *MemStore) lockAll() func() {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+	return func() {
+		for _, sh := range s.shards {
+			sh.mu.RUnlock()
+		}
+	}
+}
+
+// lockBatch блокирует на запись шарды серий пакета и возвращает функцию снятия блокировок.
+func (s *MemStore) lockBatch(metrics []entities.MetricsJSON) func() {
+	indexes := make([]int, 0, len(metrics))
+	for _, v := range metrics {
+		indexes = append(indexes, s.shardIndex(v.Key()))
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range indexes {
+			s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// cloneMetric копирует значения метрики, изменяемые на месте.
+func cloneMetric(metric entities.MetricsJSON) entities.MetricsJSON {
+	if metric.Histogram != nil {
+		metric.Histogram = metric.Histogram.Clone()
+	}
+	if metric.Summary != nil {
+		metric.Summary = metric.Summary.Clone()
+	}
+	if metric.Set != nil {
+		metric.Set = metric.Set.Clone()
+	}
+	return metric
+}
+
+// addSample сохраняет значение метрики в истории, для counter delta - приращение.
+func (sh *shard) addSample(name string, value float64, delta *float64) {
+	h, ok := sh.history[name]
+	if !ok {
+		h = &series{raw: newRing(sh.historySize)}
+		sh.history[name] = h
+	}
+	h.raw.push(entities.Sample{Timestamp: time.Now(), Value: value, Sum: delta})
 }
 
 func (s *MemStore) GetCounter(name string) (string, bool) {
-	metric, ok := s.Metrics[name]
+	sh := s.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	metric, ok := sh.metrics[name]
 	if ok {
 		if metric.MType == entities.Counter {
 			return fmt.Sprint(*metric.Delta), true
@@ -28,21 +158,36 @@ func (s *MemStore) GetCounter(name string) (string, bool) {
 }
 
 func (s *MemStore) SetCounter(name string, iValue int64) {
-	if metric, ok := s.Metrics[name]; ok {
+	if err := s.updateValue(name, entities.Counter, func(sh *shard) { sh.setCounter(name, iValue) }); err != nil {
+		slog.Error(fmt.Sprintf("SetCounter: %v", err))
+	}
+}
+
+func (sh *shard) setCounter(name string, iValue int64) {
+	delta := float64(iValue)
+	if metric, ok := sh.metrics[name]; ok && metric.MType == entities.Counter {
 		newValue := *(metric.Delta) + iValue
 		metric.Delta = &newValue
-		s.Metrics[name] = metric
+		sh.metrics[name] = metric
+		sh.addSample(name, float64(newValue), &delta)
 	} else {
-		s.Metrics[name] = entities.MetricsJSON{
-			ID:    name,
-			MType: entities.Counter,
-			Delta: &iValue,
+		id, labels := entities.ParseSeriesKey(name)
+		sh.metrics[name] = entities.MetricsJSON{
+			ID:     id,
+			MType:  entities.Counter,
+			Delta:  &iValue,
+			Labels: labels,
 		}
+		sh.addSample(name, float64(iValue), &delta)
 	}
 }
 
 func (s *MemStore) GetGauge(name string) (string, bool) {
-	metric, ok := s.Metrics[name]
+	sh := s.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	metric, ok := sh.metrics[name]
 	if ok {
 		if metric.MType == entities.Gauge {
 			return fmt.Sprint(*metric.Value), true
@@ -52,50 +197,497 @@ func (s *MemStore) GetGauge(name string) (string, bool) {
 }
 
 func (s *MemStore) SetGauge(name string, fValue float64) {
-	if metric, ok := s.Metrics[name]; ok {
+	if err := s.updateValue(name, entities.Gauge, func(sh *shard) { sh.setGauge(name, fValue) }); err != nil {
+		slog.Error(fmt.Sprintf("SetGauge: %v", err))
+	}
+}
+
+// updateValue применяет изменение к шарду серии, если серия не сохранена с другим типом.
+func (s *MemStore) updateValue(name, mType string, update func(sh *shard)) error {
+	sh := s.shard(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if err := typeMismatch(sh.metrics, name, mType); err != nil {
+		return err
+	}
+	update(sh)
+	return nil
+}
+
+// typeMismatch возвращает ErrTypeMismatch, если серия key уже сохранена с типом, отличным от mType.
+func typeMismatch(metrics map[string]entities.MetricsJSON, key, mType string) error {
+	if metric, ok := metrics[key]; ok && metric.MType != mType {
+		return fmt.Errorf("%w: %s is stored as %s, not %s", entities.ErrTypeMismatch, key, metric.MType, mType)
+	}
+	return nil
+}
+
+// checkTypes проверяет, что серии пакета не сохранены и не встречаются в пакете с другим типом.
+// Шарды серий пакета должны быть заблокированы.
+func (s *MemStore) checkTypes(metrics []entities.MetricsJSON) error {
+	batch := make(map[string]entities.MetricsJSON, len(metrics))
+	for _, v := range metrics {
+		key := v.Key()
+		if err := typeMismatch(batch, key, v.MType); err != nil {
+			return err
+		}
+		if err := typeMismatch(s.shard(key).metrics, key, v.MType); err != nil {
+			return err
+		}
+		batch[key] = v
+	}
+	return nil
+}
+
+func (sh *shard) setGauge(name string, fValue float64) {
+	if metric, ok := sh.metrics[name]; ok && metric.MType == entities.Gauge {
 		metric.Value = &fValue
-		s.Metrics[name] = metric
+		sh.metrics[name] = metric
 	} else {
-		s.Metrics[name] = entities.MetricsJSON{
-			ID:    name,
-			MType: entities.Gauge,
-			Value: &fValue,
+		id, labels := entities.ParseSeriesKey(name)
+		sh.metrics[name] = entities.MetricsJSON{
+			ID:     id,
+			MType:  entities.Gauge,
+			Value:  &fValue,
+			Labels: labels,
 		}
 	}
+	sh.addSample(name, fValue, nil)
 }
 
+// AllMetrics возвращает значения всех метрик по ключу серии.
 func (s *MemStore) AllMetrics() map[string]string {
+	unlock := s.lockAll()
+	defer unlock()
+
 	out := make(map[string]string)
-	for k, v := range s.Metrics {
-		out[k] = fmt.Sprint(v)
+	for _, sh := range s.shards {
+		for k, v := range sh.metrics {
+			out[k] = v.FormatValue()
+		}
 	}
 	return out
 }
 
+// AllMetricsJSON возвращает согласованный снимок всех метрик.
 func (s *MemStore) AllMetricsJSON() []entities.MetricsJSON {
+	unlock := s.lockAll()
+	defer unlock()
 
 	metricsJSON := make([]entities.MetricsJSON, 0)
+	for _, sh := range s.shards {
+		for _, metric := range sh.metrics {
+			metricsJSON = append(metricsJSON, cloneMetric(metric))
+		}
+	}
+	return metricsJSON
+}
+
+// MetricsWithTotals снимок всех метрик, как AllMetricsJSON, у counter заполнено
+// последнее накопленное значение Total, если оно передавалось.
+func (s *MemStore) MetricsWithTotals() []entities.MetricsJSON {
+	unlock := s.lockAll()
+	defer unlock()
 
-	for _, metric := range s.Metrics {
-		metricsJSON = append(metricsJSON, metric)
+	metricsJSON := make([]entities.MetricsJSON, 0)
+	for _, sh := range s.shards {
+		for key, metric := range sh.metrics {
+			metric = cloneMetric(metric)
+			if total, ok := sh.totals[key]; ok && metric.MType == entities.Counter {
+				metric.Total = &total
+			}
+			metricsJSON = append(metricsJSON, metric)
+		}
 	}
 	return metricsJSON
 }
 
+// RestoreTotal восстанавливает накопленное значение counter без изменения самого counter.
+func (s *MemStore) RestoreTotal(key string, total int64) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.totals[key] = total
+}
+
+// GetMetric возвращает метрику типа mType по ключу серии.
+func (s *MemStore) GetMetric(mType, name string) (entities.MetricsJSON, bool) {
+	sh := s.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	metric, ok := sh.metrics[name]
+	if !ok || metric.MType != mType {
+		return entities.MetricsJSON{}, false
+	}
+	return cloneMetric(metric), true
+}
+
+// addHistogram добавляет приращение гистограммы, границы проверяются в checkHistograms.
+func (sh *shard) addHistogram(name string, h entities.HistogramData) {
+	if metric, ok := sh.metrics[name]; ok && metric.MType == entities.Histogram {
+		metric.Histogram.Merge(h)
+		return
+	}
+	id, labels := entities.ParseSeriesKey(name)
+	sh.metrics[name] = entities.MetricsJSON{
+		ID:        id,
+		MType:     entities.Histogram,
+		Labels:    labels,
+		Histogram: h.Clone(),
+	}
+}
+
+// checkHistograms проверяет гистограммы пакета до записи, чтобы пакет не применялся частично.
+// Шарды серий пакета должны быть заблокированы.
+func (s *MemStore) checkHistograms(metrics []entities.MetricsJSON) error {
+	bounds := make(map[string][]float64)
+	for _, v := range metrics {
+		if v.MType != entities.Histogram {
+			continue
+		}
+		if v.Histogram == nil {
+			return fmt.Errorf("%w: %s has no histogram value", entities.ErrInvalidHistogram, v.Key())
+		}
+		if err := v.Histogram.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", v.Key(), err)
+		}
+
+		key := v.Key()
+		b, ok := bounds[key]
+		if !ok {
+			if metric, exists := s.lookup(key); exists && metric.MType == entities.Histogram {
+				b, ok = metric.Histogram.Bounds, true
+			}
+		}
+		if ok && !slices.Equal(b, v.Histogram.Bounds) {
+			return fmt.Errorf("%s: %w", key, entities.ErrBoundsMismatch)
+		}
+		bounds[key] = v.Histogram.Bounds
+	}
+	return nil
+}
+
+// setCounterTotal добавляет приращение counter, вычисленное с учетом накопленного значения.
+func (sh *shard) setCounterTotal(v entities.MetricsJSON) {
+	key := v.Key()
+	last, known := sh.totals[key]
+	delta, _ := v.CounterDelta(last, known)
+	if v.Total != nil {
+		if known && *v.Total < last {
+			slog.Info("counter reset", "key", key, "total", *v.Total, "last", last)
+		}
+		sh.totals[key] = *v.Total
+	}
+	sh.setCounter(key, delta)
+}
+
+// addSummary добавляет приращение summary, точность проверяется в checkSummaries.
+func (sh *shard) addSummary(name string, sd entities.SummaryData) {
+	if metric, ok := sh.metrics[name]; ok && metric.MType == entities.Summary {
+		metric.Summary.Merge(sd)
+		return
+	}
+	id, labels := entities.ParseSeriesKey(name)
+	sh.metrics[name] = entities.MetricsJSON{
+		ID:      id,
+		MType:   entities.Summary,
+		Labels:  labels,
+		Summary: sd.Clone(),
+	}
+}
+
+// checkSummaries проверяет summary пакета до записи, чтобы пакет не применялся частично.
+// Шарды серий пакета должны быть заблокированы.
+func (s *MemStore) checkSummaries(metrics []entities.MetricsJSON) error {
+	accuracy := make(map[string]float64)
+	for _, v := range metrics {
+		if v.MType != entities.Summary {
+			continue
+		}
+		if v.Summary == nil {
+			return fmt.Errorf("%w: %s has no summary value", entities.ErrInvalidSummary, v.Key())
+		}
+		if err := v.Summary.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", v.Key(), err)
+		}
+
+		key := v.Key()
+		a, ok := accuracy[key]
+		if !ok {
+			if metric, exists := s.lookup(key); exists && metric.MType == entities.Summary {
+				a, ok = metric.Summary.Accuracy, true
+			}
+		}
+		if ok && a != v.Summary.Accuracy {
+			return fmt.Errorf("%s: %w", key, entities.ErrAccuracyMismatch)
+		}
+		accuracy[key] = v.Summary.Accuracy
+	}
+	return nil
+}
+
+// addSet объединяет скетч set с сохраненным и добавляет новые значения, точность проверяется в checkSets.
+func (sh *shard) addSet(name string, v entities.MetricsJSON) {
+	metric, ok := sh.metrics[name]
+	if !ok || metric.MType != entities.Set {
+		id, labels := entities.ParseSeriesKey(name)
+		metric = entities.MetricsJSON{ID: id, MType: entities.Set, Labels: labels, Set: entities.NewSet(entities.DefaultSetPrecision)}
+		if v.Set != nil {
+			metric.Set = entities.NewSet(v.Set.Precision)
+		}
+		sh.metrics[name] = metric
+	}
+	if v.Set != nil {
+		metric.Set.Merge(*v.Set)
+	}
+	for _, member := range v.Members {
+		metric.Set.Add(member)
+	}
+}
+
+// checkSets проверяет скетчи set пакета до записи, чтобы пакет не применялся частично.
+// Шарды серий пакета должны быть заблокированы.
+func (s *MemStore) checkSets(metrics []entities.MetricsJSON) error {
+	precision := make(map[string]uint8)
+	for _, v := range metrics {
+		if v.MType != entities.Set {
+			continue
+		}
+		if v.Set == nil && len(v.Members) == 0 {
+			return fmt.Errorf("%w: %s has no members", entities.ErrInvalidSet, v.Key())
+		}
+		if v.Set == nil {
+			continue
+		}
+		if err := v.Set.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", v.Key(), err)
+		}
+
+		key := v.Key()
+		p, ok := precision[key]
+		if !ok {
+			if metric, exists := s.lookup(key); exists && metric.MType == entities.Set {
+				p, ok = metric.Set.Precision, true
+			}
+		}
+		if ok && p != v.Set.Precision {
+			return fmt.Errorf("%s: %w", key, entities.ErrPrecisionMismatch)
+		}
+		precision[key] = v.Set.Precision
+	}
+	return nil
+}
+
+// Range возвращает историю значений метрики в интервале [from, to].
+// Для интервала, уже удаленного из сырых значений, отдаются агрегированные значения.
+func (s *MemStore) Range(mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	sh := s.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	metric, ok := sh.metrics[name]
+	h := sh.history[name]
+	if !ok || metric.MType != mType || h == nil {
+		return make([]entities.Sample, 0), nil
+	}
+
+	out := h.raw.between(from, to)
+	cutoff, ok := h.raw.oldest()
+	if !ok {
+		cutoff = to.Add(time.Nanosecond)
+	}
+	for _, t := range h.tiers {
+		if !cutoff.After(from) {
+			break
+		}
+		// Значение уровня попадает в ответ, только если его интервал целиком раньше cutoff.
+		older := t.samples.between(from, minTime(to, cutoff.Add(-t.Resolution)))
+		out = append(older, out...)
+		if oldest, ok := t.samples.oldest(); ok && oldest.Before(cutoff) {
+			cutoff = oldest
+		}
+	}
+	return out, nil
+}
+
+// Compact агрегирует историю по уровням политики и удаляет устаревшие значения.
+// Шарды обрабатываются по очереди, запись в остальные шарды при этом не блокируется.
+// При отмене ctx оставшиеся шарды сжимаются при следующем вызове.
+func (s *MemStore) Compact(ctx context.Context, now time.Time, retention Retention) error {
+	for _, sh := range s.shards {
+		if err := contextErr(ctx); err != nil {
+			return err
+		}
+		sh.mu.Lock()
+		for name, h := range sh.history {
+			h.compact(sh.metrics[name].MType, now, retention)
+		}
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+func (h *series) compact(mType string, now time.Time, retention Retention) {
+	if len(h.tiers) != len(retention.Tiers) {
+		h.tiers = make([]*tier, len(retention.Tiers))
+		for i, t := range retention.Tiers {
+			h.tiers[i] = &tier{Tier: t, samples: newRing(int(t.Keep/t.Resolution) + 1)}
+		}
+	}
+
+	source := h.raw
+	for _, t := range h.tiers {
+		complete := now.Truncate(t.Resolution)
+		if complete.After(t.watermark) {
+			pending := source.between(t.watermark, complete.Add(-time.Nanosecond))
+			for _, sample := range rollupSamples(pending, mType, t.Resolution) {
+				t.samples.push(sample)
+			}
+			t.watermark = complete
+		}
+		source = t.samples
+	}
+
+	h.raw.dropBefore(now.Add(-retention.Raw))
+	for _, t := range h.tiers {
+		t.samples.dropBefore(now.Add(-t.Keep))
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
 func (s *MemStore) Ping() bool {
 	return true
 }
 
+// SetMetrics записывает пакет метрик атомарно: при ошибке проверки пакет не применяется,
+// конкурентные снимки видят пакет целиком.
 func (s *MemStore) SetMetrics(metrics []entities.MetricsJSON) error {
+	unlock := s.lockBatch(metrics)
+	defer unlock()
+
+	if err := s.checkTypes(metrics); err != nil {
+		return err
+	}
+	if err := s.checkHistograms(metrics); err != nil {
+		return err
+	}
+	if err := s.checkSummaries(metrics); err != nil {
+		return err
+	}
+	if err := s.checkSets(metrics); err != nil {
+		return err
+	}
+	for _, v := range metrics {
+		switch v.MType {
+		case entities.Gauge:
+			if v.Value == nil {
+				return fmt.Errorf("%w: %s has no value", entities.ErrInvalidGauge, v.Key())
+			}
+		case entities.Counter:
+			if _, err := v.CounterDelta(0, false); err != nil {
+				return err
+			}
+		case entities.Histogram, entities.Summary, entities.Set:
+		default:
+			return fmt.Errorf("%w %q: %s", entities.ErrUnknownType, v.MType, v.Key())
+		}
+	}
+
 	for _, v := range metrics {
+		sh := s.shard(v.Key())
 		if v.MType == entities.Gauge {
-			s.SetGauge(v.ID, *v.Value)
+			sh.setGauge(v.Key(), *v.Value)
 		} else if v.MType == entities.Counter {
-			s.SetCounter(v.ID, *v.Delta)
-
-		} else {
-			slog.Warn("Unknow Type", "type", v.MType)
+			sh.setCounterTotal(v)
+		} else if v.MType == entities.Histogram {
+			sh.addHistogram(v.Key(), *v.Histogram)
+		} else if v.MType == entities.Summary {
+			sh.addSummary(v.Key(), *v.Summary)
+		} else if v.MType == entities.Set {
+			sh.addSet(v.Key(), v)
 		}
 	}
 	return nil
 }
+
+// Gauge значение gauge, ErrNotFound если серии нет.
+func (s *MemStore) Gauge(ctx context.Context, name string) (float64, error) {
+	m, err := s.Metric(ctx, entities.Gauge, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Value, nil
+}
+
+// Counter значение counter, ErrNotFound если серии нет.
+func (s *MemStore) Counter(ctx context.Context, name string) (int64, error) {
+	m, err := s.Metric(ctx, entities.Counter, name)
+	if err != nil {
+		return 0, err
+	}
+	return *m.Delta, nil
+}
+
+// UpdateGauge сохраняет значение gauge.
+func (s *MemStore) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	return s.updateValue(name, entities.Gauge, func(sh *shard) { sh.setGauge(name, value) })
+}
+
+// UpdateCounter добавляет приращение counter.
+func (s *MemStore) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	return s.updateValue(name, entities.Counter, func(sh *shard) { sh.setCounter(name, delta) })
+}
+
+// Metric возвращает метрику типа mType по ключу серии, ErrNotFound если серии нет.
+func (s *MemStore) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	if err := contextErr(ctx); err != nil {
+		return entities.MetricsJSON{}, err
+	}
+	m, ok := s.GetMetric(mType, name)
+	if !ok {
+		return m, fmt.Errorf("%w: %s %s", entities.ErrNotFound, mType, name)
+	}
+	return m, nil
+}
+
+// Metrics возвращает согласованный снимок всех метрик.
+func (s *MemStore) Metrics(ctx context.Context) ([]entities.MetricsJSON, error) {
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+	return s.AllMetricsJSON(), nil
+}
+
+// UpdateMetrics записывает пакет метрик, см. SetMetrics.
+func (s *MemStore) UpdateMetrics(ctx context.Context, metrics []entities.MetricsJSON) error {
+	if err := contextErr(ctx); err != nil {
+		return err
+	}
+	return s.SetMetrics(metrics)
+}
+
+// History возвращает историю значений метрики, см. Range.
+func (s *MemStore) History(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+	return s.Range(mType, name, from, to)
+}
+
+// Check хранилище в памяти доступно всегда.
+func (s *MemStore) Check(ctx context.Context) error {
+	return contextErr(ctx)
+}
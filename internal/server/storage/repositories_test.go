@@ -1,8 +1,16 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
 )
 
 func TestStorageCounter(t *testing.T) {
@@ -71,7 +79,7 @@ func TestStorageGauge(t *testing.T) {
 }
 
 func TestSaver(t *testing.T) {
-	saver, _ := NewSaver(NewMemStore(), "test.json", false, time.Second*2000)
+	saver, _ := NewSaver(NewMemStore(), filepath.Join(t.TempDir(), "test.json"), false, time.Second*2000, SaverOptions{})
 	tests := []struct {
 		name  string
 		saver *Saver
@@ -104,7 +112,7 @@ func TestSaver(t *testing.T) {
 }
 
 func TestSavereGauge(t *testing.T) {
-	saver, _ := NewSaver(NewMemStore(), "test.json", false, time.Second*2000)
+	saver, _ := NewSaver(NewMemStore(), filepath.Join(t.TempDir(), "test.json"), false, time.Second*2000, SaverOptions{})
 	tests := []struct {
 		name  string
 		saver *Saver
@@ -135,3 +143,228 @@ func TestSavereGauge(t *testing.T) {
 		})
 	}
 }
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r.push(entities.Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+
+	got := r.between(start, start.Add(time.Minute))
+	want := []float64{2, 3, 4}
+	if len(got) != len(want) {
+		t.Fatalf("between() len = %d, want: %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Value != want[i] {
+			t.Errorf("between()[%d] = %v, want: %v", i, got[i].Value, want[i])
+		}
+	}
+
+	got = r.between(start.Add(3*time.Second), start.Add(3*time.Second))
+	if len(got) != 1 || got[0].Value != 3 {
+		t.Errorf("between() = %v, want single value 3", got)
+	}
+}
+
+func TestMemStoreRange(t *testing.T) {
+	s := NewMemStore()
+	from := time.Now().Add(-time.Second)
+	s.SetCounter("c", 2)
+	s.SetCounter("c", 3)
+	s.SetGauge("g", 1.5)
+	to := time.Now().Add(time.Second)
+
+	counters, err := s.Range(entities.Counter, "c", from, to)
+	if err != nil || len(counters) != 2 || counters[1].Value != 5 {
+		t.Errorf("Range(counter, c) = %v, %v, want two samples ending with 5", counters, err)
+	}
+
+	gauges, err := s.Range(entities.Gauge, "g", from, to)
+	if err != nil || len(gauges) != 1 || gauges[0].Value != 1.5 {
+		t.Errorf("Range(gauge, g) = %v, %v, want single sample 1.5", gauges, err)
+	}
+
+	mismatch, err := s.Range(entities.Gauge, "c", from, to)
+	if err != nil || len(mismatch) != 0 {
+		t.Errorf("Range(gauge, c) = %v, %v, want empty", mismatch, err)
+	}
+}
+
+func TestStorageCounterTotal(t *testing.T) {
+	storage := NewMemStore()
+	counter := func(delta, total int64) entities.MetricsJSON {
+		return entities.MetricsJSON{ID: "Mallocs", MType: entities.Counter, Delta: &delta, Total: &total}
+	}
+
+	tests := []struct {
+		name   string
+		metric entities.MetricsJSON
+		want   string
+	}{
+		{name: "first report uses delta", metric: counter(10, 100), want: "10"},
+		{name: "delta from total", metric: counter(30, 130), want: "40"},
+		{name: "retry is not counted twice", metric: counter(30, 130), want: "40"},
+		{name: "agent restart", metric: counter(5, 5), want: "45"},
+		{name: "after restart", metric: counter(15, 20), want: "60"},
+		{name: "without total", metric: entities.MetricsJSON{ID: "Mallocs", MType: entities.Counter, Delta: new(int64)}, want: "60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := storage.SetMetrics([]entities.MetricsJSON{tt.metric}); err != nil {
+				t.Fatal(err)
+			}
+			v, _ := storage.GetCounter("Mallocs")
+			if v != tt.want {
+				t.Errorf("counter = %s, want: %s", v, tt.want)
+			}
+		})
+	}
+
+	err := storage.SetMetrics([]entities.MetricsJSON{{ID: "Mallocs", MType: entities.Counter}})
+	if !errors.Is(err, entities.ErrInvalidCounter) {
+		t.Errorf("SetMetrics without delta and total = %v, want: %v", err, entities.ErrInvalidCounter)
+	}
+}
+
+func TestMemStoreConcurrent(t *testing.T) {
+	const (
+		workers    = 8
+		iterations = 200
+	)
+	storage := NewMemStore()
+	retention := Retention{Raw: time.Hour}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				storage.SetCounter("requests", 1)
+				storage.SetGauge(fmt.Sprintf("load{worker=\"%d\"}", w), float64(i))
+				total := int64(i + 1)
+				err := storage.SetMetrics([]entities.MetricsJSON{
+					{ID: "requests", MType: entities.Counter, Delta: new(int64)},
+					{ID: "sent", MType: entities.Counter, Labels: map[string]string{"worker": strconv.Itoa(w)}, Delta: &total, Total: &total},
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				storage.AllMetricsJSON()
+				storage.GetCounter("requests")
+				storage.GetMetric(entities.Counter, "requests")
+				if _, err := storage.Range(entities.Counter, "requests", time.Time{}, time.Now()); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%100 == 0 {
+					storage.Compact(context.Background(), time.Now(), retention)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := strconv.Itoa(workers * iterations)
+	if v, _ := storage.GetCounter("requests"); v != want {
+		t.Errorf("requests = %s, want: %s", v, want)
+	}
+	for w := 0; w < workers; w++ {
+		key := fmt.Sprintf("sent{worker=\"%d\"}", w)
+		if v, _ := storage.GetCounter(key); v != strconv.Itoa(iterations) {
+			t.Errorf("%s = %s, want: %d", key, v, iterations)
+		}
+	}
+	if n := len(storage.AllMetricsJSON()); n != 2*workers+1 {
+		t.Errorf("len(AllMetricsJSON()) = %d, want: %d", n, 2*workers+1)
+	}
+}
+
+func TestMemStoreSnapshotConsistent(t *testing.T) {
+	storage := NewMemStore()
+	// Серии пакета должны лежать в разных шардах, иначе согласованность проверяется тривиально.
+	first, second := "a", "b"
+	for i := 0; storage.shardIndex(first) == storage.shardIndex(second); i++ {
+		second = "b" + strconv.Itoa(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			v := float64(i)
+			storage.SetMetrics([]entities.MetricsJSON{
+				{ID: first, MType: entities.Gauge, Value: &v},
+				{ID: second, MType: entities.Gauge, Value: &v},
+			})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		values := make(map[string]float64)
+		for _, m := range storage.AllMetricsJSON() {
+			values[m.ID] = *m.Value
+		}
+		if values[first] != values[second] {
+			t.Fatalf("snapshot sees partial batch: %s = %v, %s = %v", first, values[first], second, values[second])
+		}
+	}
+}
+
+// BenchmarkMemStore сравнивает хранилище с одной блокировкой на все серии (shards=1),
+// что соответствует прежней реализации на одной карте, и хранилище с шардами.
+func BenchmarkMemStore(b *testing.B) {
+	keys := make([]string, 256)
+	for i := range keys {
+		keys[i] = "metric" + strconv.Itoa(i)
+	}
+
+	for _, shards := range []int{1, memStoreShards} {
+		b.Run(fmt.Sprintf("shards=%d/SetCounter", shards), func(b *testing.B) {
+			storage := newMemStore(shards, historySize)
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					storage.SetCounter(keys[i%len(keys)], 1)
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("shards=%d/SetGauge", shards), func(b *testing.B) {
+			storage := newMemStore(shards, historySize)
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					storage.SetGauge(keys[i%len(keys)], float64(i))
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("shards=%d/Mixed", shards), func(b *testing.B) {
+			storage := newMemStore(shards, historySize)
+			for _, k := range keys {
+				storage.SetGauge(k, 0)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					key := keys[i%len(keys)]
+					switch i % 4 {
+					case 0:
+						storage.SetGauge(key, float64(i))
+					default:
+						storage.GetGauge(key)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// Tier уровень агрегации истории: значения усредняются по интервалу Resolution и хранятся Keep.
+type Tier struct {
+	Resolution time.Duration
+	Keep       time.Duration
+}
+
+// Retention политика хранения истории метрик.
+type Retention struct {
+	Raw   time.Duration
+	Tiers []Tier
+}
+
+// Compacter хранилище, поддерживающее агрегацию и удаление устаревшей истории.
+// Отмена ctx прерывает сжатие, уже выполненная часть сохраняется или откатывается целиком
+// в зависимости от хранилища.
+type Compacter interface {
+	Compact(ctx context.Context, now time.Time, retention Retention) error
+}
+
+// ParseRetention разбирает политику вида `raw:24h,1m:7d,1h:90d`.
+// Длительности поддерживают суффикс d - сутки.
+func ParseRetention(s string) (Retention, error) {
+	var r Retention
+	for i, part := range strings.Split(s, ",") {
+		resolution, keep, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return r, fmt.Errorf("retention %q: expected resolution:keep", part)
+		}
+
+		keepDuration, err := parseDays(keep)
+		if err != nil || keepDuration <= 0 {
+			return r, fmt.Errorf("retention %q: invalid keep %q", part, keep)
+		}
+
+		if i == 0 {
+			if resolution != "raw" {
+				return r, fmt.Errorf("retention %q: first tier must be raw", part)
+			}
+			r.Raw = keepDuration
+			continue
+		}
+
+		resolutionDuration, err := parseDays(resolution)
+		if err != nil || resolutionDuration <= 0 {
+			return r, fmt.Errorf("retention %q: invalid resolution %q", part, resolution)
+		}
+		r.Tiers = append(r.Tiers, Tier{Resolution: resolutionDuration, Keep: keepDuration})
+	}
+	return r, r.validate()
+}
+
+// RawSamples количество сырых значений серии, записываемой раз в interval, за время Raw.
+// Если серия пишется чаще, в памяти остается только последняя часть сырой истории.
+func (r Retention) RawSamples(interval time.Duration) int {
+	return int(r.Raw/interval) + 1
+}
+
+func (r Retention) validate() error {
+	prev := Tier{Resolution: 0, Keep: r.Raw}
+	for _, tier := range r.Tiers {
+		if tier.Resolution%time.Second != 0 {
+			return fmt.Errorf("retention: resolution %s must be a whole number of seconds", tier.Resolution)
+		}
+		if prev.Resolution != 0 && (tier.Resolution <= prev.Resolution || tier.Resolution%prev.Resolution != 0) {
+			return fmt.Errorf("retention: resolution %s must be a multiple of %s", tier.Resolution, prev.Resolution)
+		}
+		if tier.Resolution >= prev.Keep {
+			return fmt.Errorf("retention: resolution %s must be less than previous keep %s", tier.Resolution, prev.Keep)
+		}
+		if tier.Keep <= prev.Keep {
+			return fmt.Errorf("retention: keep %s must be greater than previous keep %s", tier.Keep, prev.Keep)
+		}
+		prev = tier
+	}
+	return nil
+}
+
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		d, err := time.ParseDuration(days + "h")
+		return d * 24, err
+	}
+	return time.ParseDuration(s)
+}
+
+// RunCompactor периодически применяет политику хранения до отмены контекста.
+func RunCompactor(ctx context.Context, c Compacter, retention Retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := c.Compact(ctx, now, retention); err != nil && ctx.Err() == nil {
+				slog.Error(fmt.Sprintf("compact history: %s", err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rollupSamples агрегирует упорядоченные по времени значения по интервалам resolution.
+// Исходные значения могут быть как сырыми, так и уже агрегированными.
+func rollupSamples(samples []entities.Sample, mType string, resolution time.Duration) []entities.Sample {
+	out := make([]entities.Sample, 0)
+
+	var bucket time.Time
+	var count int64
+	var total, sum, min, max, last float64
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		sample := entities.Sample{Timestamp: bucket, Count: count}
+		if mType == entities.Counter {
+			bucketSum := sum
+			sample.Value = last
+			sample.Sum = &bucketSum
+		} else {
+			bucketMin, bucketMax := min, max
+			sample.Value = total / float64(count)
+			sample.Min = &bucketMin
+			sample.Max = &bucketMax
+		}
+		out = append(out, sample)
+	}
+
+	for _, s := range samples {
+		b := s.Timestamp.Truncate(resolution)
+		if count == 0 || !b.Equal(bucket) {
+			flush()
+			bucket = b
+			count, total, sum = 0, 0, 0
+			min, max = s.Value, s.Value
+		}
+
+		n := s.Count
+		if n == 0 {
+			n = 1
+		}
+		count += n
+		total += s.Value * float64(n)
+		last = s.Value
+		if s.Sum != nil {
+			sum += *s.Sum
+		}
+
+		low, high := s.Value, s.Value
+		if s.Min != nil {
+			low = *s.Min
+		}
+		if s.Max != nil {
+			high = *s.Max
+		}
+		if low < min {
+			min = low
+		}
+		if high > max {
+			max = high
+		}
+	}
+	flush()
+	return out
+}
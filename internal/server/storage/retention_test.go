@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Retention
+		wantErr bool
+	}{
+		{
+			name:  "default policy",
+			value: "raw:24h,1m:7d,1h:90d",
+			want: Retention{
+				Raw: 24 * time.Hour,
+				Tiers: []Tier{
+					{Resolution: time.Minute, Keep: 7 * 24 * time.Hour},
+					{Resolution: time.Hour, Keep: 90 * 24 * time.Hour},
+				},
+			},
+		},
+		{name: "raw only", value: "raw:1h", want: Retention{Raw: time.Hour}},
+		{name: "missing raw", value: "1m:7d", wantErr: true},
+		{name: "not multiple", value: "raw:24h,1m:7d,90s:30d", wantErr: true},
+		{name: "keep not growing", value: "raw:24h,1m:12h", wantErr: true},
+		{name: "bad duration", value: "raw:day", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetentionRawSamples(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      time.Duration
+		interval time.Duration
+		want     int
+	}{
+		{name: "default policy", raw: 24 * time.Hour, interval: 10 * time.Second, want: historySize},
+		{name: "every second", raw: time.Hour, interval: time.Second, want: 3601},
+		{name: "interval longer than raw", raw: time.Minute, interval: time.Hour, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Retention{Raw: tt.raw}.RawSamples(tt.interval))
+		})
+	}
+}
+
+func TestMemStoreHistorySize(t *testing.T) {
+	s := NewMemStoreHistory(5000)
+	from := time.Now()
+	for i := 0; i < 6000; i++ {
+		s.SetGauge("load", float64(i))
+	}
+
+	samples, err := s.Range(entities.Gauge, "load", from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 5000)
+	assert.Equal(t, 1000., samples[0].Value)
+}
+
+func TestRollupSamples(t *testing.T) {
+	start := time.Unix(600, 0)
+	delta := func(v float64) *float64 { return &v }
+	samples := []entities.Sample{
+		{Timestamp: start, Value: 1, Sum: delta(1)},
+		{Timestamp: start.Add(20 * time.Second), Value: 4, Sum: delta(3)},
+		{Timestamp: start.Add(40 * time.Second), Value: 7, Sum: delta(3)},
+		{Timestamp: start.Add(70 * time.Second), Value: 10, Sum: delta(3)},
+	}
+
+	gauges := rollupSamples(samples, entities.Gauge, time.Minute)
+	require.Len(t, gauges, 2)
+	assert.Equal(t, start, gauges[0].Timestamp)
+	assert.Equal(t, 4., gauges[0].Value)
+	assert.Equal(t, 1., *gauges[0].Min)
+	assert.Equal(t, 7., *gauges[0].Max)
+	assert.Equal(t, int64(3), gauges[0].Count)
+	assert.Equal(t, 10., *gauges[1].Min)
+
+	counters := rollupSamples(samples, entities.Counter, time.Minute)
+	require.Len(t, counters, 2)
+	assert.Equal(t, 7., counters[0].Value)
+	assert.Equal(t, 7., *counters[0].Sum)
+	assert.Equal(t, 3., *counters[1].Sum)
+
+	hours := rollupSamples(gauges, entities.Gauge, time.Hour)
+	require.Len(t, hours, 1)
+	assert.Equal(t, 5.5, hours[0].Value)
+	assert.Equal(t, int64(4), hours[0].Count)
+	assert.Equal(t, 1., *hours[0].Min)
+	assert.Equal(t, 10., *hours[0].Max)
+}
+
+func TestMemStoreCompact(t *testing.T) {
+	retention, err := ParseRetention("raw:1h,1m:2h,1h:24h")
+	require.NoError(t, err)
+
+	s := NewMemStore()
+	s.SetGauge("g", 1)
+	s.SetGauge("g", 3)
+	s.SetCounter("c", 2)
+	s.SetCounter("c", 5)
+	created := time.Now()
+
+	now := created.Add(90 * time.Minute)
+
+	// Отмененное сжатие не изменяет историю.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, s.Compact(canceled, now, retention), entities.ErrUnavailable)
+	gauges, err := s.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+
+	require.NoError(t, s.Compact(context.Background(), now, retention))
+
+	gauges, err = s.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 1)
+	assert.Equal(t, 2., gauges[0].Value)
+	assert.Equal(t, int64(2), gauges[0].Count)
+
+	counters, err := s.Range(entities.Counter, "c", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, counters, 1)
+	assert.Equal(t, 7., counters[0].Value)
+	assert.Equal(t, 7., *counters[0].Sum)
+
+	now = created.Add(3 * time.Hour)
+	require.NoError(t, s.Compact(context.Background(), now, retention))
+
+	gauges, err = s.Range(entities.Gauge, "g", created.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, gauges, 1)
+	assert.Equal(t, created.Truncate(time.Hour), gauges[0].Timestamp)
+	assert.Equal(t, 2., gauges[0].Value)
+	assert.Equal(t, 1., *gauges[0].Min)
+	assert.Equal(t, 3., *gauges[0].Max)
+}
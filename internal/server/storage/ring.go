@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// historySize количество хранимых значений одной метрики в памяти по умолчанию:
+// сырая история за 24 часа при записи раз в 10 секунд, см. Retention.RawSamples.
+const historySize = 24*60*60/10 + 1
+
+// ring кольцевой буфер значений метрики, упорядоченных по времени.
+// Буфер растет по мере добавления значений до max элементов.
+type ring struct {
+	samples []entities.Sample
+	start   int
+	size    int
+	max     int
+}
+
+func newRing(max int) *ring {
+	return &ring{
+		samples: make([]entities.Sample, 0),
+		max:     max,
+	}
+}
+
+// push добавляет значение, при заполнении буфера вытесняет самое старое.
+func (r *ring) push(sample entities.Sample) {
+	switch {
+	case r.size < len(r.samples):
+		r.samples[(r.start+r.size)%len(r.samples)] = sample
+		r.size++
+	case len(r.samples) < r.max:
+		if r.start != 0 {
+			r.samples = r.ordered()
+			r.start = 0
+		}
+		r.samples = append(r.samples, sample)
+		r.size++
+	default:
+		r.samples[r.start] = sample
+		r.start = (r.start + 1) % len(r.samples)
+	}
+}
+
+// ordered возвращает копию значений от старого к новому.
+func (r *ring) ordered() []entities.Sample {
+	out := make([]entities.Sample, r.size)
+	for i := range out {
+		out[i] = r.samples[(r.start+i)%len(r.samples)]
+	}
+	return out
+}
+
+// between возвращает значения в интервале [from, to].
+func (r *ring) between(from, to time.Time) []entities.Sample {
+	out := make([]entities.Sample, 0)
+	for i := 0; i < r.size; i++ {
+		sample := r.samples[(r.start+i)%len(r.samples)]
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		out = append(out, sample)
+	}
+	return out
+}
+
+// oldest возвращает время самого старого значения.
+func (r *ring) oldest() (time.Time, bool) {
+	if r.size == 0 {
+		return time.Time{}, false
+	}
+	return r.samples[r.start].Timestamp, true
+}
+
+// dropBefore удаляет значения старше t.
+func (r *ring) dropBefore(t time.Time) {
+	for r.size > 0 && r.samples[r.start].Timestamp.Before(t) {
+		r.samples[r.start] = entities.Sample{}
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
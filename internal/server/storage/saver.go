@@ -1,10 +1,11 @@
 package storage
 
 import (
-	"bufio"
-	"encoding/json"
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/echo9et/alerting/internal/entities"
@@ -12,71 +13,220 @@ import (
 	"log/slog"
 )
 
+// walMaxSize размер журнала, после которого сохраняется снимок и журнал очищается.
+const walMaxSize = 16 << 20
+
+// walSyncPeriod период сброса журнала на диск для политики SyncInterval.
+const walSyncPeriod = time.Second
+
+// Saver хранилище, сохраняющее метрики в файл.
+// Без журнала снимок сохраняется раз в storeInterval или после каждого изменения, если интервал 0.
+// С журналом каждое изменение дописывается в журнал, а снимок сохраняется раз в storeInterval
+// или при превышении walMaxSize, после чего журнал очищается.
 type Saver struct {
 	Store         entities.Storage
 	filename      string
 	isRestore     bool
 	storeInterval time.Duration
+	compress      bool
+	wal           *wal
+	// quit останавливает фоновое сохранение, done закрывается после его завершения.
+	quit chan struct{}
+	done chan struct{}
+	// mu изменения хранилища выполняются под RLock, сохранение снимка - под Lock,
+	// поэтому снимок и очищаемый журнал не расходятся.
+	mu sync.RWMutex
+}
+
+// totalsStore хранилище, которое помнит накопленные значения counter. Saver сохраняет их
+// в снимке, чтобы после перезапуска повторно переданный Total не добавлялся к counter целиком.
+type totalsStore interface {
+	MetricsWithTotals() []entities.MetricsJSON
+	RestoreTotal(key string, total int64)
+}
+
+// SaverOptions дополнительные настройки Saver.
+type SaverOptions struct {
+	// Compress сжимать снимок gzip.
+	Compress bool
+	WAL      WALOptions
 }
 
-func NewSaver(storage entities.Storage, filename string, isRestore bool, duration time.Duration) (*Saver, error) {
+func NewSaver(storage entities.Storage, filename string, isRestore bool, duration time.Duration, options SaverOptions) (*Saver, error) {
 	saver := &Saver{
 		Store:         storage,
 		filename:      filename,
 		isRestore:     isRestore,
 		storeInterval: duration,
+		compress:      options.Compress,
+	}
+
+	if options.WAL.Filename != "" {
+		w, err := openWAL(options.WAL.Filename, options.WAL.Sync)
+		if err != nil {
+			return nil, err
+		}
+		saver.wal = w
 	}
 
 	if isRestore {
-		if err := saver.restoreData(); err != nil {
+		seq, err := saver.restoreData()
+		if err != nil {
 			return nil, err
 		}
+		if saver.wal != nil {
+			if err := saver.wal.replay(storage, seq); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if err := saver.saveData(); err != nil {
-		panic(err)
+		return nil, err
 	}
 
+	var saveTicker, syncTicker *time.Ticker
 	if saver.storeInterval != 0 {
-		ticker := time.NewTicker(saver.storeInterval)
-		quit := make(chan struct{})
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					saver.saveData()
-				case <-quit:
-					ticker.Stop()
-				}
-			}
-		}()
+		saveTicker = time.NewTicker(saver.storeInterval)
+	}
+	if saver.wal != nil && options.WAL.Sync == SyncInterval {
+		syncTicker = time.NewTicker(walSyncPeriod)
 	}
+	saver.quit = make(chan struct{})
+	saver.done = make(chan struct{})
+	go saver.run(saveTicker, syncTicker)
 
 	return saver, nil
 }
 
+// run сохраняет снимки и сбрасывает журнал на диск по таймерам до закрытия quit.
+func (s *Saver) run(saveTicker, syncTicker *time.Ticker) {
+	defer close(s.done)
+
+	var saveC, syncC <-chan time.Time
+	if saveTicker != nil {
+		defer saveTicker.Stop()
+		saveC = saveTicker.C
+	}
+	if syncTicker != nil {
+		defer syncTicker.Stop()
+		syncC = syncTicker.C
+	}
+
+	for {
+		select {
+		case <-saveC:
+			if err := s.saveData(); err != nil {
+				slog.Error("Не удалось сохранить данные", "error", err)
+			}
+		case <-syncC:
+			if err := s.wal.sync(); err != nil {
+				slog.Error("Не удалось сбросить журнал на диск", "error", err)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Close останавливает фоновое сохранение, сохраняет итоговый снимок и закрывает журнал.
+func (s *Saver) Close() error {
+	close(s.quit)
+	<-s.done
+
+	if err := s.saveData(); err != nil {
+		return err
+	}
+	if s.wal != nil {
+		return s.wal.close()
+	}
+	return nil
+}
+
+// update дописывает изменение в журнал и применяет его к хранилищу,
+// без журнала при нулевом интервале сохраняет снимок.
+// Ошибки записи журнала и снимка возвращаются как ErrUnavailable, ошибки apply - как есть.
+func (s *Saver) update(metrics []entities.MetricsJSON, apply func() error) error {
+	if s.wal == nil {
+		s.mu.RLock()
+		err := apply()
+		s.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if s.storeInterval == 0 {
+			return unavailable(s.saveData())
+		}
+		return nil
+	}
+
+	var applyErr error
+	s.mu.RLock()
+	size, err := s.wal.append(metrics, func() error {
+		applyErr = apply()
+		return applyErr
+	})
+	s.mu.RUnlock()
+	if applyErr != nil {
+		return applyErr
+	}
+	if err != nil {
+		return unavailable(err)
+	}
+	if size >= walMaxSize {
+		return unavailable(s.saveData())
+	}
+	return nil
+}
+
 func (s *Saver) GetCounter(name string) (string, bool) {
 	return s.Store.GetCounter(name)
 }
 
 func (s *Saver) SetCounter(name string, iValue int64) {
-	s.Store.SetCounter(name, iValue)
-	if s.storeInterval == 0 {
-		s.saveData()
+	if err := s.UpdateCounter(context.Background(), name, iValue); err != nil {
+		slog.Error("Не удалось сохранить counter", "name", name, "error", err)
 	}
 }
 
+// Counter значение counter.
+func (s *Saver) Counter(ctx context.Context, name string) (int64, error) {
+	return s.Store.Counter(ctx, name)
+}
+
+// UpdateCounter добавляет приращение counter и сохраняет изменение.
+func (s *Saver) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	id, labels := entities.ParseSeriesKey(name)
+	metric := entities.MetricsJSON{ID: id, MType: entities.Counter, Delta: &delta, Labels: labels}
+	return s.update([]entities.MetricsJSON{metric}, func() error {
+		return s.Store.UpdateCounter(ctx, name, delta)
+	})
+}
+
 func (s *Saver) GetGauge(name string) (string, bool) {
 	return s.Store.GetGauge(name)
 }
 
 func (s *Saver) SetGauge(name string, fValue float64) {
-	s.Store.SetGauge(name, fValue)
-	if s.storeInterval == 0 {
-		s.saveData()
+	if err := s.UpdateGauge(context.Background(), name, fValue); err != nil {
+		slog.Error("Не удалось сохранить gauge", "name", name, "error", err)
 	}
 }
 
+// Gauge значение gauge.
+func (s *Saver) Gauge(ctx context.Context, name string) (float64, error) {
+	return s.Store.Gauge(ctx, name)
+}
+
+// UpdateGauge сохраняет значение gauge и изменение.
+func (s *Saver) UpdateGauge(ctx context.Context, name string, value float64) error {
+	id, labels := entities.ParseSeriesKey(name)
+	metric := entities.MetricsJSON{ID: id, MType: entities.Gauge, Value: &value, Labels: labels}
+	return s.update([]entities.MetricsJSON{metric}, func() error {
+		return s.Store.UpdateGauge(ctx, name, value)
+	})
+}
+
 func (s *Saver) AllMetrics() map[string]string {
 	return s.Store.AllMetrics()
 }
@@ -85,65 +235,115 @@ func (s *Saver) AllMetricsJSON() []entities.MetricsJSON {
 	return s.Store.AllMetricsJSON()
 }
 
-func (s *Saver) restoreData() error {
-	file, err := os.OpenFile(s.filename, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return err
+func (s *Saver) GetMetric(mType, name string) (entities.MetricsJSON, bool) {
+	return s.Store.GetMetric(mType, name)
+}
+
+func (s *Saver) Range(mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return s.Store.Range(mType, name, from, to)
+}
+
+func (s *Saver) Metric(ctx context.Context, mType, name string) (entities.MetricsJSON, error) {
+	return s.Store.Metric(ctx, mType, name)
+}
+
+func (s *Saver) Metrics(ctx context.Context) ([]entities.MetricsJSON, error) {
+	return s.Store.Metrics(ctx)
+}
+
+func (s *Saver) History(ctx context.Context, mType, name string, from, to time.Time) ([]entities.Sample, error) {
+	return s.Store.History(ctx, mType, name, from, to)
+}
+
+// Compact применяет политику хранения, если ее поддерживает хранилище.
+func (s *Saver) Compact(ctx context.Context, now time.Time, retention Retention) error {
+	if c, ok := s.Store.(Compacter); ok {
+		return c.Compact(ctx, now, retention)
 	}
-	reader := bufio.NewReader(file)
-	data, err := reader.ReadBytes('\n')
+	return nil
+}
 
+// restoreData загружает снимок и возвращает номер последней вошедшей в него записи журнала.
+func (s *Saver) restoreData() (uint64, error) {
+	data, err := os.ReadFile(s.filename)
 	if err != nil {
-		if err == io.EOF {
-			return nil
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
 		}
-		return err
+		return 0, err
 	}
 
-	metricsJSON := make([]entities.MetricsJSON, 0)
-	err = json.Unmarshal(data, &metricsJSON)
+	metricsJSON, seq, err := decodeSnapshot(data)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("restore %s: %w", s.filename, err)
 	}
 
 	for _, metric := range metricsJSON {
 		switch metric.MType {
 		case entities.Counter:
-			s.Store.SetCounter(metric.ID, *metric.Delta)
+			s.Store.SetCounter(metric.Key(), *metric.Delta)
+			if t, ok := s.Store.(totalsStore); ok && metric.Total != nil {
+				t.RestoreTotal(metric.Key(), *metric.Total)
+			}
 		case entities.Gauge:
-			s.Store.SetGauge(metric.ID, *metric.Value)
+			s.Store.SetGauge(metric.Key(), *metric.Value)
+		case entities.Histogram, entities.Summary, entities.Set:
+			if err := s.Store.SetMetrics([]entities.MetricsJSON{metric}); err != nil {
+				return 0, err
+			}
 		default:
 			slog.Warn("Не удалось прочитать тип данных при восстановление данных")
 		}
 	}
 
-	return nil
-
+	return seq, nil
 }
 
+// saveData сохраняет снимок хранилища и очищает журнал.
+// Снимок записывается во временный файл и переименовывается, поэтому при падении
+// во время записи предыдущий снимок остается целым.
 func (s *Saver) saveData() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	file, err := os.OpenFile(s.filename, os.O_WRONLY|os.O_CREATE, 0666)
+	var seq uint64
+	if s.wal != nil {
+		seq = s.wal.lastSeq()
+	}
+	metrics := s.Store.AllMetricsJSON()
+	if t, ok := s.Store.(totalsStore); ok {
+		metrics = t.MetricsWithTotals()
+	}
+	data, err := encodeSnapshot(metrics, seq, s.compress, time.Now())
 	if err != nil {
 		return err
 	}
 
-	writer := bufio.NewWriter(file)
-	metricsJSON := s.Store.AllMetricsJSON()
-	data, err := json.Marshal(&metricsJSON)
+	tmp := s.filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
-
-	if _, err := writer.Write(data); err != nil {
+	if _, err := file.Write(data); err != nil {
+		file.Close()
 		return err
 	}
-
-	if err := writer.WriteByte('\n'); err != nil {
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.filename); err != nil {
 		return err
 	}
 
-	return writer.Flush()
+	if s.wal == nil {
+		return nil
+	}
+	// Журнал очищается только после того, как снимок записан на диск.
+	return s.wal.truncate()
 }
 
 func (s *Saver) Ping() bool {
@@ -151,5 +351,16 @@ func (s *Saver) Ping() bool {
 }
 
 func (s *Saver) SetMetrics(m []entities.MetricsJSON) error {
-	return s.Store.SetMetrics(m)
+	return s.UpdateMetrics(context.Background(), m)
+}
+
+// UpdateMetrics записывает пакет метрик и сохраняет изменение.
+func (s *Saver) UpdateMetrics(ctx context.Context, m []entities.MetricsJSON) error {
+	return s.update(m, func() error {
+		return s.Store.UpdateMetrics(ctx, m)
+	})
+}
+
+func (s *Saver) Check(ctx context.Context) error {
+	return s.Store.Check(ctx)
 }
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/echo9et/alerting/internal/compgzip"
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+var ErrCorruptedSnapshot = errors.New("corrupted snapshot")
+
+const (
+	snapshotFormat  = "alerting-snapshot"
+	snapshotVersion = 1
+
+	compressionNone = "none"
+	compressionGzip = "gzip"
+)
+
+// snapshotHeader первая строка снимка, за ней следуют Size байт данных:
+// JSON-массив метрик, сжатый по Compression. Checksum - SHA-256 данных в том виде,
+// в котором они записаны в файл.
+type snapshotHeader struct {
+	Format      string    `json:"format"`
+	Version     int       `json:"version"`
+	Created     time.Time `json:"created"`
+	Compression string    `json:"compression"`
+	Size        int       `json:"size"`
+	Checksum    string    `json:"sha256"`
+	// WALSeq номер последней записи журнала, вошедшей в снимок.
+	WALSeq uint64 `json:"wal_seq,omitempty"`
+}
+
+// snapshotTrailer вторая строка снимка прежнего формата: номер последней записи журнала.
+type snapshotTrailer struct {
+	WALSeq uint64 `json:"wal_seq"`
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeSnapshot формирует снимок метрик с заголовком.
+func encodeSnapshot(metrics []entities.MetricsJSON, walSeq uint64, compress bool, created time.Time) ([]byte, error) {
+	payload, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := compressionNone
+	if compress {
+		compression = compressionGzip
+		if payload, err = compgzip.Compress(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := json.Marshal(snapshotHeader{
+		Format:      snapshotFormat,
+		Version:     snapshotVersion,
+		Created:     created.UTC(),
+		Compression: compression,
+		Size:        len(payload),
+		Checksum:    checksum(payload),
+		WALSeq:      walSeq,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(header)+1+len(payload))
+	data = append(data, header...)
+	data = append(data, '\n')
+	return append(data, payload...), nil
+}
+
+// decodeSnapshot разбирает снимок и возвращает метрики и номер последней вошедшей в него записи журнала.
+// Снимки прежнего формата - JSON-массив метрик в одну строку без заголовка - читаются без проверки.
+func decodeSnapshot(data []byte) ([]entities.MetricsJSON, uint64, error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	if data[0] == '[' {
+		return decodeLegacySnapshot(data)
+	}
+
+	line, payload, ok := bytes.Cut(data, []byte{'\n'})
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: missing header", ErrCorruptedSnapshot)
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Format != snapshotFormat {
+		return nil, 0, fmt.Errorf("%w: invalid header", ErrCorruptedSnapshot)
+	}
+	if header.Version > snapshotVersion {
+		return nil, 0, fmt.Errorf("snapshot version %d is not supported, max %d", header.Version, snapshotVersion)
+	}
+	if len(payload) != header.Size {
+		return nil, 0, fmt.Errorf("%w: expected %d bytes, got %d", ErrCorruptedSnapshot, header.Size, len(payload))
+	}
+	if checksum(payload) != header.Checksum {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptedSnapshot)
+	}
+
+	switch header.Compression {
+	case compressionNone:
+	case compressionGzip:
+		var err error
+		if payload, err = compgzip.Decompress(payload); err != nil {
+			return nil, 0, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+		}
+	default:
+		return nil, 0, fmt.Errorf("snapshot compression %q is not supported", header.Compression)
+	}
+
+	metrics := make([]entities.MetricsJSON, 0)
+	if err := json.Unmarshal(payload, &metrics); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+	return metrics, header.WALSeq, nil
+}
+
+// decodeLegacySnapshot читает снимок прежнего формата. Прежний saveData перезаписывал файл
+// без усечения, поэтому после первой строки могут остаться байты старого снимка: вторая строка
+// считается номером записи журнала, только если это snapshotTrailer, иначе хвост пропускается.
+func decodeLegacySnapshot(data []byte) ([]entities.MetricsJSON, uint64, error) {
+	line, rest, _ := bytes.Cut(data, []byte{'\n'})
+
+	metrics := make([]entities.MetricsJSON, 0)
+	if err := json.Unmarshal(line, &metrics); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrCorruptedSnapshot, err)
+	}
+
+	// Снимки без журнала не содержат второй строки.
+	rest = bytes.TrimSpace(rest)
+	if len(rest) == 0 {
+		return metrics, 0, nil
+	}
+	trailer, _, _ := bytes.Cut(rest, []byte{'\n'})
+	if seq, ok := parseTrailer(bytes.TrimSpace(trailer)); ok {
+		return metrics, seq, nil
+	}
+	slog.Warn(fmt.Sprintf("legacy snapshot: ignoring %d stale bytes after metrics", len(rest)))
+	return metrics, 0, nil
+}
+
+// parseTrailer разбирает строку snapshotTrailer. Строка должна быть объектом
+// из одного поля wal_seq, чтобы остаток старого снимка не был принят за номер записи.
+func parseTrailer(line []byte) (uint64, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil || len(fields) != 1 {
+		return 0, false
+	}
+	raw, ok := fields["wal_seq"]
+	if !ok {
+		return 0, false
+	}
+	var trailer snapshotTrailer
+	if err := json.Unmarshal(raw, &trailer.WALSeq); err != nil {
+		return 0, false
+	}
+	return trailer.WALSeq, true
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	value := 1.5
+	delta := int64(7)
+	metrics := []entities.MetricsJSON{
+		{ID: "load", MType: entities.Gauge, Value: &value, Labels: map[string]string{"host": "a"}},
+		{ID: "requests", MType: entities.Counter, Delta: &delta},
+	}
+
+	for _, compress := range []bool{false, true} {
+		data, err := encodeSnapshot(metrics, 42, compress, time.Now())
+		require.NoError(t, err)
+
+		got, seq, err := decodeSnapshot(data)
+		require.NoError(t, err)
+		assert.Equal(t, metrics, got)
+		assert.Equal(t, uint64(42), seq)
+	}
+}
+
+func TestDecodeSnapshot(t *testing.T) {
+	valid, err := encodeSnapshot([]entities.MetricsJSON{}, 0, false, time.Now())
+	require.NoError(t, err)
+	compressed, err := encodeSnapshot([]entities.MetricsJSON{}, 0, true, time.Now())
+	require.NoError(t, err)
+
+	corrupt := func(data []byte, i int) []byte {
+		data = append([]byte(nil), data...)
+		data[i] ^= 0xff
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantLen int
+		wantSeq uint64
+		wantErr error
+		errText string
+	}{
+		{name: "empty file", data: ""},
+		{name: "legacy", data: `[{"id":"load","type":"gauge","value":1}]` + "\n", wantLen: 1},
+		{name: "legacy with wal seq", data: `[{"id":"load","type":"gauge","value":1}]` + "\n" + `{"wal_seq":5}` + "\n", wantLen: 1, wantSeq: 5},
+		{name: "legacy with stale tail", data: `[{"id":"load","type":"gauge","value":1}]` + "\n" + `"value":2},{"id":"old","type":"counter","delta":3}]` + "\n", wantLen: 1},
+		{name: "legacy with stale object", data: `[{"id":"load","type":"gauge","value":1}]` + "\n" + `{"id":"old","type":"gauge","value":2}]`, wantLen: 1},
+		{name: "legacy with wal seq and stale tail", data: `[{"id":"load","type":"gauge","value":1}]` + "\n" + `{"wal_seq":5}` + "\n" + `ype":"gauge"}]`, wantLen: 1, wantSeq: 5},
+		{name: "legacy truncated", data: `[{"id":"load","type":"ga`, wantErr: ErrCorruptedSnapshot},
+		{name: "payload checksum", data: string(corrupt(valid, len(valid)-1)), wantErr: ErrCorruptedSnapshot},
+		{name: "compressed payload checksum", data: string(corrupt(compressed, len(compressed)-1)), wantErr: ErrCorruptedSnapshot},
+		{name: "truncated payload", data: string(valid[:len(valid)-1]), wantErr: ErrCorruptedSnapshot},
+		{name: "missing header", data: `{"format":"alerting-snapshot"`, wantErr: ErrCorruptedSnapshot},
+		{name: "unknown format", data: `{"format":"other"}` + "\n[]", wantErr: ErrCorruptedSnapshot},
+		{name: "newer version", data: `{"format":"alerting-snapshot","version":2}` + "\n[]", errText: "version 2 is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, seq, err := decodeSnapshot([]byte(tt.data))
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.errText != "":
+				assert.ErrorContains(t, err, tt.errText)
+			default:
+				require.NoError(t, err)
+				assert.Len(t, metrics, tt.wantLen)
+				assert.Equal(t, tt.wantSeq, seq)
+			}
+		})
+	}
+}
+
+func TestSaverSnapshot(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "data.json")
+
+		saver, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{Compress: compress})
+		require.NoError(t, err)
+		saver.SetGauge("load", 2)
+		saver.SetCounter("requests", 3)
+		require.NoError(t, saver.saveData())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "temporary file is left after rename")
+
+		restored, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+		require.NoError(t, err)
+		v, _ := restored.GetGauge("load")
+		assert.Equal(t, "2", v)
+		v, _ = restored.GetCounter("requests")
+		assert.Equal(t, "3", v)
+	}
+}
+
+func TestSaverSnapshotKeepsTotals(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	ctx := context.Background()
+	counter := func(total int64) []entities.MetricsJSON {
+		return []entities.MetricsJSON{{ID: "requests", MType: entities.Counter, Total: &total}}
+	}
+
+	saver, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+	require.NoError(t, err)
+	require.NoError(t, saver.UpdateMetrics(ctx, counter(10)))
+	require.NoError(t, saver.Close())
+
+	// После восстановления тот же Total не добавляется повторно.
+	restored, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.UpdateMetrics(ctx, counter(10)))
+	require.NoError(t, restored.UpdateMetrics(ctx, counter(12)))
+	value, err := restored.Counter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), value)
+}
+
+func TestSaverRejectsCorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.json")
+
+	saver, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+	require.NoError(t, err)
+	saver.SetGauge("load", 2)
+	require.NoError(t, saver.saveData())
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, data[:len(data)-3], 0666))
+
+	_, err = NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedSnapshot)
+	assert.ErrorContains(t, err, filename)
+}
+
+func TestSaverClose(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.json")
+	options := SaverOptions{WAL: WALOptions{Filename: filepath.Join(dir, "data.wal"), Sync: SyncInterval}}
+
+	saver, err := NewSaver(NewMemStore(), filename, true, time.Hour, options)
+	require.NoError(t, err)
+	saver.SetCounter("requests", 3)
+	require.NoError(t, saver.Close())
+
+	// Итоговый снимок содержит все изменения, журнал очищен.
+	wal, err := os.ReadFile(filepath.Join(dir, "data.wal"))
+	require.NoError(t, err)
+	assert.Empty(t, wal)
+
+	restored, err := NewSaver(NewMemStore(), filename, true, time.Hour, SaverOptions{})
+	require.NoError(t, err)
+	v, _ := restored.GetCounter("requests")
+	assert.Equal(t, "3", v)
+}
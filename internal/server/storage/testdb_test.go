@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseEnv переменная окружения с адресом базы для проверки Base.
+// База очищается перед каждым тестом.
+const testDatabaseEnv = "TEST_DATABASE_DSN"
+
+// startTestDatabase запускает базу для тестов Base, если testDatabaseEnv не задана.
+// Задается в testdb_embedded_test.go при сборке с тегом embeddedpg.
+var startTestDatabase func() (dsn string, stop func() error, err error)
+
+// testDatabase база, запущенная startTestDatabase, общая для всех тестов пакета.
+var testDatabase struct {
+	once sync.Once
+	dsn  string
+	stop func() error
+	err  error
+}
+
+// testDatabaseDSN адрес базы для тестов Base: из testDatabaseEnv, иначе встроенный Postgres
+// (go test -tags embeddedpg). Без базы тест пропускается, а в CI (задана переменная CI)
+// завершается ошибкой, чтобы проверки Base не пропадали незаметно.
+func testDatabaseDSN(t *testing.T) string {
+	if dsn := os.Getenv(testDatabaseEnv); dsn != "" {
+		return dsn
+	}
+	if startTestDatabase != nil {
+		testDatabase.once.Do(func() {
+			testDatabase.dsn, testDatabase.stop, testDatabase.err = startTestDatabase()
+		})
+		require.NoError(t, testDatabase.err, "start embedded postgres")
+		return testDatabase.dsn
+	}
+	if os.Getenv("CI") != "" {
+		t.Fatalf("%s is not set and tests are built without -tags embeddedpg", testDatabaseEnv)
+	}
+	t.Skipf("%s is not set, run with -tags embeddedpg to start embedded postgres", testDatabaseEnv)
+	return ""
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testDatabase.stop != nil {
+		if err := testDatabase.stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "stop embedded postgres:", err)
+		}
+	}
+	os.Exit(code)
+}
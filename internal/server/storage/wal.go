@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/echo9et/alerting/internal/entities"
+)
+
+// SyncPolicy определяет, когда записи журнала сбрасываются на диск (fsync).
+type SyncPolicy int
+
+const (
+	// SyncInterval fsync раз в walSyncPeriod: при падении ОС теряются изменения за последний период.
+	SyncInterval SyncPolicy = iota
+	// SyncAlways fsync после каждой записи.
+	SyncAlways
+	// SyncNever сброс на диск остается на усмотрение ОС.
+	SyncNever
+)
+
+// ParseSyncPolicy разбирает политику always, interval или never.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	}
+	return SyncInterval, fmt.Errorf("wal sync policy %q: expected always, interval or never", s)
+}
+
+// WALOptions настройки журнала Saver, пустое имя файла отключает журнал.
+type WALOptions struct {
+	Filename string
+	Sync     SyncPolicy
+}
+
+// walRecord запись журнала: пакет метрик, примененный к хранилищу одной операцией.
+// Seq возрастает монотонно и продолжается после снимка, поэтому при восстановлении
+// записи, уже вошедшие в снимок, пропускаются.
+type walRecord struct {
+	Seq     uint64                 `json:"seq"`
+	Metrics []entities.MetricsJSON `json:"metrics"`
+}
+
+// wal журнал операций записи в виде JSON-строк, дописываемых в конец файла.
+type wal struct {
+	mu     sync.Mutex
+	file   *os.File
+	policy SyncPolicy
+	seq    uint64
+	size   int64
+	dirty  bool
+}
+
+func openWAL(filename string, policy SyncPolicy) (*wal, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{file: file, policy: policy}, nil
+}
+
+// replay применяет к store записи журнала с номером больше after.
+// Неполная последняя строка остается после падения во время записи и пропускается,
+// поврежденная запись в середине журнала считается ошибкой.
+func (w *wal) replay(store entities.Storage, after uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.seq = after
+
+	reader := bufio.NewReader(w.file)
+	var offset int64
+	replayed := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				slog.Warn("wal: отброшена неполная запись", "offset", offset, "size", len(line))
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("wal: corrupted record at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		if record.Seq <= after {
+			continue
+		}
+		w.seq = record.Seq
+		if err := store.SetMetrics(record.Metrics); err != nil {
+			// Пакет был отклонен хранилищем и при записи, повторное применение ничего не меняет.
+			slog.Warn("wal: запись не применена", "seq", record.Seq, "error", err)
+			continue
+		}
+		replayed++
+	}
+
+	// Запись продолжается после последней целой строки, неполный хвост перезаписывается.
+	if err := w.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = offset
+	if replayed > 0 {
+		slog.Info("wal: восстановлены записи", "count", replayed, "seq", w.seq)
+	}
+	return nil
+}
+
+// append дописывает пакет в журнал и затем применяет его к хранилищу через apply.
+// Пакет применяется под блокировкой журнала, поэтому порядок записей совпадает
+// с порядком применения. Если запись в журнал не удалась, хранилище не меняется;
+// отклоненный хранилищем пакет удаляется из журнала. Возвращает текущий размер журнала.
+func (w *wal) append(metrics []entities.MetricsJSON, apply func() error) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := json.Marshal(walRecord{Seq: w.seq + 1, Metrics: metrics})
+	if err != nil {
+		return w.size, err
+	}
+	data = append(data, '\n')
+	if _, err := w.file.Write(data); err != nil {
+		return w.size, errors.Join(err, w.rollback())
+	}
+	if w.policy == SyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return w.size, errors.Join(err, w.rollback())
+		}
+	}
+	if err := apply(); err != nil {
+		return w.size, errors.Join(err, w.rollback())
+	}
+	w.seq++
+	w.size += int64(len(data))
+	if w.policy != SyncAlways {
+		w.dirty = true
+	}
+	return w.size, nil
+}
+
+// rollback отбрасывает запись, дописанную после w.size.
+func (w *wal) rollback() error {
+	if err := w.file.Truncate(w.size); err != nil {
+		return err
+	}
+	_, err := w.file.Seek(w.size, io.SeekStart)
+	return err
+}
+
+// sync сбрасывает на диск записи, сделанные после предыдущего сброса.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// lastSeq номер последней записи журнала.
+func (w *wal) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// truncate очищает журнал после того, как все его записи вошли в снимок.
+func (w *wal) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	w.dirty = false
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
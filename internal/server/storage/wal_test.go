@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/echo9et/alerting/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SyncPolicy
+		wantErr bool
+	}{
+		{value: "always", want: SyncAlways},
+		{value: "interval", want: SyncInterval},
+		{value: "never", want: SyncNever},
+		{value: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSyncPolicy(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func newWALSaver(t *testing.T, dir string, restore bool) *Saver {
+	t.Helper()
+	options := SaverOptions{WAL: WALOptions{Filename: filepath.Join(dir, "data.wal"), Sync: SyncAlways}}
+	saver, err := NewSaver(NewMemStore(), filepath.Join(dir, "data.json"), restore, time.Hour, options)
+	require.NoError(t, err)
+	return saver
+}
+
+func TestSaverWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	saver := newWALSaver(t, dir, true)
+
+	saver.SetCounter("requests", 5)
+	saver.SetCounter("requests", 7)
+	saver.SetGauge(`load{host="a"}`, 0.5)
+	h := entities.NewHistogram([]float64{1, 10})
+	h.Observe(3)
+	require.NoError(t, saver.SetMetrics([]entities.MetricsJSON{{ID: "latency", MType: entities.Histogram, Histogram: h}}))
+	// Отклоненный пакет не попадает в журнал.
+	require.Error(t, saver.SetMetrics([]entities.MetricsJSON{{ID: "latency", MType: entities.Histogram, Histogram: entities.NewHistogram([]float64{5})}}))
+
+	// Снимок сохранен только при запуске, изменения есть лишь в журнале.
+	for i := 0; i < 2; i++ {
+		restored := newWALSaver(t, dir, true)
+
+		v, _ := restored.GetCounter("requests")
+		assert.Equal(t, "12", v)
+		v, _ = restored.GetGauge(`load{host="a"}`)
+		assert.Equal(t, "0.5", v)
+		m, ok := restored.GetMetric(entities.Histogram, "latency")
+		require.True(t, ok)
+		assert.Equal(t, []uint64{0, 1, 0}, m.Histogram.Counts)
+	}
+}
+
+func TestSaverWALReplaySkipsSnapshotRecords(t *testing.T) {
+	dir := t.TempDir()
+	saver := newWALSaver(t, dir, true)
+	saver.SetCounter("requests", 5)
+
+	// Падение между записью снимка и очисткой журнала: записи журнала уже есть в снимке.
+	wal, err := os.ReadFile(filepath.Join(dir, "data.wal"))
+	require.NoError(t, err)
+	require.NoError(t, saver.saveData())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.wal"), wal, 0666))
+
+	restored := newWALSaver(t, dir, true)
+	v, _ := restored.GetCounter("requests")
+	assert.Equal(t, "5", v)
+
+	restored.SetCounter("requests", 1)
+	restored = newWALSaver(t, dir, true)
+	v, _ = restored.GetCounter("requests")
+	assert.Equal(t, "6", v)
+}
+
+func TestSaverWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	saver := newWALSaver(t, dir, true)
+	saver.SetCounter("requests", 5)
+
+	file, err := os.OpenFile(filepath.Join(dir, "data.wal"), os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2,"metrics":[{"id":"requ`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restored := newWALSaver(t, dir, true)
+	v, _ := restored.GetCounter("requests")
+	assert.Equal(t, "5", v)
+}
+
+func TestSaverWALCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	saver := newWALSaver(t, dir, true)
+	saver.SetCounter("requests", 5)
+	saver.SetCounter("requests", 5)
+
+	wal, err := os.ReadFile(filepath.Join(dir, "data.wal"))
+	require.NoError(t, err)
+	wal[0] = '!'
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.wal"), wal, 0666))
+
+	_, err = NewSaver(NewMemStore(), filepath.Join(dir, "data.json"), true, time.Hour, SaverOptions{WAL: WALOptions{Filename: filepath.Join(dir, "data.wal")}})
+	assert.ErrorContains(t, err, "corrupted record")
+}
+
+func TestSaverWALWriteError(t *testing.T) {
+	dir := t.TempDir()
+	options := SaverOptions{WAL: WALOptions{Filename: filepath.Join(dir, "data.wal"), Sync: SyncNever}}
+	saver, err := NewSaver(NewMemStore(), filepath.Join(dir, "data.json"), true, time.Hour, options)
+	require.NoError(t, err)
+
+	// Изменение, которое не удалось записать в журнал, - недоступность хранилища, а не ошибка данных.
+	require.NoError(t, saver.wal.file.Close())
+	err = saver.UpdateGauge(context.Background(), "load", 1)
+	assert.ErrorIs(t, err, entities.ErrUnavailable)
+	assert.ErrorIs(t, err, os.ErrClosed)
+	// Журнал пишется до хранилища, поэтому незаписанное изменение не применено.
+	_, ok := saver.Store.GetGauge("load")
+	assert.False(t, ok)
+}
+
+func TestSaverWALRejectedBatch(t *testing.T) {
+	dir := t.TempDir()
+	saver := newWALSaver(t, dir, true)
+
+	require.NoError(t, saver.UpdateGauge(context.Background(), "load", 1))
+	info, err := os.Stat(filepath.Join(dir, "data.wal"))
+	require.NoError(t, err)
+
+	// Пакет, отклоненный хранилищем, удаляется из журнала.
+	err = saver.UpdateCounter(context.Background(), "load", 1)
+	assert.ErrorIs(t, err, entities.ErrTypeMismatch)
+	rejected, err := os.Stat(filepath.Join(dir, "data.wal"))
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), rejected.Size())
+
+	require.NoError(t, saver.UpdateGauge(context.Background(), "load", 2))
+	require.NoError(t, saver.Close())
+
+	restored := newWALSaver(t, dir, true)
+	defer restored.Close()
+	v, ok := restored.GetGauge("load")
+	assert.True(t, ok)
+	assert.Equal(t, "2", v)
+	assert.Equal(t, uint64(2), restored.wal.lastSeq())
+}
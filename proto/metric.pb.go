@@ -26,8 +26,11 @@ const (
 type Metric_Type int32
 
 const (
-	Metric_GAUGE   Metric_Type = 0
-	Metric_GOUNTER Metric_Type = 1
+	Metric_GAUGE     Metric_Type = 0
+	Metric_GOUNTER   Metric_Type = 1
+	Metric_HISTOGRAM Metric_Type = 2
+	Metric_SUMMARY   Metric_Type = 3
+	Metric_SET       Metric_Type = 4
 )
 
 // Enum value maps for Metric_Type.
@@ -35,10 +38,16 @@ var (
 	Metric_Type_name = map[int32]string{
 		0: "GAUGE",
 		1: "GOUNTER",
+		2: "HISTOGRAM",
+		3: "SUMMARY",
+		4: "SET",
 	}
 	Metric_Type_value = map[string]int32{
-		"GAUGE":   0,
-		"GOUNTER": 1,
+		"GAUGE":     0,
+		"GOUNTER":   1,
+		"HISTOGRAM": 2,
+		"SUMMARY":   3,
+		"SET":       4,
 	}
 )
 
@@ -66,7 +75,227 @@ func (x Metric_Type) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use Metric_Type.Descriptor instead.
 func (Metric_Type) EnumDescriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{0, 0}
+	return file_proto_metric_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type Histogram struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Bounds        []float64              `protobuf:"fixed64,1,rep,packed,name=bounds,proto3" json:"bounds,omitempty"`
+	Counts        []uint64               `protobuf:"varint,2,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	Sum           float64                `protobuf:"fixed64,3,opt,name=sum,proto3" json:"sum,omitempty"`
+	Count         uint64                 `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Histogram) Reset() {
+	*x = Histogram{}
+	mi := &file_proto_metric_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Histogram) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Histogram) ProtoMessage() {}
+
+func (x *Histogram) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metric_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Histogram.ProtoReflect.Descriptor instead.
+func (*Histogram) Descriptor() ([]byte, []int) {
+	return file_proto_metric_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Histogram) GetBounds() []float64 {
+	if x != nil {
+		return x.Bounds
+	}
+	return nil
+}
+
+func (x *Histogram) GetCounts() []uint64 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+func (x *Histogram) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+func (x *Histogram) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type Summary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accuracy      float64                `protobuf:"fixed64,1,opt,name=accuracy,proto3" json:"accuracy,omitempty"`
+	Positive      map[int32]uint64       `protobuf:"bytes,2,rep,name=positive,proto3" json:"positive,omitempty" protobuf_key:"zigzag32,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Negative      map[int32]uint64       `protobuf:"bytes,3,rep,name=negative,proto3" json:"negative,omitempty" protobuf_key:"zigzag32,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Zero          uint64                 `protobuf:"varint,4,opt,name=zero,proto3" json:"zero,omitempty"`
+	Sum           float64                `protobuf:"fixed64,5,opt,name=sum,proto3" json:"sum,omitempty"`
+	Count         uint64                 `protobuf:"varint,6,opt,name=count,proto3" json:"count,omitempty"`
+	Min           float64                `protobuf:"fixed64,7,opt,name=min,proto3" json:"min,omitempty"`
+	Max           float64                `protobuf:"fixed64,8,opt,name=max,proto3" json:"max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_proto_metric_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metric_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_proto_metric_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Summary) GetAccuracy() float64 {
+	if x != nil {
+		return x.Accuracy
+	}
+	return 0
+}
+
+func (x *Summary) GetPositive() map[int32]uint64 {
+	if x != nil {
+		return x.Positive
+	}
+	return nil
+}
+
+func (x *Summary) GetNegative() map[int32]uint64 {
+	if x != nil {
+		return x.Negative
+	}
+	return nil
+}
+
+func (x *Summary) GetZero() uint64 {
+	if x != nil {
+		return x.Zero
+	}
+	return 0
+}
+
+func (x *Summary) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+func (x *Summary) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *Summary) GetMin() float64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *Summary) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+type Set struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Precision     uint32                 `protobuf:"varint,1,opt,name=precision,proto3" json:"precision,omitempty"`
+	Registers     []byte                 `protobuf:"bytes,2,opt,name=registers,proto3" json:"registers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Set) Reset() {
+	*x = Set{}
+	mi := &file_proto_metric_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Set) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Set) ProtoMessage() {}
+
+func (x *Set) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metric_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Set.ProtoReflect.Descriptor instead.
+func (*Set) Descriptor() ([]byte, []int) {
+	return file_proto_metric_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Set) GetPrecision() uint32 {
+	if x != nil {
+		return x.Precision
+	}
+	return 0
+}
+
+func (x *Set) GetRegisters() []byte {
+	if x != nil {
+		return x.Registers
+	}
+	return nil
 }
 
 type Metric struct {
@@ -75,13 +304,19 @@ type Metric struct {
 	Type          Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=metric.Metric_Type" json:"type,omitempty"`
 	Delta         int64                  `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
 	Value         float64                `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Histogram     *Histogram             `protobuf:"bytes,6,opt,name=histogram,proto3" json:"histogram,omitempty"`
+	Summary       *Summary               `protobuf:"bytes,7,opt,name=summary,proto3" json:"summary,omitempty"`
+	Set           *Set                   `protobuf:"bytes,8,opt,name=set,proto3" json:"set,omitempty"`
+	Members       []string               `protobuf:"bytes,9,rep,name=members,proto3" json:"members,omitempty"`
+	Total         *int64                 `protobuf:"varint,10,opt,name=total,proto3,oneof" json:"total,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Metric) Reset() {
 	*x = Metric{}
-	mi := &file_proto_metric_proto_msgTypes[0]
+	mi := &file_proto_metric_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -93,7 +328,7 @@ func (x *Metric) String() string {
 func (*Metric) ProtoMessage() {}
 
 func (x *Metric) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[0]
+	mi := &file_proto_metric_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -106,7 +341,7 @@ func (x *Metric) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Metric.ProtoReflect.Descriptor instead.
 func (*Metric) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{0}
+	return file_proto_metric_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *Metric) GetId() string {
@@ -137,6 +372,48 @@ func (x *Metric) GetValue() float64 {
 	return 0
 }
 
+func (x *Metric) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Metric) GetHistogram() *Histogram {
+	if x != nil {
+		return x.Histogram
+	}
+	return nil
+}
+
+func (x *Metric) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *Metric) GetSet() *Set {
+	if x != nil {
+		return x.Set
+	}
+	return nil
+}
+
+func (x *Metric) GetMembers() []string {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+func (x *Metric) GetTotal() int64 {
+	if x != nil && x.Total != nil {
+		return *x.Total
+	}
+	return 0
+}
+
 type UpdateMetricRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Metric        *Metric                `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
@@ -146,7 +423,7 @@ type UpdateMetricRequest struct {
 
 func (x *UpdateMetricRequest) Reset() {
 	*x = UpdateMetricRequest{}
-	mi := &file_proto_metric_proto_msgTypes[1]
+	mi := &file_proto_metric_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -158,7 +435,7 @@ func (x *UpdateMetricRequest) String() string {
 func (*UpdateMetricRequest) ProtoMessage() {}
 
 func (x *UpdateMetricRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[1]
+	mi := &file_proto_metric_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -171,7 +448,7 @@ func (x *UpdateMetricRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricRequest.ProtoReflect.Descriptor instead.
 func (*UpdateMetricRequest) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{1}
+	return file_proto_metric_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *UpdateMetricRequest) GetMetric() *Metric {
@@ -190,7 +467,7 @@ type UpdateMetricResponse struct {
 
 func (x *UpdateMetricResponse) Reset() {
 	*x = UpdateMetricResponse{}
-	mi := &file_proto_metric_proto_msgTypes[2]
+	mi := &file_proto_metric_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -202,7 +479,7 @@ func (x *UpdateMetricResponse) String() string {
 func (*UpdateMetricResponse) ProtoMessage() {}
 
 func (x *UpdateMetricResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[2]
+	mi := &file_proto_metric_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -215,7 +492,7 @@ func (x *UpdateMetricResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricResponse.ProtoReflect.Descriptor instead.
 func (*UpdateMetricResponse) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{2}
+	return file_proto_metric_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *UpdateMetricResponse) GetError() string {
@@ -234,7 +511,7 @@ type UpdateMetricsRequest struct {
 
 func (x *UpdateMetricsRequest) Reset() {
 	*x = UpdateMetricsRequest{}
-	mi := &file_proto_metric_proto_msgTypes[3]
+	mi := &file_proto_metric_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -246,7 +523,7 @@ func (x *UpdateMetricsRequest) String() string {
 func (*UpdateMetricsRequest) ProtoMessage() {}
 
 func (x *UpdateMetricsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[3]
+	mi := &file_proto_metric_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -259,7 +536,7 @@ func (x *UpdateMetricsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricsRequest.ProtoReflect.Descriptor instead.
 func (*UpdateMetricsRequest) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{3}
+	return file_proto_metric_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
@@ -278,7 +555,7 @@ type UpdateMetricsResponse struct {
 
 func (x *UpdateMetricsResponse) Reset() {
 	*x = UpdateMetricsResponse{}
-	mi := &file_proto_metric_proto_msgTypes[4]
+	mi := &file_proto_metric_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -290,7 +567,7 @@ func (x *UpdateMetricsResponse) String() string {
 func (*UpdateMetricsResponse) ProtoMessage() {}
 
 func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[4]
+	mi := &file_proto_metric_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -303,7 +580,7 @@ func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricsResponse.ProtoReflect.Descriptor instead.
 func (*UpdateMetricsResponse) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{4}
+	return file_proto_metric_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *UpdateMetricsResponse) GetError() string {
@@ -322,7 +599,7 @@ type EncryptedMetrics struct {
 
 func (x *EncryptedMetrics) Reset() {
 	*x = EncryptedMetrics{}
-	mi := &file_proto_metric_proto_msgTypes[5]
+	mi := &file_proto_metric_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -334,7 +611,7 @@ func (x *EncryptedMetrics) String() string {
 func (*EncryptedMetrics) ProtoMessage() {}
 
 func (x *EncryptedMetrics) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[5]
+	mi := &file_proto_metric_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -347,7 +624,7 @@ func (x *EncryptedMetrics) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EncryptedMetrics.ProtoReflect.Descriptor instead.
 func (*EncryptedMetrics) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{5}
+	return file_proto_metric_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *EncryptedMetrics) GetEncryptedData() string {
@@ -366,7 +643,7 @@ type UpdateEncrypteMetricsRequest struct {
 
 func (x *UpdateEncrypteMetricsRequest) Reset() {
 	*x = UpdateEncrypteMetricsRequest{}
-	mi := &file_proto_metric_proto_msgTypes[6]
+	mi := &file_proto_metric_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -378,7 +655,7 @@ func (x *UpdateEncrypteMetricsRequest) String() string {
 func (*UpdateEncrypteMetricsRequest) ProtoMessage() {}
 
 func (x *UpdateEncrypteMetricsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[6]
+	mi := &file_proto_metric_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -391,7 +668,7 @@ func (x *UpdateEncrypteMetricsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateEncrypteMetricsRequest.ProtoReflect.Descriptor instead.
 func (*UpdateEncrypteMetricsRequest) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{6}
+	return file_proto_metric_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *UpdateEncrypteMetricsRequest) GetData() []byte {
@@ -410,7 +687,7 @@ type UpdateEncrypteMetricsResponse struct {
 
 func (x *UpdateEncrypteMetricsResponse) Reset() {
 	*x = UpdateEncrypteMetricsResponse{}
-	mi := &file_proto_metric_proto_msgTypes[7]
+	mi := &file_proto_metric_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -422,7 +699,7 @@ func (x *UpdateEncrypteMetricsResponse) String() string {
 func (*UpdateEncrypteMetricsResponse) ProtoMessage() {}
 
 func (x *UpdateEncrypteMetricsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_metric_proto_msgTypes[7]
+	mi := &file_proto_metric_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -435,7 +712,7 @@ func (x *UpdateEncrypteMetricsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateEncrypteMetricsResponse.ProtoReflect.Descriptor instead.
 func (*UpdateEncrypteMetricsResponse) Descriptor() ([]byte, []int) {
-	return file_proto_metric_proto_rawDescGZIP(), []int{7}
+	return file_proto_metric_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *UpdateEncrypteMetricsResponse) GetError() string {
@@ -445,19 +722,168 @@ func (x *UpdateEncrypteMetricsResponse) GetError() string {
 	return ""
 }
 
+type GetMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	GroupBy       []string               `protobuf:"bytes,3,rep,name=group_by,json=groupBy,proto3" json:"group_by,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsRequest) Reset() {
+	*x = GetMetricsRequest{}
+	mi := &file_proto_metric_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsRequest) ProtoMessage() {}
+
+func (x *GetMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metric_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metric_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetMetricsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetMetricsRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *GetMetricsRequest) GetGroupBy() []string {
+	if x != nil {
+		return x.GroupBy
+	}
+	return nil
+}
+
+type GetMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricsResponse) Reset() {
+	*x = GetMetricsResponse{}
+	mi := &file_proto_metric_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricsResponse) ProtoMessage() {}
+
+func (x *GetMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metric_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricsResponse.ProtoReflect.Descriptor instead.
+func (*GetMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metric_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetMetricsResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *GetMetricsResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_proto_metric_proto protoreflect.FileDescriptor
 
 const file_proto_metric_proto_rawDesc = "" +
 	"\n" +
-	"\x12proto/metric.proto\x12\x06metric\"\x8d\x01\n" +
+	"\x12proto/metric.proto\x12\x06metric\"c\n" +
+	"\tHistogram\x12\x16\n" +
+	"\x06bounds\x18\x01 \x03(\x01R\x06bounds\x12\x16\n" +
+	"\x06counts\x18\x02 \x03(\x04R\x06counts\x12\x10\n" +
+	"\x03sum\x18\x03 \x01(\x01R\x03sum\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x04R\x05count\"\xf5\x02\n" +
+	"\aSummary\x12\x1a\n" +
+	"\baccuracy\x18\x01 \x01(\x01R\baccuracy\x129\n" +
+	"\bpositive\x18\x02 \x03(\v2\x1d.metric.Summary.PositiveEntryR\bpositive\x129\n" +
+	"\bnegative\x18\x03 \x03(\v2\x1d.metric.Summary.NegativeEntryR\bnegative\x12\x12\n" +
+	"\x04zero\x18\x04 \x01(\x04R\x04zero\x12\x10\n" +
+	"\x03sum\x18\x05 \x01(\x01R\x03sum\x12\x14\n" +
+	"\x05count\x18\x06 \x01(\x04R\x05count\x12\x10\n" +
+	"\x03min\x18\a \x01(\x01R\x03min\x12\x10\n" +
+	"\x03max\x18\b \x01(\x01R\x03max\x1a;\n" +
+	"\rPositiveEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x11R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\x1a;\n" +
+	"\rNegativeEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x11R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\"A\n" +
+	"\x03Set\x12\x1c\n" +
+	"\tprecision\x18\x01 \x01(\rR\tprecision\x12\x1c\n" +
+	"\tregisters\x18\x02 \x01(\fR\tregisters\"\xdb\x03\n" +
 	"\x06Metric\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
 	"\x04type\x18\x02 \x01(\x0e2\x13.metric.Metric.TypeR\x04type\x12\x14\n" +
 	"\x05delta\x18\x03 \x01(\x03R\x05delta\x12\x14\n" +
-	"\x05value\x18\x04 \x01(\x01R\x05value\"\x1e\n" +
+	"\x05value\x18\x04 \x01(\x01R\x05value\x122\n" +
+	"\x06labels\x18\x05 \x03(\v2\x1a.metric.Metric.LabelsEntryR\x06labels\x12/\n" +
+	"\thistogram\x18\x06 \x01(\v2\x11.metric.HistogramR\thistogram\x12)\n" +
+	"\asummary\x18\a \x01(\v2\x0f.metric.SummaryR\asummary\x12\x1d\n" +
+	"\x03set\x18\b \x01(\v2\v.metric.SetR\x03set\x12\x18\n" +
+	"\amembers\x18\t \x03(\tR\amembers\x12\x19\n" +
+	"\x05total\x18\n" +
+	" \x01(\x03H\x00R\x05total\x88\x01\x01\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"C\n" +
 	"\x04Type\x12\t\n" +
 	"\x05GAUGE\x10\x00\x12\v\n" +
-	"\aGOUNTER\x10\x01\"=\n" +
+	"\aGOUNTER\x10\x01\x12\r\n" +
+	"\tHISTOGRAM\x10\x02\x12\v\n" +
+	"\aSUMMARY\x10\x03\x12\a\n" +
+	"\x03SET\x10\x04B\b\n" +
+	"\x06_total\"=\n" +
 	"\x13UpdateMetricRequest\x12&\n" +
 	"\x06metric\x18\x01 \x01(\v2\x0e.metric.MetricR\x06metric\",\n" +
 	"\x14UpdateMetricResponse\x12\x14\n" +
@@ -471,11 +897,23 @@ const file_proto_metric_proto_rawDesc = "" +
 	"\x1cUpdateEncrypteMetricsRequest\x12\x12\n" +
 	"\x04data\x18\x01 \x01(\fR\x04data\"5\n" +
 	"\x1dUpdateEncrypteMetricsResponse\x12\x14\n" +
-	"\x05error\x18\x01 \x01(\tR\x05error2\x88\x02\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\"\xb8\x01\n" +
+	"\x11GetMetricsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12=\n" +
+	"\x06labels\x18\x02 \x03(\v2%.metric.GetMetricsRequest.LabelsEntryR\x06labels\x12\x19\n" +
+	"\bgroup_by\x18\x03 \x03(\tR\agroupBy\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"T\n" +
+	"\x12GetMetricsResponse\x12(\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0e.metric.MetricR\ametrics\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error2\xcd\x02\n" +
 	"\aMetrics\x12I\n" +
 	"\fUpdateMetric\x12\x1b.metric.UpdateMetricRequest\x1a\x1c.metric.UpdateMetricResponse\x12L\n" +
 	"\rUpdateMetrics\x12\x1c.metric.UpdateMetricsRequest\x1a\x1d.metric.UpdateMetricsResponse\x12d\n" +
-	"\x15UpdateEncrypteMetrics\x12$.metric.UpdateEncrypteMetricsRequest\x1a%.metric.UpdateEncrypteMetricsResponseB\x0eZ\fmetric/protob\x06proto3"
+	"\x15UpdateEncrypteMetrics\x12$.metric.UpdateEncrypteMetricsRequest\x1a%.metric.UpdateEncrypteMetricsResponse\x12C\n" +
+	"\n" +
+	"GetMetrics\x12\x19.metric.GetMetricsRequest\x1a\x1a.metric.GetMetricsResponseB\x0eZ\fmetric/protob\x06proto3"
 
 var (
 	file_proto_metric_proto_rawDescOnce sync.Once
@@ -490,33 +928,52 @@ func file_proto_metric_proto_rawDescGZIP() []byte {
 }
 
 var file_proto_metric_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_proto_metric_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_metric_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_proto_metric_proto_goTypes = []any{
 	(Metric_Type)(0),                      // 0: metric.Metric.Type
-	(*Metric)(nil),                        // 1: metric.Metric
-	(*UpdateMetricRequest)(nil),           // 2: metric.UpdateMetricRequest
-	(*UpdateMetricResponse)(nil),          // 3: metric.UpdateMetricResponse
-	(*UpdateMetricsRequest)(nil),          // 4: metric.UpdateMetricsRequest
-	(*UpdateMetricsResponse)(nil),         // 5: metric.UpdateMetricsResponse
-	(*EncryptedMetrics)(nil),              // 6: metric.EncryptedMetrics
-	(*UpdateEncrypteMetricsRequest)(nil),  // 7: metric.UpdateEncrypteMetricsRequest
-	(*UpdateEncrypteMetricsResponse)(nil), // 8: metric.UpdateEncrypteMetricsResponse
+	(*Histogram)(nil),                     // 1: metric.Histogram
+	(*Summary)(nil),                       // 2: metric.Summary
+	(*Set)(nil),                           // 3: metric.Set
+	(*Metric)(nil),                        // 4: metric.Metric
+	(*UpdateMetricRequest)(nil),           // 5: metric.UpdateMetricRequest
+	(*UpdateMetricResponse)(nil),          // 6: metric.UpdateMetricResponse
+	(*UpdateMetricsRequest)(nil),          // 7: metric.UpdateMetricsRequest
+	(*UpdateMetricsResponse)(nil),         // 8: metric.UpdateMetricsResponse
+	(*EncryptedMetrics)(nil),              // 9: metric.EncryptedMetrics
+	(*UpdateEncrypteMetricsRequest)(nil),  // 10: metric.UpdateEncrypteMetricsRequest
+	(*UpdateEncrypteMetricsResponse)(nil), // 11: metric.UpdateEncrypteMetricsResponse
+	(*GetMetricsRequest)(nil),             // 12: metric.GetMetricsRequest
+	(*GetMetricsResponse)(nil),            // 13: metric.GetMetricsResponse
+	nil,                                   // 14: metric.Summary.PositiveEntry
+	nil,                                   // 15: metric.Summary.NegativeEntry
+	nil,                                   // 16: metric.Metric.LabelsEntry
+	nil,                                   // 17: metric.GetMetricsRequest.LabelsEntry
 }
 var file_proto_metric_proto_depIdxs = []int32{
-	0, // 0: metric.Metric.type:type_name -> metric.Metric.Type
-	1, // 1: metric.UpdateMetricRequest.metric:type_name -> metric.Metric
-	1, // 2: metric.UpdateMetricsRequest.metrics:type_name -> metric.Metric
-	2, // 3: metric.Metrics.UpdateMetric:input_type -> metric.UpdateMetricRequest
-	4, // 4: metric.Metrics.UpdateMetrics:input_type -> metric.UpdateMetricsRequest
-	7, // 5: metric.Metrics.UpdateEncrypteMetrics:input_type -> metric.UpdateEncrypteMetricsRequest
-	3, // 6: metric.Metrics.UpdateMetric:output_type -> metric.UpdateMetricResponse
-	5, // 7: metric.Metrics.UpdateMetrics:output_type -> metric.UpdateMetricsResponse
-	8, // 8: metric.Metrics.UpdateEncrypteMetrics:output_type -> metric.UpdateEncrypteMetricsResponse
-	6, // [6:9] is the sub-list for method output_type
-	3, // [3:6] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	14, // 0: metric.Summary.positive:type_name -> metric.Summary.PositiveEntry
+	15, // 1: metric.Summary.negative:type_name -> metric.Summary.NegativeEntry
+	0,  // 2: metric.Metric.type:type_name -> metric.Metric.Type
+	16, // 3: metric.Metric.labels:type_name -> metric.Metric.LabelsEntry
+	1,  // 4: metric.Metric.histogram:type_name -> metric.Histogram
+	2,  // 5: metric.Metric.summary:type_name -> metric.Summary
+	3,  // 6: metric.Metric.set:type_name -> metric.Set
+	4,  // 7: metric.UpdateMetricRequest.metric:type_name -> metric.Metric
+	4,  // 8: metric.UpdateMetricsRequest.metrics:type_name -> metric.Metric
+	17, // 9: metric.GetMetricsRequest.labels:type_name -> metric.GetMetricsRequest.LabelsEntry
+	4,  // 10: metric.GetMetricsResponse.metrics:type_name -> metric.Metric
+	5,  // 11: metric.Metrics.UpdateMetric:input_type -> metric.UpdateMetricRequest
+	7,  // 12: metric.Metrics.UpdateMetrics:input_type -> metric.UpdateMetricsRequest
+	10, // 13: metric.Metrics.UpdateEncrypteMetrics:input_type -> metric.UpdateEncrypteMetricsRequest
+	12, // 14: metric.Metrics.GetMetrics:input_type -> metric.GetMetricsRequest
+	6,  // 15: metric.Metrics.UpdateMetric:output_type -> metric.UpdateMetricResponse
+	8,  // 16: metric.Metrics.UpdateMetrics:output_type -> metric.UpdateMetricsResponse
+	11, // 17: metric.Metrics.UpdateEncrypteMetrics:output_type -> metric.UpdateEncrypteMetricsResponse
+	13, // 18: metric.Metrics.GetMetrics:output_type -> metric.GetMetricsResponse
+	15, // [15:19] is the sub-list for method output_type
+	11, // [11:15] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_proto_metric_proto_init() }
@@ -524,13 +981,14 @@ func file_proto_metric_proto_init() {
 	if File_proto_metric_proto != nil {
 		return
 	}
+	file_proto_metric_proto_msgTypes[3].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_metric_proto_rawDesc), len(file_proto_metric_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   8,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
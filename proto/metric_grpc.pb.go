@@ -24,6 +24,7 @@ const (
 	Metrics_UpdateMetric_FullMethodName          = "/metric.Metrics/UpdateMetric"
 	Metrics_UpdateMetrics_FullMethodName         = "/metric.Metrics/UpdateMetrics"
 	Metrics_UpdateEncrypteMetrics_FullMethodName = "/metric.Metrics/UpdateEncrypteMetrics"
+	Metrics_GetMetrics_FullMethodName            = "/metric.Metrics/GetMetrics"
 )
 
 // MetricsClient is the client API for Metrics service.
@@ -33,6 +34,7 @@ type MetricsClient interface {
 	UpdateMetric(ctx context.Context, in *UpdateMetricRequest, opts ...grpc.CallOption) (*UpdateMetricResponse, error)
 	UpdateMetrics(ctx context.Context, in *UpdateMetricsRequest, opts ...grpc.CallOption) (*UpdateMetricsResponse, error)
 	UpdateEncrypteMetrics(ctx context.Context, in *UpdateEncrypteMetricsRequest, opts ...grpc.CallOption) (*UpdateEncrypteMetricsResponse, error)
+	GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error)
 }
 
 type metricsClient struct {
@@ -73,6 +75,16 @@ func (c *metricsClient) UpdateEncrypteMetrics(ctx context.Context, in *UpdateEnc
 	return out, nil
 }
 
+func (c *metricsClient) GetMetrics(ctx context.Context, in *GetMetricsRequest, opts ...grpc.CallOption) (*GetMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMetricsResponse)
+	err := c.cc.Invoke(ctx, Metrics_GetMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility.
@@ -80,6 +92,7 @@ type MetricsServer interface {
 	UpdateMetric(context.Context, *UpdateMetricRequest) (*UpdateMetricResponse, error)
 	UpdateMetrics(context.Context, *UpdateMetricsRequest) (*UpdateMetricsResponse, error)
 	UpdateEncrypteMetrics(context.Context, *UpdateEncrypteMetricsRequest) (*UpdateEncrypteMetricsResponse, error)
+	GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error)
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -99,6 +112,9 @@ func (UnimplementedMetricsServer) UpdateMetrics(context.Context, *UpdateMetricsR
 func (UnimplementedMetricsServer) UpdateEncrypteMetrics(context.Context, *UpdateEncrypteMetricsRequest) (*UpdateEncrypteMetricsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateEncrypteMetrics not implemented")
 }
+func (UnimplementedMetricsServer) GetMetrics(context.Context, *GetMetricsRequest) (*GetMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 func (UnimplementedMetricsServer) testEmbeddedByValue()                 {}
 
@@ -174,6 +190,24 @@ func _Metrics_UpdateEncrypteMetrics_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_GetMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).GetMetrics(ctx, req.(*GetMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -193,6 +227,10 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateEncrypteMetrics",
 			Handler:    _Metrics_UpdateEncrypteMetrics_Handler,
 		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _Metrics_GetMetrics_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metric.proto",